@@ -12,13 +12,15 @@ import (
 )
 
 const (
-	CtxJwtUid   = "CtxJwtUid"
-	CtxJwtRoles = "CtxJwtRoles"
+	CtxJwtUid    = "CtxJwtUid"
+	CtxJwtRoles  = "CtxJwtRoles"
+	CtxJwtTenant = "CtxJwtTenant"
 )
 
 type jwtClaims struct {
 	jwt.StandardClaims
 	Uid         int64
+	Tenant      int64 `json:",omitempty"`
 	Roles       string
 	ExpiredDate string
 }
@@ -59,6 +61,11 @@ func (jwtAuth *JwtAuth) AddOpenRouters(routers ...string) {
 }
 
 func (jwtAuth *JwtAuth) Token(uid int64, roles string) (string, error) {
+	return jwtAuth.TenantToken(uid, 0, roles)
+}
+
+// TenantToken 携带租户的 token, tenant 为 0 时等同 Token, 不携带租户
+func (jwtAuth *JwtAuth) TenantToken(uid int64, tenant int64, roles string) (string, error) {
 	nowTime := time.Now()
 	expiredTime := nowTime.Add(time.Duration(jwtAuth.expires) * time.Second)
 
@@ -67,6 +74,7 @@ func (jwtAuth *JwtAuth) Token(uid int64, roles string) (string, error) {
 			ExpiresAt: expiredTime.Unix(),
 		},
 		Uid:         uid,
+		Tenant:      tenant,
 		Roles:       roles,
 		ExpiredDate: helpers.FormatDefaultDate(expiredTime),
 	}
@@ -120,6 +128,9 @@ func (jwtAuth *JwtAuth) Authentication(ctx *gin.Context) {
 
 	ctx.Set(CtxJwtUid, claims.Uid)
 	ctx.Set(CtxJwtRoles, claims.Roles)
+	if claims.Tenant != 0 {
+		ctx.Set(CtxJwtTenant, claims.Tenant)
+	}
 
 	// 白名单校验
 	if len(jwtAuth.whiteApiList) > 0 && helpers.IndexOf[string](jwtAuth.whiteApiList, router) >= 0 {
@@ -0,0 +1,179 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// errLegacyFailed 旧版 DAO 方法返回 false 时的错误, 旧版方法不返回具体原因
+var errLegacyFailed = errors.New("dao operation failed")
+
+// ContextDao 取 DAO 的 context 版本: 实现了 DAOContextInterface 时直接返回,
+// 否则包装旧版方法, ctx 不会传递给旧版方法(不参与事务), 旧版没有对应方法的操作返回错误
+func ContextDao(dao DAOInterface) DAOContextInterface {
+	if cd, ok := dao.(DAOContextInterface); ok {
+		return cd
+	}
+	return &legacyDao{dao: dao}
+}
+
+// legacyDao 以旧版方法实现 DAOContextInterface
+type legacyDao struct {
+	dao DAOInterface
+}
+
+func (l *legacyDao) unsupported(method string) error {
+	return fmt.Errorf("%T does not implement %s", l.dao, method)
+}
+
+func legacyResult(ok bool) error {
+	if ok {
+		return nil
+	}
+	return errLegacyFailed
+}
+
+func legacyModel(m ModelInterface) (ModelInterface, error) {
+	if m == nil || reflect.ValueOf(m).IsNil() {
+		return nil, &DaoError{Kind: ErrNotFound}
+	}
+	return m, nil
+}
+
+func (l *legacyDao) GetModel() ModelInterface {
+	return l.dao.GetModel()
+}
+
+// engineDao 可选接口, 旧版 DAO 实现后包装时使用其数据库
+type engineDao interface {
+	GetEngine() string
+}
+
+// GetEngine 旧版 DAO 实现 GetEngine 时使用其数据库, 否则为默认数据库
+func (l *legacyDao) GetEngine() string {
+	if dao, ok := l.dao.(engineDao); ok {
+		return engineName(dao.GetEngine())
+	}
+	return engineName("")
+}
+
+func (l *legacyDao) InsertContext(_ context.Context, m ModelInterface, operator int64) error {
+	return legacyResult(l.dao.Insert(m, operator))
+}
+
+// updateResult 更新失败时查询记录是否存在, 不存在时返回 ErrNotFound
+func (l *legacyDao) updateResult(ok bool, pk interface{}) error {
+	if ok {
+		return nil
+	}
+	if _, err := legacyModel(l.dao.FindByPk(pk)); err != nil {
+		return err
+	}
+	return errLegacyFailed
+}
+
+func (l *legacyDao) UpdateContext(_ context.Context, m ModelInterface, operator int64) error {
+	return l.updateResult(l.dao.Update(m, operator), m.GetId())
+}
+
+func (l *legacyDao) UpdateColumnContext(_ context.Context, pk interface{}, column string, v interface{}, operator int64) error {
+	return l.updateResult(l.dao.UpdateColumn(pk, column, v, operator), pk)
+}
+
+func (l *legacyDao) UpdateStatusContext(_ context.Context, pk int64, status interface{}, operator int64) error {
+	return l.updateResult(l.dao.UpdateStatus(pk, status, operator), pk)
+}
+
+func (l *legacyDao) DeleteContext(_ context.Context, m ModelInterface, operator int64) error {
+	return legacyResult(l.dao.Delete(m, operator))
+}
+
+func (l *legacyDao) DeleteByPkContext(_ context.Context, pk interface{}, operator int64) error {
+	return legacyResult(l.dao.DeleteByPk(pk, operator))
+}
+
+func (l *legacyDao) RemoveContext(_ context.Context, m ModelInterface, operator int64) error {
+	return legacyResult(l.dao.Remove(m, operator))
+}
+
+func (l *legacyDao) RemoveByPkContext(_ context.Context, pk interface{}) error {
+	return legacyResult(l.dao.RemoveByPk(pk))
+}
+
+func (l *legacyDao) FindByPkContext(_ context.Context, pk interface{}) (ModelInterface, error) {
+	return legacyModel(l.dao.FindByPk(pk))
+}
+
+func (l *legacyDao) FindOneByColumnContext(_ context.Context, column string, value interface{}) (ModelInterface, error) {
+	return legacyModel(l.dao.FindOneByColumn(column, value))
+}
+
+func (l *legacyDao) FindOneByColumnsContext(context.Context, map[string]interface{}) (ModelInterface, error) {
+	return nil, l.unsupported("FindOneByColumnsContext")
+}
+
+// FindByPksContext 逐个调用 FindByPk
+func (l *legacyDao) FindByPksContext(_ context.Context, pks []int64) (interface{}, error) {
+	model := l.dao.GetModel()
+	rows := reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(model)), 0, len(pks))
+	for _, pk := range pks {
+		if m, err := legacyModel(l.dao.FindByPk(pk)); err == nil {
+			rows = reflect.Append(rows, reflect.ValueOf(m))
+		}
+	}
+	return rows.Interface(), nil
+}
+
+func (l *legacyDao) CountContext(_ context.Context, query interface{}, args ...interface{}) (int64, error) {
+	return l.dao.Count(query, args...), nil
+}
+
+func (l *legacyDao) CountByPkContext(_ context.Context, pk interface{}) (int64, error) {
+	return l.dao.CountByPk(pk), nil
+}
+
+func (l *legacyDao) CountByColumnContext(_ context.Context, column string, value interface{}) (int64, error) {
+	return l.dao.CountByColumn(column, value), nil
+}
+
+func (l *legacyDao) FindPageContext(_ context.Context, modelParams ModelInterface, baseParams *BaseQueryParams) (interface{}, PageData, error) {
+	rows, pageData := l.dao.FindPage(modelParams, baseParams)
+	return rows, pageData, nil
+}
+
+func (l *legacyDao) FindListContext(_ context.Context, modelParams ModelInterface, baseParams *BaseQueryParams) (interface{}, error) {
+	return l.dao.FindList(modelParams, baseParams), nil
+}
+
+func (l *legacyDao) FindAllContext(_ context.Context, modelParams ModelInterface, baseParams *BaseQueryParams) (interface{}, error) {
+	return l.dao.FindAll(modelParams, baseParams), nil
+}
+
+func (l *legacyDao) FindListByColumnContext(_ context.Context, column string, value interface{}) (interface{}, error) {
+	return l.dao.FindListByColumn(column, value), nil
+}
+
+func (l *legacyDao) RestoreContext(context.Context, interface{}, int64) error {
+	return l.unsupported("RestoreContext")
+}
+
+func (l *legacyDao) FindDeletedContext(context.Context, ModelInterface, *BaseQueryParams) (interface{}, PageData, error) {
+	return nil, PageData{}, l.unsupported("FindDeletedContext")
+}
+
+func (l *legacyDao) PurgeDeletedContext(context.Context, time.Duration) (int64, error) {
+	return 0, l.unsupported("PurgeDeletedContext")
+}
+
+func (l *legacyDao) AggregateContext(context.Context, ModelInterface, *BaseQueryParams, *AggregateParams) ([]AggregateRow, error) {
+	return nil, l.unsupported("AggregateContext")
+}
+
+func (l *legacyDao) ExportContext(context.Context, ModelInterface, *BaseQueryParams, func(rows interface{}) error) error {
+	return l.unsupported("ExportContext")
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// legacyUserDao 只实现 DAOInterface 的 DAO
+type legacyUserDao struct {
+	DAOInterface
+	engine string
+}
+
+func (dao *legacyUserDao) GetEngine() string {
+	return dao.engine
+}
+
+func TestContextDaoEngine(t *testing.T) {
+	if _, ok := DAOInterface(new(legacyUserDao)).(DAOContextInterface); ok {
+		t.Fatal("legacyUserDao should not implement DAOContextInterface")
+	}
+	if engine := ContextDao(&legacyUserDao{engine: "other"}).GetEngine(); engine != "other" {
+		t.Fatalf("expected engine of the wrapped dao, got %q", engine)
+	}
+	if engine := ContextDao(&legacyUserDao{}).GetEngine(); engine != DefaultDbEngine {
+		t.Fatalf("expected default engine, got %q", engine)
+	}
+}
+
+// stubLegacyDao 旧版方法返回固定结果的 DAO
+type stubLegacyDao struct {
+	DAOInterface
+	ok    bool
+	found ModelInterface
+}
+
+func (dao *stubLegacyDao) Insert(ModelInterface, int64) bool                  { return dao.ok }
+func (dao *stubLegacyDao) Update(ModelInterface, int64) bool                  { return dao.ok }
+func (dao *stubLegacyDao) UpdateStatus(int64, interface{}, int64) bool        { return dao.ok }
+func (dao *stubLegacyDao) DeleteByPk(interface{}, int64) bool                 { return dao.ok }
+func (dao *stubLegacyDao) RemoveByPk(interface{}) bool                        { return dao.ok }
+func (dao *stubLegacyDao) FindByPk(interface{}) ModelInterface                { return dao.found }
+func (dao *stubLegacyDao) FindOneByColumn(string, interface{}) ModelInterface { return dao.found }
+
+func TestLegacyDaoResults(t *testing.T) {
+	ctx := context.Background()
+	var missing *testUser
+	existing := &testUser{BaseModel: BaseModel{Id: 1}}
+	call := map[string]func(cd DAOContextInterface) error{
+		"insert": func(cd DAOContextInterface) error { return cd.InsertContext(ctx, &testUser{}, 1) },
+		"update": func(cd DAOContextInterface) error { return cd.UpdateContext(ctx, existing, 1) },
+		"status": func(cd DAOContextInterface) error { return cd.UpdateStatusContext(ctx, 1, "1", 1) },
+		"delete": func(cd DAOContextInterface) error { return cd.DeleteByPkContext(ctx, 1, 1) },
+		"remove": func(cd DAOContextInterface) error { return cd.RemoveByPkContext(ctx, 1) },
+		"find": func(cd DAOContextInterface) error {
+			_, err := cd.FindByPkContext(ctx, 1)
+			return err
+		},
+		"findOne": func(cd DAOContextInterface) error {
+			_, err := cd.FindOneByColumnContext(ctx, "username", "a")
+			return err
+		},
+		"unsupported": func(cd DAOContextInterface) error {
+			_, err := cd.FindOneByColumnsContext(ctx, map[string]interface{}{"username": "a"})
+			return err
+		},
+	}
+	cases := []struct {
+		method string
+		ok     bool
+		found  ModelInterface
+		want   error // nil 表示成功, errLegacyFailed 表示旧版失败, 其他为错误类型
+	}{
+		{"insert", true, nil, nil},
+		{"insert", false, nil, errLegacyFailed},
+		{"update", true, existing, nil},
+		{"update", false, existing, errLegacyFailed},
+		{"update", false, missing, ErrNotFound},
+		{"update", false, nil, ErrNotFound},
+		{"status", false, existing, errLegacyFailed},
+		{"status", false, missing, ErrNotFound},
+		{"delete", true, nil, nil},
+		{"delete", false, nil, errLegacyFailed},
+		{"remove", true, nil, nil},
+		{"remove", false, nil, errLegacyFailed},
+		{"find", false, existing, nil},
+		{"find", false, missing, ErrNotFound},
+		{"find", false, nil, ErrNotFound},
+		{"findOne", false, existing, nil},
+		{"findOne", false, missing, ErrNotFound},
+	}
+	for _, c := range cases {
+		err := call[c.method](ContextDao(&stubLegacyDao{ok: c.ok, found: c.found}))
+		if c.want == nil && err != nil || c.want != nil && !errors.Is(err, c.want) {
+			t.Fatalf("%s(ok=%v, found=%v): expected %v, got %v", c.method, c.ok, c.found, c.want, err)
+		}
+	}
+	if err := call["unsupported"](ContextDao(&stubLegacyDao{ok: true})); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected an unsupported error, got %v", err)
+	}
+}
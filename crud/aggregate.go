@@ -0,0 +1,306 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// GroupableInterface 可选, 模型声明可分组的字段(json 名、字段名或列名)
+// 也可在字段上标注 `groupable:"true"`; 都未声明时不支持按字段分组
+type GroupableInterface interface {
+	GroupableFields() []string
+}
+
+// 按 created_at 分组的时间粒度
+const (
+	IntervalDay   = "day"   // 2022-10-18
+	IntervalWeek  = "week"  // 周一的日期, 如 2022-10-17
+	IntervalMonth = "month" // 2022-10
+)
+
+// 聚合函数, sum/avg/min/max 只能用于数值字段
+const (
+	AggregateCount = "count"
+	AggregateSum   = "sum"
+	AggregateAvg   = "avg"
+	AggregateMin   = "min"
+	AggregateMax   = "max"
+)
+
+// PeriodKey 按时间分组时, AggregateRow.Group 中时间段的键
+const PeriodKey = "period"
+
+// AggregateMaxGroups 聚合结果最多的分组数, 超过时返回 ErrValidation
+var AggregateMaxGroups = 1000
+
+// AggregateParams 聚合参数, 过滤条件使用 BaseQueryParams 与模型的 query 标签, 与列表查询一致
+type AggregateParams struct {
+	GroupBy  string `form:"groupBy" json:"groupBy"`   // 分组字段, 如 status,categoryId, 须为可分组字段
+	Interval string `form:"interval" json:"interval"` // 按 created_at 分组: day week month
+	Metrics  string `form:"metrics" json:"metrics"`   // 如 count,sum:amount,avg:amount, 默认 count
+}
+
+// AggregateRow 一组聚合结果
+// Group 为分组字段的 json 名 => 值, 按时间分组时包含 PeriodKey
+// Values 为指标 => 值, 如 count、sum_amount(函数_字段 json 名)
+type AggregateRow struct {
+	Group  map[string]interface{} `json:"group"`
+	Values map[string]interface{} `json:"values"`
+}
+
+// aggregateMetric 解析后的指标
+type aggregateMetric struct {
+	fn    string
+	field *schema.Field // count 时为 nil
+	name  string
+}
+
+// aggregateQuery 解析后的聚合参数
+type aggregateQuery struct {
+	groups   []*schema.Field
+	interval string
+	metrics  []aggregateMetric
+}
+
+// groupableFields 模型声明的可分组字段
+func groupableFields(m ModelInterface, s *schema.Schema) []*schema.Field {
+	fields := make([]*schema.Field, 0)
+	if groupable, ok := m.(GroupableInterface); ok {
+		for _, name := range groupable.GroupableFields() {
+			if field := LookUpField(s, name); field != nil {
+				fields = append(fields, field)
+			}
+		}
+	}
+	for _, field := range s.Fields {
+		if len(field.DBName) > 0 && field.StructField.Tag.Get("groupable") == "true" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// parseAggregate 校验聚合参数, engine 为模型所在数据库, 未知或不允许的字段、函数返回 ErrValidation
+func parseAggregate(engine string, m ModelInterface, params *AggregateParams) (*aggregateQuery, error) {
+	s, err := EngineModelSchema(engine, m)
+	if err != nil {
+		return nil, err
+	}
+	if params == nil {
+		params = new(AggregateParams)
+	}
+	query := &aggregateQuery{interval: strings.ToLower(strings.TrimSpace(params.Interval))}
+	allowed := groupableFields(m, s)
+	for _, name := range strings.Split(params.GroupBy, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		field := LookUpField(s, name)
+		if field == nil {
+			return nil, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("unknown group field %q", name)}
+		}
+		if IsSensitiveField(field) || !containsField(allowed, field) {
+			return nil, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("field %q is not groupable", name)}
+		}
+		if !containsField(query.groups, field) {
+			query.groups = append(query.groups, field)
+		}
+	}
+	switch query.interval {
+	case "":
+	case IntervalDay, IntervalWeek, IntervalMonth:
+		if _, ok := s.FieldsByDBName["created_at"]; !ok {
+			return nil, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("%s has no created_at column", m.Table())}
+		}
+	default:
+		return nil, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("unknown interval %q", params.Interval)}
+	}
+	metrics := params.Metrics
+	if len(strings.TrimSpace(metrics)) == 0 {
+		metrics = AggregateCount
+	}
+	for _, item := range strings.Split(metrics, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		metric, err := parseAggregateMetric(s, item)
+		if err != nil {
+			return nil, err
+		}
+		duplicate := false
+		for _, other := range query.metrics {
+			duplicate = duplicate || other.name == metric.name
+		}
+		if !duplicate {
+			query.metrics = append(query.metrics, metric)
+		}
+	}
+	return query, nil
+}
+
+// parseAggregateMetric 解析指标, 如 count、sum:amount
+func parseAggregateMetric(s *schema.Schema, item string) (aggregateMetric, error) {
+	fn, name, _ := strings.Cut(item, ":")
+	fn = strings.ToLower(strings.TrimSpace(fn))
+	name = strings.TrimSpace(name)
+	switch fn {
+	case AggregateCount:
+		if len(name) > 0 {
+			return aggregateMetric{}, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("count takes no field, got %q", item)}
+		}
+		return aggregateMetric{fn: fn, name: fn}, nil
+	case AggregateSum, AggregateAvg, AggregateMin, AggregateMax:
+	default:
+		return aggregateMetric{}, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("unknown aggregate function %q", fn)}
+	}
+	field := LookUpField(s, name)
+	if field == nil {
+		return aggregateMetric{}, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("unknown aggregate field %q", name)}
+	}
+	//同 isSortable, 敏感字段及 json:"-" 的字段(如 tenant_id、created_by)不可聚合
+	numeric := field.DataType == schema.Int || field.DataType == schema.Uint || field.DataType == schema.Float
+	if IsSensitiveField(field) || len(JsonName(field)) == 0 || !numeric {
+		return aggregateMetric{}, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("field %q is not aggregatable", name)}
+	}
+	return aggregateMetric{fn: fn, field: field, name: fn + "_" + JsonName(field)}, nil
+}
+
+// periodExpression 按时间粒度截取 created_at 的表达式, 结果为字符串, 各数据库写法不同
+// col 为已加引号的列名; sqlite 按存储的本地时间截取, 不做时区转换
+func periodExpression(dialect string, interval string, col string) (string, error) {
+	switch dialect {
+	case "mysql":
+		switch interval {
+		case IntervalDay:
+			return "DATE_FORMAT(" + col + ", '%Y-%m-%d')", nil
+		case IntervalWeek:
+			return "DATE_FORMAT(DATE_SUB(" + col + ", INTERVAL WEEKDAY(" + col + ") DAY), '%Y-%m-%d')", nil
+		case IntervalMonth:
+			return "DATE_FORMAT(" + col + ", '%Y-%m')", nil
+		}
+	case "postgres":
+		switch interval {
+		case IntervalDay, IntervalWeek:
+			return "to_char(date_trunc('" + interval + "', " + col + "), 'YYYY-MM-DD')", nil
+		case IntervalMonth:
+			return "to_char(date_trunc('month', " + col + "), 'YYYY-MM')", nil
+		}
+	case "sqlite":
+		switch interval {
+		case IntervalDay:
+			return "substr(" + col + ", 1, 10)", nil
+		case IntervalWeek:
+			return "date(substr(" + col + ", 1, 10), 'weekday 0', '-6 days')", nil
+		case IntervalMonth:
+			return "substr(" + col + ", 1, 7)", nil
+		}
+	case "sqlserver":
+		switch interval {
+		case IntervalDay:
+			return "CONVERT(char(10), " + col + ", 23)", nil
+		case IntervalWeek:
+			return "CONVERT(char(10), DATEADD(day, -((DATEPART(weekday, " + col + ") + @@DATEFIRST - 2) % 7), " + col + "), 23)", nil
+		case IntervalMonth:
+			return "CONVERT(char(7), " + col + ", 23)", nil
+		}
+	}
+	return "", &DaoError{Kind: ErrValidation, Err: fmt.Errorf("interval %q is not supported by %s", interval, dialect)}
+}
+
+// AggregateContext 聚合统计, 有只读副本时使用副本
+// 过滤条件与 FindListContext 一致(query 标签、BeginTime/EndTime、Keyword、Filter), 分页与排序参数不生效
+// 结果按分组升序, 分组数超过 AggregateMaxGroups 时返回 ErrValidation
+func (dao *BaseDao) AggregateContext(ctx context.Context, modelParams ModelInterface, baseParams *BaseQueryParams, params *AggregateParams) ([]AggregateRow, error) {
+	query, err := parseAggregate(dao.Engine, dao.Model, params)
+	if err != nil {
+		return nil, err
+	}
+	wrapper := dao.newWrapper(modelParams, baseParams)
+	db := dao.readSess(ctx).Scopes(wrapper.QueryScope()).Table(dao.Model.Table())
+	quote := func(name string) string {
+		return db.Statement.Quote(clause.Column{Table: dao.Model.Table(), Name: name})
+	}
+	selects := make([]string, 0)
+	groups := make([]string, 0)
+	if len(query.interval) > 0 {
+		period, err := periodExpression(db.Dialector.Name(), query.interval, quote("created_at"))
+		if err != nil {
+			return nil, err
+		}
+		selects = append(selects, period+" AS g_period")
+		groups = append(groups, period)
+	}
+	for i, field := range query.groups {
+		selects = append(selects, quote(field.DBName)+" AS g_"+strconv.Itoa(i))
+		groups = append(groups, quote(field.DBName))
+	}
+	for i, metric := range query.metrics {
+		expr := "COUNT(*)"
+		if metric.field != nil {
+			expr = strings.ToUpper(metric.fn) + "(" + quote(metric.field.DBName) + ")"
+		}
+		selects = append(selects, expr+" AS m_"+strconv.Itoa(i))
+	}
+	db = db.Select(selects)
+	for _, group := range groups {
+		db = db.Group(group).Order(group)
+	}
+	result := make([]map[string]interface{}, 0)
+	if err = db.Limit(AggregateMaxGroups + 1).Find(&result).Error; err != nil {
+		return nil, wrapDbError(err)
+	}
+	if len(result) > AggregateMaxGroups {
+		return nil, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("too many groups, max is %d", AggregateMaxGroups)}
+	}
+	rows := make([]AggregateRow, 0, len(result))
+	for _, item := range result {
+		row := AggregateRow{Group: make(map[string]interface{}), Values: make(map[string]interface{})}
+		if len(query.interval) > 0 {
+			row.Group[PeriodKey] = aggregateValue(item["g_period"], false)
+		}
+		for i, field := range query.groups {
+			key := JsonName(field)
+			if len(key) == 0 {
+				key = field.DBName
+			}
+			row.Group[key] = aggregateValue(item["g_"+strconv.Itoa(i)], false)
+		}
+		for i, metric := range query.metrics {
+			row.Values[metric.name] = aggregateValue(item["m_"+strconv.Itoa(i)], true)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// aggregateValue 统一驱动返回的值, 取指针(如 sqlite 表达式列的 *interface{})指向的值, []byte 转为字符串;
+// 指标的字符串(如 mysql 的 DECIMAL)转为数值
+func aggregateValue(v interface{}, numeric bool) interface{} {
+	for rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr; rv = reflect.ValueOf(v) {
+		if rv.IsNil() {
+			return nil
+		}
+		v = rv.Elem().Interface()
+	}
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+	if s, ok := v.(string); ok && numeric {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return v
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// aggOrder 聚合测试模型
+type aggOrder struct {
+	BaseModel
+	ModelFactory[aggOrder]
+	Category string `json:"category" groupable:"true"`
+	Channel  string `json:"channel"`
+	Amount   int    `json:"amount"`
+	Cost     int    `json:"cost" sensitive:"true"`
+	Note     string `json:"note"`
+	TailColumns
+}
+
+func (*aggOrder) Table() string { return "agg_orders" }
+
+// newAggDao 插入订单, 日期依次为 2022-10-17(周一)、2022-10-19、2022-10-24、2022-11-01
+func newAggDao(t *testing.T) *BaseDao {
+	newTestDb(t, new(aggOrder))
+	dao := &BaseDao{Model: new(aggOrder)}
+	days := []string{"2022-10-17", "2022-10-19", "2022-10-24", "2022-11-01"}
+	for i, day := range days {
+		created, err := time.ParseInLocation("2006-01-02 15:04", day+" 10:00", time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o := &aggOrder{Category: []string{"a", "b"}[i%2], Amount: (i + 1) * 10}
+		o.CreatedAt = created
+		if err = dao.InsertContext(context.Background(), o, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dao
+}
+
+// aggregateSummary 将结果转为 分组:指标 的字符串, 便于比较
+func aggregateSummary(rows []AggregateRow, group, value string) string {
+	s := ""
+	for _, row := range rows {
+		s += fmt.Sprintf("%v:%v;", row.Group[group], row.Values[value])
+	}
+	return s
+}
+
+func TestAggregateGroupBy(t *testing.T) {
+	dao := newAggDao(t)
+	ctx := context.Background()
+	rows, err := dao.AggregateContext(ctx, nil, nil, &AggregateParams{GroupBy: "category", Metrics: "count,sum:amount"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := aggregateSummary(rows, "category", "sum_amount"); s != "a:40;b:60;" {
+		t.Fatalf("unexpected sums %s", s)
+	}
+	if s := aggregateSummary(rows, "category", "count"); s != "a:2;b:2;" {
+		t.Fatalf("unexpected counts %s", s)
+	}
+}
+
+func TestAggregateValidation(t *testing.T) {
+	dao := newAggDao(t)
+	cases := []struct {
+		name   string
+		params AggregateParams
+	}{
+		{"group not whitelisted", AggregateParams{GroupBy: "channel"}},
+		{"group unknown", AggregateParams{GroupBy: "nope"}},
+		{"group hidden", AggregateParams{GroupBy: "created_by"}},
+		{"metric non numeric", AggregateParams{Metrics: "sum:note"}},
+		{"metric sensitive", AggregateParams{Metrics: "max:cost"}},
+		{"metric hidden", AggregateParams{Metrics: "sum:created_by"}},
+		{"metric unknown function", AggregateParams{Metrics: "median:amount"}},
+		{"unknown interval", AggregateParams{Interval: "year"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := dao.AggregateContext(context.Background(), nil, nil, &c.params); !errors.Is(err, ErrValidation) {
+				t.Fatalf("expected ErrValidation, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAggregateInterval(t *testing.T) {
+	dao := newAggDao(t)
+	cases := []struct {
+		interval string
+		want     string
+	}{
+		{IntervalDay, "2022-10-17:1;2022-10-19:1;2022-10-24:1;2022-11-01:1;"},
+		{IntervalWeek, "2022-10-17:2;2022-10-24:1;2022-10-31:1;"},
+		{IntervalMonth, "2022-10:3;2022-11:1;"},
+	}
+	for _, c := range cases {
+		rows, err := dao.AggregateContext(context.Background(), nil, nil, &AggregateParams{Interval: c.interval})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := aggregateSummary(rows, PeriodKey, "count"); s != c.want {
+			t.Fatalf("%s: expected %s, got %s", c.interval, c.want, s)
+		}
+	}
+}
+
+func TestAggregateMaxGroups(t *testing.T) {
+	dao := newAggDao(t)
+	defer func(n int) { AggregateMaxGroups = n }(AggregateMaxGroups)
+	AggregateMaxGroups = 3
+	if _, err := dao.AggregateContext(context.Background(), nil, nil, &AggregateParams{Interval: IntervalDay}); !errors.Is(err, ErrValidation) {
+		t.Fatalf("expected ErrValidation for 4 groups, got %v", err)
+	}
+	if rows, err := dao.AggregateContext(context.Background(), nil, nil, &AggregateParams{Interval: IntervalMonth}); err != nil || len(rows) != 2 {
+		t.Fatalf("expected 2 groups, got %v, %v", rows, err)
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/zhouhp1295/g3/helpers"
+	"go.uber.org/zap"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// 审计动作
+const (
+	AuditInsert  = "insert"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"  // 逻辑删除
+	AuditRemove  = "remove"  // 物理删除
+	AuditRestore = "restore" // 恢复逻辑删除
+)
+
+// auditSkipColumns 变更对比时忽略的列, 操作人与时间已记录在审计记录上
+var auditSkipColumns = []string{"updated_at", "updated_by"}
+
+// AuditMask 敏感列(sensitive:"true")及 json:"-" 列在审计记录中的值, 只体现该列有变更
+const AuditMask = "***"
+
+// AuditChange 字段变更
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditEntry 一次变更的审计记录
+type AuditEntry struct {
+	Engine    string                 `json:"engine"` // 数据库名, 与业务操作的 DAO 相同
+	Operator  int64                  `json:"operator"`
+	Tenant    int64                  `json:"tenant"`
+	Action    string                 `json:"action"`
+	Table     string                 `json:"table"`
+	Pk        string                 `json:"pk"`
+	Changes   map[string]AuditChange `json:"changes"`
+	CreatedAt time.Time              `json:"createdAt"`
+}
+
+// AuditSink 审计记录的输出
+type AuditSink interface {
+	WriteAudit(ctx context.Context, entry *AuditEntry) error
+}
+
+// AuditSinkFunc 函数形式的 AuditSink
+type AuditSinkFunc func(ctx context.Context, entry *AuditEntry) error
+
+func (f AuditSinkFunc) WriteAudit(ctx context.Context, entry *AuditEntry) error {
+	return f(ctx, entry)
+}
+
+var (
+	auditSink   AuditSink
+	auditSinkMu sync.RWMutex
+)
+
+// SetAuditSink 设置审计输出, nil 表示关闭审计
+// 设置后 BaseDao 的 Insert/Update/UpdateColumn/Delete/Remove 都会记录审计, 与变更在同一事务中写入, 写入失败时返回错误并回滚变更
+func SetAuditSink(sink AuditSink) {
+	auditSinkMu.Lock()
+	defer auditSinkMu.Unlock()
+	auditSink = sink
+}
+
+func getAuditSink() AuditSink {
+	auditSinkMu.RLock()
+	defer auditSinkMu.RUnlock()
+	return auditSink
+}
+
+// AuditLog 审计表, 使用 DbAuditSink 时需通过 MigrateTables 创建
+type AuditLog struct {
+	BaseModel
+	ModelFactory[AuditLog]
+	TenantId int64  `gorm:"NOT NULL;DEFAULT:0;INDEX;COMMENT:租户" json:"-"`
+	Action   string `gorm:"TYPE:VARCHAR(20);NOT NULL;COMMENT:动作" json:"action" form:"action" query:"eq"`
+	Target   string `gorm:"TYPE:VARCHAR(100);NOT NULL;INDEX:idx_audit_target;COMMENT:表名" json:"target" form:"target" query:"eq"`
+	Pk       string `gorm:"TYPE:VARCHAR(100);NOT NULL;INDEX:idx_audit_target;COMMENT:主键" json:"pk" form:"pk" query:"eq"`
+	Changes  string `gorm:"TYPE:TEXT;COMMENT:变更内容" json:"changes"`
+	TailColumns
+}
+
+func (auditLog *AuditLog) Table() string {
+	return "audit_log"
+}
+
+func (auditLog *AuditLog) TableName() string {
+	return auditLog.Table()
+}
+
+// DbAuditSink 写入业务操作所在数据库(AuditEntry.Engine)的审计表, 与业务操作使用同一事务
+type DbAuditSink struct{}
+
+func (sink DbAuditSink) WriteAudit(ctx context.Context, entry *AuditEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+	log := &AuditLog{
+		TenantId: entry.Tenant,
+		Action:   entry.Action,
+		Target:   entry.Table,
+		Pk:       entry.Pk,
+		Changes:  string(changes),
+	}
+	log.SetCreatedBy(entry.Operator)
+	log.SetUpdatedBy(entry.Operator)
+	log.CreatedAt = entry.CreatedAt
+	return EngineSessContext(ctx, entry.Engine).Create(log).Error
+}
+
+// ZapAuditSink 写入日志
+type ZapAuditSink struct {
+	Logger *zap.Logger
+}
+
+func (sink ZapAuditSink) WriteAudit(ctx context.Context, entry *AuditEntry) error {
+	sink.Logger.Info("audit",
+		zap.String("action", entry.Action),
+		zap.String("table", entry.Table),
+		zap.String("pk", entry.Pk),
+		zap.Int64("operator", entry.Operator),
+		zap.Int64("tenant", entry.Tenant),
+		zap.Reflect("changes", entry.Changes),
+	)
+	return nil
+}
+
+// FindAuditLogs 查询数据库 engine 中模型 m 的记录的变更历史(DbAuditSink), 按时间倒序, ctx 中有租户时按租户过滤
+// 租户模型同 BaseDao, ctx 中缺少租户时返回 ErrTenantRequired, 跨租户查询使用 WithoutTenantScope
+func FindAuditLogs(ctx context.Context, engine string, m ModelInterface, pk interface{}) ([]*AuditLog, error) {
+	rows := make([]*AuditLog, 0)
+	db := EngineSessContext(ctx, engine).Where("target = ? AND pk = ?", m.Table(), fmt.Sprint(pk))
+	if !skipTenantScope(ctx) {
+		tenant, ok := TenantFromContext(ctx)
+		switch {
+		case ok:
+			db = db.Where("tenant_id = ?", tenant)
+		case IsTenantModel(m):
+			return rows, ErrTenantRequired
+		}
+	}
+	err := db.Order("id DESC").Find(&rows).Error
+	return rows, wrapDbError(err)
+}
+
+// FindHistoryContext 查询记录的变更历史, 见 FindAuditLogs
+func (dao *BaseDao) FindHistoryContext(ctx context.Context, pk interface{}) ([]*AuditLog, error) {
+	return FindAuditLogs(ctx, dao.Engine, dao.Model, pk)
+}
+
+type operatorContextKey struct{}
+
+// WithOperator ctx 中设置操作人, 用于 RemoveByPk 等没有操作人参数的审计
+func WithOperator(ctx context.Context, operator int64) context.Context {
+	return context.WithValue(ctx, operatorContextKey{}, operator)
+}
+
+// OperatorFromContext 取 ctx 中的操作人
+func OperatorFromContext(ctx context.Context) (int64, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	operator, ok := ctx.Value(operatorContextKey{}).(int64)
+	return operator, ok
+}
+
+// auditEnabled 是否需要审计该模型
+func auditEnabled(m ModelInterface) bool {
+	if getAuditSink() == nil {
+		return false
+	}
+	_, isAuditLog := m.(*AuditLog)
+	return !isAuditLog
+}
+
+// writeAudit 组装并输出审计记录, engine 为 m 所在数据库
+func writeAudit(ctx context.Context, engine string, m ModelInterface, action string, pk interface{}, operator int64, changes map[string]AuditChange) error {
+	sink := getAuditSink()
+	if sink == nil {
+		return nil
+	}
+	if operator == 0 {
+		operator, _ = OperatorFromContext(ctx)
+	}
+	tenant, _ := TenantFromContext(ctx)
+	entry := &AuditEntry{
+		Engine:    engineName(engine),
+		Operator:  operator,
+		Tenant:    tenant,
+		Action:    action,
+		Table:     m.Table(),
+		Pk:        fmt.Sprint(pk),
+		Changes:   maskAuditChanges(engine, m, changes),
+		CreatedAt: time.Now(),
+	}
+	if err := sink.WriteAudit(ctx, entry); err != nil {
+		return fmt.Errorf("write audit failed: %w", err)
+	}
+	return nil
+}
+
+// auditInsert 记录插入, engine 为 model 所在数据库
+func auditInsert(ctx context.Context, engine string, model ModelInterface, m ModelInterface, operator int64) error {
+	if !auditEnabled(model) {
+		return nil
+	}
+	after, err := auditValues(ctx, engine, m)
+	if err != nil {
+		return err
+	}
+	return writeAudit(ctx, engine, model, AuditInsert, m.GetId(), operator, auditDiff(nil, after))
+}
+
+// auditValues 模型各列的值, engine 为模型所在数据库
+func auditValues(ctx context.Context, engine string, m ModelInterface) (map[string]interface{}, error) {
+	s, err := EngineModelSchema(engine, m)
+	if err != nil {
+		return nil, err
+	}
+	rv := reflect.Indirect(reflect.ValueOf(m))
+	values := make(map[string]interface{}, len(s.DBNames))
+	for _, field := range s.Fields {
+		if len(field.DBName) == 0 {
+			continue
+		}
+		values[field.DBName], _ = field.ValueOf(ctx, rv)
+	}
+	return values, nil
+}
+
+// maskAuditChanges 将敏感列及 json:"-" 列的值替换为 AuditMask, 审计记录可通过 HandleHistory 返回给前端
+func maskAuditChanges(engine string, m ModelInterface, changes map[string]AuditChange) map[string]AuditChange {
+	s, err := EngineModelSchema(engine, m)
+	if err != nil {
+		return changes
+	}
+	for col, change := range changes {
+		field := s.LookUpField(col)
+		if field == nil || (!IsSensitiveField(field) && len(JsonName(field)) > 0) {
+			continue
+		}
+		if change.Before != nil {
+			change.Before = AuditMask
+		}
+		if change.After != nil {
+			change.After = AuditMask
+		}
+		changes[col] = change
+	}
+	return changes
+}
+
+// auditDiff 对比前后的值, after 中不存在的列视为未变更; before 为 nil 表示新增, after 为 nil 表示删除
+func auditDiff(before, after map[string]interface{}) map[string]AuditChange {
+	changes := make(map[string]AuditChange)
+	switch {
+	case before == nil:
+		for col, v := range after {
+			changes[col] = AuditChange{After: v}
+		}
+	case after == nil:
+		for col, v := range before {
+			changes[col] = AuditChange{Before: v}
+		}
+	default:
+		for col, v := range after {
+			if helpers.IndexOf[string](auditSkipColumns, col) >= 0 {
+				continue
+			}
+			if old, ok := before[col]; !ok || !reflect.DeepEqual(old, v) {
+				changes[col] = AuditChange{Before: before[col], After: v}
+			}
+		}
+	}
+	return changes
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAuditMasksHiddenColumns(t *testing.T) {
+	newTestDb(t, new(testUser))
+	entries := make([]*AuditEntry, 0)
+	SetAuditSink(AuditSinkFunc(func(ctx context.Context, entry *AuditEntry) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+	defer SetAuditSink(nil)
+
+	ctx := context.Background()
+	dao := &BaseDao{Model: new(testUser)}
+	user := &testUser{Username: "alice", Password: "secret-hash", Age: 20}
+	if err := dao.InsertContext(ctx, user, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := dao.UpdateColumnContext(ctx, user.Id, "password", "other-hash", 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 audit entries, got %d", len(entries))
+	}
+
+	inserted := entries[0].Changes
+	if inserted["username"].After != "alice" {
+		t.Fatalf("unexpected username change %#v", inserted["username"])
+	}
+	for _, col := range []string{"password", "created_by", "deleted"} {
+		if inserted[col].After != AuditMask {
+			t.Fatalf("%s not masked: %#v", col, inserted[col])
+		}
+	}
+
+	updated := entries[1].Changes
+	if change, ok := updated["password"]; !ok || change.Before != AuditMask || change.After != AuditMask {
+		t.Fatalf("password change not masked: %#v", updated)
+	}
+	if _, ok := updated["username"]; ok {
+		t.Fatalf("unchanged column recorded: %#v", updated)
+	}
+}
+
+func TestFindAuditLogsTenant(t *testing.T) {
+	newTestDb(t, new(tenantUser), new(AuditLog))
+	SetAuditSink(DbAuditSink{})
+	defer SetAuditSink(nil)
+
+	dao := &BaseDao{Model: new(tenantUser)}
+	u := &tenantUser{Username: "a"}
+	if err := dao.InsertContext(WithTenant(context.Background(), 1), u, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dao.FindHistoryContext(context.Background(), u.Id); !errors.Is(err, ErrTenantRequired) {
+		t.Fatalf("expected ErrTenantRequired, got %v", err)
+	}
+	cases := []struct {
+		name string
+		ctx  context.Context
+		want int
+	}{
+		{"own tenant", WithTenant(context.Background(), 1), 1},
+		{"other tenant", WithTenant(context.Background(), 2), 0},
+		{"without tenant scope", WithoutTenantScope(context.Background()), 1},
+	}
+	for _, c := range cases {
+		logs, err := dao.FindHistoryContext(c.ctx, u.Id)
+		if err != nil || len(logs) != c.want {
+			t.Fatalf("%s: expected %d logs, got %d, %v", c.name, c.want, len(logs), err)
+		}
+	}
+}
+
+func TestDbAuditSinkEngineTx(t *testing.T) {
+	newTestDb(t, new(AuditLog))
+	RegisterDbEngine("audit", openTestDb(t, new(testUser), new(AuditLog)))
+	SetAuditSink(DbAuditSink{})
+	defer SetAuditSink(nil)
+
+	dao := &BaseDao{Model: new(testUser), Engine: "audit"}
+	errRollback := errors.New("rollback")
+	err := WithEngineTx(context.Background(), "audit", func(ctx context.Context) error {
+		if err := dao.InsertContext(ctx, &testUser{Username: "a"}, 1); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("expected rollback error, got %v", err)
+	}
+	for _, engine := range []string{DefaultDbEngine, "audit"} {
+		var cnt int64
+		if err = DbEngine(engine).Model(new(AuditLog)).Count(&cnt).Error; err != nil || cnt != 0 {
+			t.Fatalf("%s: expected audit rolled back, got %d rows, %v", engine, cnt, err)
+		}
+	}
+
+	u := &testUser{Username: "b"}
+	if err = dao.InsertContext(context.Background(), u, 1); err != nil {
+		t.Fatal(err)
+	}
+	if logs, err := dao.FindHistoryContext(context.Background(), u.Id); err != nil || len(logs) != 1 {
+		t.Fatalf("expected 1 log on the dao's engine, got %d, %v", len(logs), err)
+	}
+}
+
+func TestAuditSinkFailureRollsBack(t *testing.T) {
+	db := newTestDb(t, new(testUser), new(versionUser))
+	ctx := context.Background()
+	dao := &BaseDao{Model: new(testUser)}
+	user := &testUser{Username: "alice", Age: 20}
+	if err := dao.InsertContext(ctx, user, 1); err != nil {
+		t.Fatal(err)
+	}
+	versionDao := &BaseDao{Model: new(versionUser)}
+	vu := &versionUser{Username: "bob"}
+	if err := versionDao.InsertContext(ctx, vu, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	sinkErr := errors.New("sink unavailable")
+	SetAuditSink(AuditSinkFunc(func(ctx context.Context, entry *AuditEntry) error {
+		return sinkErr
+	}))
+	defer SetAuditSink(nil)
+
+	if dao.Update(&testUser{BaseModel: BaseModel{Id: user.Id}, Username: "carol", Age: 30}, 2) {
+		t.Fatal("expected Update to fail when the audit sink fails")
+	}
+	if err := dao.UpdateColumnContext(ctx, user.Id, "age", 40, 2); !errors.Is(err, sinkErr) {
+		t.Fatalf("expected the sink error, got %v", err)
+	}
+	if err := dao.DeleteByPkContext(ctx, user.Id, 2); !errors.Is(err, sinkErr) {
+		t.Fatalf("expected the sink error, got %v", err)
+	}
+	if err := dao.RemoveByPkContext(ctx, user.Id); !errors.Is(err, sinkErr) {
+		t.Fatalf("expected the sink error, got %v", err)
+	}
+	if err := dao.InsertContext(ctx, &testUser{Username: "dave"}, 2); !errors.Is(err, sinkErr) {
+		t.Fatalf("expected the sink error, got %v", err)
+	}
+	var rows []testUser
+	db.Find(&rows)
+	if len(rows) != 1 || rows[0].Username != "alice" || rows[0].Age != 20 || rows[0].Deleted != FlagNo || rows[0].UpdatedBy != 1 {
+		t.Fatalf("expected the row to be unchanged, got %+v", rows)
+	}
+
+	vu.Username = "erin"
+	if err := versionDao.UpdateContext(ctx, vu, 2); !errors.Is(err, sinkErr) {
+		t.Fatalf("expected the sink error, got %v", err)
+	}
+	if vu.Version != 0 {
+		t.Fatalf("expected the version to be restored, got %d", vu.Version)
+	}
+}
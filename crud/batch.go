@@ -0,0 +1,252 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// DefaultBatchSize 批量操作默认每批数量
+const DefaultBatchSize = 100
+
+// ErrBatchFailed 批量操作中有记录失败, 详情见 BatchResult.Errors
+var ErrBatchFailed = errors.New("batch failed")
+
+// BatchError 单条记录的错误
+type BatchError struct {
+	Index int         `json:"index"`        // 在传入列表中的下标
+	Pk    interface{} `json:"pk,omitempty"` // 主键, 插入时为空
+	Err   error       `json:"-"`
+	Msg   string      `json:"msg"` // 校验失败时为钩子的提示, 其他为错误类型, 不包含驱动错误信息
+}
+
+// BatchResult 批量操作结果
+type BatchResult struct {
+	Total     int          `json:"total"`
+	Succeeded int          `json:"succeeded"`
+	Errors    []BatchError `json:"errors"`
+}
+
+func newBatchResult(total int) *BatchResult {
+	return &BatchResult{Total: total, Errors: make([]BatchError, 0)}
+}
+
+func (result *BatchResult) fail(index int, pk interface{}, err error) {
+	msg := ValidationMessage(err)
+	var daoErr *DaoError
+	if len(msg) == 0 && errors.As(err, &daoErr) {
+		msg = daoErr.Kind.Error()
+	}
+	if len(msg) == 0 {
+		msg = "unexpected error"
+	}
+	result.Errors = append(result.Errors, BatchError{Index: index, Pk: pk, Err: err, Msg: msg})
+}
+
+// err 有失败记录时返回 ErrBatchFailed
+func (result *BatchResult) err() error {
+	if len(result.Errors) == 0 {
+		return nil
+	}
+	return &DaoError{Kind: ErrBatchFailed, Err: fmt.Errorf("%d of %d records failed: %w", len(result.Errors), result.Total, result.Errors[0].Err)}
+}
+
+type batchSizeContextKey struct{}
+
+type partialBatchContextKey struct{}
+
+// WithBatchSize 设置批量操作每批数量
+func WithBatchSize(ctx context.Context, size int) context.Context {
+	return context.WithValue(ctx, batchSizeContextKey{}, size)
+}
+
+// WithPartialBatch 批量操作允许部分成功, 失败的记录回滚, 其余记录提交
+// 默认任一记录失败时全部回滚
+func WithPartialBatch(ctx context.Context) context.Context {
+	return context.WithValue(ctx, partialBatchContextKey{}, true)
+}
+
+func batchSize(ctx context.Context) int {
+	if size, ok := ctx.Value(batchSizeContextKey{}).(int); ok && size > 0 {
+		return size
+	}
+	return DefaultBatchSize
+}
+
+func isPartialBatch(ctx context.Context) bool {
+	partial, _ := ctx.Value(partialBatchContextKey{}).(bool)
+	return partial
+}
+
+// runBatch 在事务中分批处理 total 条记录, 每条记录在 savepoint 中执行, 失败时仅回滚该记录
+// 未设置 WithPartialBatch 时, 有失败记录则整体回滚并返回 ErrBatchFailed
+func runBatch(ctx context.Context, dao DAOInterface, total int, fn func(ctx context.Context, result *BatchResult, begin, end int) error) (*BatchResult, error) {
+	result := newBatchResult(total)
+	size := batchSize(ctx)
+	err := WithEngineTx(ctx, ContextDao(dao).GetEngine(), func(ctx context.Context) error {
+		for begin := 0; begin < total; begin += size {
+			end := begin + size
+			if end > total {
+				end = total
+			}
+			if err := fn(ctx, result, begin, end); err != nil {
+				return err
+			}
+		}
+		if isPartialBatch(ctx) {
+			return nil
+		}
+		return result.err()
+	})
+	if err != nil {
+		result.Succeeded = 0
+	}
+	return result, err
+}
+
+// batchRecord 在 savepoint 中处理一条记录
+func batchRecord(ctx context.Context, dao DAOInterface, result *BatchResult, index int, pk interface{}, fn func(ctx context.Context) error) {
+	if err := WithEngineTx(ctx, ContextDao(dao).GetEngine(), fn); err != nil {
+		result.fail(index, pk, err)
+		return
+	}
+	result.Succeeded++
+}
+
+// InsertBatch 批量插入, 每条记录执行 BeforeInsert/AfterInsert 钩子
+// 每批先通过一条 INSERT 写入, 失败时逐条插入以定位失败的记录; 允许部分成功时逐条插入
+func InsertBatch(ctx context.Context, dao DAOInterface, ms []ModelInterface, operator int64) (*BatchResult, error) {
+	return runBatch(ctx, dao, len(ms), func(ctx context.Context, result *BatchResult, begin, end int) error {
+		valid := make([]int, 0, end-begin)
+		for i := begin; i < end; i++ {
+			if err := beforeInsert(ctx, dao, ms[i]); err != nil {
+				result.fail(i, nil, err)
+				continue
+			}
+			valid = append(valid, i)
+		}
+		if len(valid) == 0 {
+			return nil
+		}
+		inserted := !isPartialBatch(ctx) && WithEngineTx(ctx, ContextDao(dao).GetEngine(), func(ctx context.Context) error {
+			return insertChunk(ctx, dao, ms, valid, operator)
+		}) == nil
+		for _, i := range valid {
+			m := ms[i]
+			batchRecord(ctx, dao, result, i, nil, func(ctx context.Context) error {
+				if !inserted {
+					if err := ContextDao(dao).InsertContext(ctx, m, operator); err != nil {
+						return err
+					}
+				}
+				return afterInsert(ctx, dao, m)
+			})
+		}
+		return nil
+	})
+}
+
+// insertChunk 一条 INSERT 写入多条记录
+func insertChunk(ctx context.Context, dao DAOInterface, ms []ModelInterface, indexes []int, operator int64) error {
+	model := dao.GetModel()
+	rows := reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(model)), 0, len(indexes))
+	for _, i := range indexes {
+		ms[i].SetCreatedBy(operator)
+		ms[i].SetUpdatedBy(operator)
+		if err := fillTenant(ctx, ms[i]); err != nil {
+			return err
+		}
+		rows = reflect.Append(rows, reflect.ValueOf(ms[i]))
+	}
+	if err := EngineSessContext(ctx, ContextDao(dao).GetEngine()).Create(rows.Interface()).Error; err != nil {
+		return wrapDbError(err)
+	}
+	for _, i := range indexes {
+		if err := auditInsert(ctx, ContextDao(dao).GetEngine(), model, ms[i], operator); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateBatch 批量更新, 每条记录执行 BeforeUpdate/AfterUpdate 钩子
+func UpdateBatch(ctx context.Context, dao DAOInterface, ms []ModelInterface, operator int64) (*BatchResult, error) {
+	return runBatch(ctx, dao, len(ms), func(ctx context.Context, result *BatchResult, begin, end int) error {
+		for i := begin; i < end; i++ {
+			m := ms[i]
+			batchRecord(ctx, dao, result, i, m.GetId(), func(ctx context.Context) error {
+				if err := beforeUpdate(ctx, dao, m); err != nil {
+					return err
+				}
+				if err := ContextDao(dao).UpdateContext(ctx, m, operator); err != nil {
+					return err
+				}
+				return afterUpdate(ctx, dao, m)
+			})
+		}
+		return nil
+	})
+}
+
+// DeleteByPks 批量逻辑删除, 每条记录执行 BeforeDelete/AfterDelete 钩子
+func DeleteByPks(ctx context.Context, dao DAOInterface, pks []int64, operator int64) (*BatchResult, error) {
+	return batchByPks(ctx, dao, pks, func(ctx context.Context, m ModelInterface) error {
+		if err := beforeDelete(ctx, dao, m); err != nil {
+			return err
+		}
+		if err := ContextDao(dao).DeleteContext(ctx, m, operator); err != nil {
+			return err
+		}
+		return afterDelete(ctx, dao, m)
+	})
+}
+
+// RemoveByPks 批量物理删除, 每条记录执行 BeforeRemove/AfterRemove 钩子
+func RemoveByPks(ctx context.Context, dao DAOInterface, pks []int64, operator int64) (*BatchResult, error) {
+	return batchByPks(ctx, dao, pks, func(ctx context.Context, m ModelInterface) error {
+		if err := beforeRemove(ctx, dao, m); err != nil {
+			return err
+		}
+		if err := ContextDao(dao).RemoveContext(ctx, m, operator); err != nil {
+			return err
+		}
+		return afterRemove(ctx, dao, m)
+	})
+}
+
+// UpdateStatusByPks 批量更新状态, 不存在或已逻辑删除的记录记为 ErrNotFound
+func UpdateStatusByPks(ctx context.Context, dao DAOInterface, pks []int64, status interface{}, operator int64) (*BatchResult, error) {
+	return batchByPks(ctx, dao, pks, func(ctx context.Context, m ModelInterface) error {
+		return ContextDao(dao).UpdateStatusContext(ctx, m.GetId(), status, operator)
+	})
+}
+
+// batchByPks 按主键分批查询后逐条处理, 不存在(或已删除)的主键记为 ErrNotFound
+func batchByPks(ctx context.Context, dao DAOInterface, pks []int64, fn func(ctx context.Context, m ModelInterface) error) (*BatchResult, error) {
+	return runBatch(ctx, dao, len(pks), func(ctx context.Context, result *BatchResult, begin, end int) error {
+		rows, err := ContextDao(dao).FindByPksContext(ctx, pks[begin:end])
+		if err != nil {
+			return err
+		}
+		models := make(map[int64]ModelInterface)
+		v := reflect.Indirect(reflect.ValueOf(rows))
+		for i := 0; i < v.Len(); i++ {
+			m := v.Index(i).Interface().(ModelInterface)
+			models[m.GetId()] = m
+		}
+		for i := begin; i < end; i++ {
+			m, ok := models[pks[i]]
+			if !ok {
+				result.fail(i, pks[i], &DaoError{Kind: ErrNotFound})
+				continue
+			}
+			batchRecord(ctx, dao, result, i, pks[i], func(ctx context.Context) error {
+				return fn(ctx, m)
+			})
+		}
+		return nil
+	})
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestUpdateStatusByPksSkipsDeleted(t *testing.T) {
+	newTestDb(t, new(testUser))
+	ctx := context.Background()
+	dao := &BaseDao{Model: new(testUser)}
+	alive := &testUser{Username: "alive"}
+	deleted := &testUser{Username: "deleted"}
+	for _, u := range []*testUser{alive, deleted} {
+		if err := dao.InsertContext(ctx, u, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dao.DeleteByPkContext(ctx, deleted.Id, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := UpdateStatusByPks(WithPartialBatch(ctx), dao, []int64{alive.Id, deleted.Id}, FlagNo, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Succeeded != 1 || len(result.Errors) != 1 || result.Errors[0].Pk != deleted.Id || !errors.Is(result.Errors[0].Err, ErrNotFound) {
+		t.Fatalf("unexpected result %#v", result)
+	}
+	row := new(testUser)
+	if err = DbSess().Where("id = ?", deleted.Id).First(row).Error; err != nil {
+		t.Fatal(err)
+	}
+	if row.Status != FlagYes {
+		t.Fatalf("status of deleted row changed to %q", row.Status)
+	}
+}
@@ -2,20 +2,155 @@
 
 package crud
 
-import "gorm.io/gorm"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultDbEngine 默认数据库名, InitDbEngine 注册的数据库
+const DefaultDbEngine = "default"
+
+// dbEngineGroup 一个数据库的主库与只读副本
+type dbEngineGroup struct {
+	primary  *gorm.DB
+	replicas []*gorm.DB
+	next     uint64
+}
+
+// replica 轮询取只读副本, 没有副本时返回主库
+func (group *dbEngineGroup) replica() *gorm.DB {
+	if len(group.replicas) == 0 {
+		return group.primary
+	}
+	n := atomic.AddUint64(&group.next, 1)
+	return group.replicas[n%uint64(len(group.replicas))]
+}
 
 var dbEngine *gorm.DB
 
-func InitDbEngine(engine *gorm.DB) {
-	dbEngine = engine
+var (
+	dbEngines   = make(map[string]*dbEngineGroup)
+	dbEnginesMu sync.RWMutex
+)
 
-	//初始化数据库迁移记录表
-	err := MigrateTables(engine, []interface{}{new(Migration)})
+// InitDbEngine 初始化默认数据库, replicas 为只读副本
+func InitDbEngine(engine *gorm.DB, replicas ...*gorm.DB) {
+	RegisterDbEngine(DefaultDbEngine, engine, replicas...)
+
+	//初始化数据库迁移记录表, 旧版本创建的表补充版本号、校验和等列
+	err := MigrateTables(engine, []interface{}{new(Migration)}, MigrateOptions{AddColumns: true})
 	if err != nil {
 		panic("Database init error" + err.Error())
 	}
 }
 
+// RegisterDbEngine 注册数据库, replicas 为只读副本, DAO 通过 BaseDao.Engine 选择数据库
+func RegisterDbEngine(name string, primary *gorm.DB, replicas ...*gorm.DB) {
+	name = engineName(name)
+	dbEnginesMu.Lock()
+	defer dbEnginesMu.Unlock()
+	dbEngines[name] = &dbEngineGroup{primary: primary, replicas: replicas}
+	if name == DefaultDbEngine {
+		dbEngine = primary
+	}
+}
+
+func engineName(name string) string {
+	if len(name) == 0 {
+		return DefaultDbEngine
+	}
+	return name
+}
+
+// ErrEngineNotRegistered 数据库未注册(RegisterDbEngine)
+var ErrEngineNotRegistered = errors.New("database engine is not registered")
+
+func lookUpDbEngine(name string) (*dbEngineGroup, error) {
+	dbEnginesMu.RLock()
+	defer dbEnginesMu.RUnlock()
+	group, ok := dbEngines[engineName(name)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrEngineNotRegistered, engineName(name))
+	}
+	return group, nil
+}
+
+// DbEngine 取数据库的主库, 未注册时 panic
+func DbEngine(name string) *gorm.DB {
+	group, err := lookUpDbEngine(name)
+	if err != nil {
+		panic(err.Error())
+	}
+	return group.primary
+}
+
+// errorSess 数据库未注册时返回的会话, 带有 err, 不会执行任何语句
+// 以默认数据库创建, 默认数据库也未注册时 panic
+func errorSess(ctx context.Context, err error) *gorm.DB {
+	if dbEngine == nil {
+		panic(err.Error())
+	}
+	db := dbEngine.Session(&gorm.Session{NewDB: true}).WithContext(ctx)
+	_ = db.AddError(err)
+	return db
+}
+
 func DbSess() *gorm.DB {
 	return dbEngine.Session(&gorm.Session{})
 }
+
+// DbSessContext 携带 context 的会话, ctx 中有事务(WithTx)时使用该事务
+func DbSessContext(ctx context.Context) *gorm.DB {
+	return EngineSessContext(ctx, DefaultDbEngine)
+}
+
+// EngineSessContext 指定数据库主库的会话, ctx 中有该数据库的事务(WithEngineTx)时使用该事务
+// 数据库未注册时, 会话的操作返回 ErrEngineNotRegistered
+func EngineSessContext(ctx context.Context, name string) *gorm.DB {
+	if tx, ok := EngineTxFromContext(ctx, name); ok {
+		return tx.WithContext(ctx)
+	}
+	if conn, ok := engineConnFromContext(ctx, name); ok {
+		return conn.WithContext(ctx)
+	}
+	group, err := lookUpDbEngine(name)
+	if err != nil {
+		return errorSess(ctx, err)
+	}
+	return group.primary.Session(&gorm.Session{}).WithContext(ctx)
+}
+
+// EngineReadSessContext 指定数据库的只读会话
+// 有只读副本时轮询使用副本; ctx 中有该数据库的事务或设置了 WithPrimary 时使用主库
+func EngineReadSessContext(ctx context.Context, name string) *gorm.DB {
+	if _, ok := EngineTxFromContext(ctx, name); ok || isPrimaryRead(ctx) {
+		return EngineSessContext(ctx, name)
+	}
+	if _, ok := engineConnFromContext(ctx, name); ok {
+		return EngineSessContext(ctx, name)
+	}
+	group, err := lookUpDbEngine(name)
+	if err != nil {
+		return errorSess(ctx, err)
+	}
+	return group.replica().Session(&gorm.Session{}).WithContext(ctx)
+}
+
+type primaryContextKey struct{}
+
+// WithPrimary 读操作也使用主库, 用于写入后立即读取(副本可能有延迟)
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryContextKey{}, true)
+}
+
+func isPrimaryRead(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	primary, _ := ctx.Value(primaryContextKey{}).(bool)
+	return primary
+}
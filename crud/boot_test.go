@@ -0,0 +1,86 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"testing"
+)
+
+// newReplicaEngine 注册数据库 name, 主库有 1 条记录, 两个副本分别有 2、3 条记录, 以记录数区分读取的库
+func newReplicaEngine(t *testing.T, name string) *BaseDao {
+	newTestDb(t)
+	dbs := make([]*gorm.DB, 0, 3)
+	for i := 1; i <= 3; i++ {
+		db := openTestDb(t, new(testUser))
+		for j := 0; j < i; j++ {
+			if err := db.Create(&testUser{Username: "u"}).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+		dbs = append(dbs, db)
+	}
+	RegisterDbEngine(name, dbs[0], dbs[1:]...)
+	return &BaseDao{Model: new(testUser), Engine: name}
+}
+
+func TestReplicaRoundRobin(t *testing.T) {
+	dao := newReplicaEngine(t, "replica")
+	seen := make(map[int64]int)
+	for i := 0; i < 4; i++ {
+		cnt, err := dao.CountContext(context.Background(), "1 = 1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[cnt]++
+	}
+	if seen[2] != 2 || seen[3] != 2 {
+		t.Fatalf("expected reads to alternate between replicas, got %v", seen)
+	}
+	if m, err := dao.FindByPkContext(context.Background(), 1); err != nil || m.GetId() != 1 {
+		t.Fatalf("lookup on primary: got %v, %v", m, err)
+	}
+}
+
+func TestPrimaryReads(t *testing.T) {
+	dao := newReplicaEngine(t, "replica")
+	if cnt, err := dao.CountContext(WithPrimary(context.Background()), "1 = 1"); err != nil || cnt != 1 {
+		t.Fatalf("WithPrimary: expected primary, got %d, %v", cnt, err)
+	}
+	err := WithEngineTx(context.Background(), "replica", func(ctx context.Context) error {
+		if err := dao.InsertContext(ctx, &testUser{Username: "v"}, 1); err != nil {
+			return err
+		}
+		cnt, err := dao.CountContext(ctx, "1 = 1")
+		if err == nil && cnt != 2 {
+			t.Fatalf("in transaction: expected primary with the new row, got %d", cnt)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnregisteredEngine(t *testing.T) {
+	newTestDb(t, new(testUser))
+	dao := &BaseDao{Model: new(testUser), Engine: "missing"}
+	ctx := context.Background()
+	if _, err := dao.FindByPkContext(ctx, 1); !errors.Is(err, ErrEngineNotRegistered) {
+		t.Fatalf("FindByPk: expected ErrEngineNotRegistered, got %v", err)
+	}
+	if _, err := dao.CountContext(ctx, "1 = 1"); !errors.Is(err, ErrEngineNotRegistered) {
+		t.Fatalf("Count: expected ErrEngineNotRegistered, got %v", err)
+	}
+	if err := dao.InsertContext(ctx, &testUser{Username: "a"}, 1); !errors.Is(err, ErrEngineNotRegistered) {
+		t.Fatalf("Insert: expected ErrEngineNotRegistered, got %v", err)
+	}
+	if err := InsertWithHooks(ctx, dao, &testUser{Username: "a"}, 1); !errors.Is(err, ErrEngineNotRegistered) {
+		t.Fatalf("InsertWithHooks: expected ErrEngineNotRegistered, got %v", err)
+	}
+	if cnt, _ := (&BaseDao{Model: new(testUser)}).CountContext(ctx, "1 = 1"); cnt != 0 {
+		t.Fatalf("expected nothing written to the default engine, got %d rows", cnt)
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Cache 缓存接口, 值为序列化后的数据, 可适配 redis 等远程缓存
+type Cache interface {
+	// Get 取缓存, 不存在或已过期时返回 ok=false
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set 写缓存, ttl<=0 表示不过期
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// CacheModelInterface 需要缓存的模型, CacheTTL 返回缓存时间, <=0 表示不缓存
+// 缓存 FindByPk/FindOneByColumn 的结果, Insert/Update/UpdateColumn/Delete/Remove 时自动失效; 事务中的读取不使用缓存
+type CacheModelInterface interface {
+	CacheTTL() time.Duration
+}
+
+var (
+	daoCache   Cache
+	daoCacheMu sync.RWMutex
+)
+
+// SetCache 设置 DAO 使用的缓存, nil 表示关闭缓存
+func SetCache(cache Cache) {
+	daoCacheMu.Lock()
+	defer daoCacheMu.Unlock()
+	daoCache = cache
+}
+
+func getCache() Cache {
+	daoCacheMu.RLock()
+	defer daoCacheMu.RUnlock()
+	return daoCache
+}
+
+// LruCache 进程内 LRU 缓存
+type LruCache struct {
+	capacity int
+	mu       sync.Mutex
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type lruEntry struct {
+	key      string
+	value    []byte
+	expireAt time.Time
+}
+
+// NewLruCache 创建进程内 LRU 缓存, capacity 为最多缓存的条数
+func NewLruCache(capacity int) *LruCache {
+	return &LruCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (cache *LruCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	elem, ok := cache.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*lruEntry)
+	if !entry.expireAt.IsZero() && time.Now().After(entry.expireAt) {
+		cache.remove(elem)
+		return nil, false, nil
+	}
+	cache.ll.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+func (cache *LruCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	var expireAt time.Time
+	if ttl > 0 {
+		expireAt = time.Now().Add(ttl)
+	}
+	if elem, ok := cache.items[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.value, entry.expireAt = value, expireAt
+		cache.ll.MoveToFront(elem)
+		return nil
+	}
+	cache.items[key] = cache.ll.PushFront(&lruEntry{key: key, value: value, expireAt: expireAt})
+	for cache.capacity > 0 && cache.ll.Len() > cache.capacity {
+		cache.remove(cache.ll.Back())
+	}
+	return nil
+}
+
+func (cache *LruCache) Delete(ctx context.Context, keys ...string) error {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	for _, key := range keys {
+		if elem, ok := cache.items[key]; ok {
+			cache.remove(elem)
+		}
+	}
+	return nil
+}
+
+func (cache *LruCache) remove(elem *list.Element) {
+	cache.ll.Remove(elem)
+	delete(cache.items, elem.Value.(*lruEntry).key)
+}
+
+// modelCache 模型的缓存与缓存时间, 模型未开启缓存时返回 nil
+func (dao *BaseDao) modelCache() (Cache, time.Duration) {
+	cm, ok := dao.Model.(CacheModelInterface)
+	if !ok || cm.CacheTTL() <= 0 {
+		return nil, 0
+	}
+	cache := getCache()
+	if cache == nil {
+		return nil, 0
+	}
+	return cache, cm.CacheTTL()
+}
+
+// readCache 读取时使用的缓存, 事务中或通过 WithFields 指定了字段时不使用缓存
+// 缓存中为全部列, WithDefaultFields 时读取后通过 clearUnselected 去掉未查询的字段
+func (dao *BaseDao) readCache(ctx context.Context) (Cache, time.Duration) {
+	if _, ok := EngineTxFromContext(ctx, dao.Engine); ok {
+		return nil, 0
+	}
+	if option, ok := fieldsFromContext(ctx); ok && len(option.fields) > 0 {
+		return nil, 0
+	}
+	return dao.modelCache()
+}
+
+func (dao *BaseDao) cacheKey(parts ...interface{}) string {
+	key := "g3:" + dao.GetEngine() + ":" + dao.Model.Table()
+	for _, part := range parts {
+		key += ":" + fmt.Sprint(part)
+	}
+	return key
+}
+
+// pkCacheKey 主键缓存不区分租户, 读取后校验租户
+func (dao *BaseDao) pkCacheKey(pk interface{}) string {
+	return dao.cacheKey("pk", pk)
+}
+
+// columnCacheKey 按列查询的缓存, 包含表的版本号, 表有写入时版本号变更, 旧的缓存不再使用
+func (dao *BaseDao) columnCacheKey(ctx context.Context, cache Cache, column string, value interface{}) (string, bool) {
+	tenant := "*"
+	if IsTenantModel(dao.Model) && !skipTenantScope(ctx) {
+		id, ok := TenantFromContext(ctx)
+		if !ok {
+			return "", false
+		}
+		tenant = strconv.FormatInt(id, 10)
+	}
+	gen, ok, err := cache.Get(ctx, dao.cacheKey("gen"))
+	if err != nil {
+		return "", false
+	}
+	if !ok {
+		gen = []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+		if err = cache.Set(ctx, dao.cacheKey("gen"), gen, 0); err != nil {
+			return "", false
+		}
+	}
+	return dao.cacheKey(string(gen), "col", tenant, column, value), true
+}
+
+// cacheGet 读取缓存的模型, 读取失败视为未缓存
+func (dao *BaseDao) cacheGet(ctx context.Context, cache Cache, key string) (ModelInterface, bool) {
+	data, ok, err := cache.Get(ctx, key)
+	if err != nil || !ok {
+		return nil, false
+	}
+	dst := NewModelOf(dao.Model)
+	if err = gob.NewDecoder(bytes.NewReader(data)).Decode(dst); err != nil {
+		return nil, false
+	}
+	return dst, true
+}
+
+// cacheSet 写入缓存, 写入失败时忽略
+func (dao *BaseDao) cacheSet(ctx context.Context, cache Cache, key string, m ModelInterface, ttl time.Duration) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m); err != nil {
+		return
+	}
+	_ = cache.Set(ctx, key, buf.Bytes(), ttl)
+}
+
+// checkCachedTenant 主键缓存的租户校验, 与 TenantScope 一致
+func checkCachedTenant(ctx context.Context, m ModelInterface) error {
+	tm, ok := m.(TenantModelInterface)
+	if !ok || skipTenantScope(ctx) {
+		return nil
+	}
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return ErrTenantRequired
+	}
+	if tm.GetTenantId() != tenant {
+		return &DaoError{Kind: ErrNotFound}
+	}
+	return nil
+}
+
+// invalidateCache 写入后使缓存失效: 删除主键缓存并变更表的版本号
+// 在事务中时提交后再执行一次, 避免提交前其他请求读取到旧数据并写入缓存; 缓存出错时忽略, 由过期时间兜底
+func (dao *BaseDao) invalidateCache(ctx context.Context, pks ...interface{}) {
+	cache, _ := dao.modelCache()
+	if cache == nil {
+		return
+	}
+	invalidate := func() {
+		keys := make([]string, 0, len(pks))
+		for _, pk := range pks {
+			keys = append(keys, dao.pkCacheKey(pk))
+		}
+		if len(keys) > 0 {
+			_ = cache.Delete(ctx, keys...)
+		}
+		_ = cache.Set(ctx, dao.cacheKey("gen"), []byte(strconv.FormatInt(time.Now().UnixNano(), 10)), 0)
+	}
+	invalidate()
+	afterCommit(ctx, dao.Engine, invalidate)
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// cacheUser 开启缓存的模型
+type cacheUser struct {
+	BaseModel
+	ModelFactory[cacheUser]
+	Username string `json:"username"`
+	Age      int    `json:"age"`
+	TenantColumns
+	TailColumns
+}
+
+func (*cacheUser) Table() string { return "cache_users" }
+
+func (*cacheUser) CacheTTL() time.Duration { return time.Minute }
+
+// newCacheDao 开启缓存, 返回 DAO 与语句统计
+func newCacheDao(t *testing.T) (*BaseDao, *sqlCounter) {
+	db := newTestDb(t, new(cacheUser))
+	SetCache(NewLruCache(100))
+	t.Cleanup(func() { SetCache(nil) })
+	return &BaseDao{Model: new(cacheUser)}, countSql(db)
+}
+
+func TestLruCacheEviction(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLruCache(2)
+	_ = cache.Set(ctx, "a", []byte("1"), 0)
+	_ = cache.Set(ctx, "b", []byte("2"), 0)
+	if _, ok, _ := cache.Get(ctx, "a"); !ok {
+		t.Fatal("expected a cached")
+	}
+	_ = cache.Set(ctx, "c", []byte("3"), 0)
+	if _, ok, _ := cache.Get(ctx, "b"); ok {
+		t.Fatal("expected least recently used b evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok, _ := cache.Get(ctx, key); !ok {
+			t.Fatalf("expected %s cached", key)
+		}
+	}
+}
+
+func TestLruCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLruCache(10)
+	_ = cache.Set(ctx, "short", []byte("1"), 10*time.Millisecond)
+	_ = cache.Set(ctx, "forever", []byte("2"), 0)
+	time.Sleep(20 * time.Millisecond)
+	if _, ok, _ := cache.Get(ctx, "short"); ok {
+		t.Fatal("expected expired entry to be missing")
+	}
+	if v, ok, _ := cache.Get(ctx, "forever"); !ok || string(v) != "2" {
+		t.Fatalf("expected entry without ttl, got %q, %v", v, ok)
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	ctx := WithoutTenantScope(context.Background())
+	cases := []struct {
+		name  string
+		write func(dao *BaseDao, u *cacheUser) error
+		want  int // 写入后的 age, -1 表示不存在
+	}{
+		{"Update", func(dao *BaseDao, u *cacheUser) error {
+			return dao.UpdateContext(ctx, &cacheUser{BaseModel: BaseModel{Id: u.Id}, Age: 30}, 1)
+		}, 30},
+		{"UpdateColumn", func(dao *BaseDao, u *cacheUser) error {
+			return dao.UpdateColumnContext(ctx, u.Id, "age", 31, 1)
+		}, 31},
+		{"Delete", func(dao *BaseDao, u *cacheUser) error {
+			return dao.DeleteByPkContext(ctx, u.Id, 1)
+		}, -1},
+		{"Remove", func(dao *BaseDao, u *cacheUser) error {
+			return dao.RemoveByPkContext(ctx, u.Id)
+		}, -1},
+		{"Restore", func(dao *BaseDao, u *cacheUser) error {
+			if err := DbSess().Table(u.Table()).Where("id = ?", u.Id).Updates(map[string]interface{}{"deleted": FlagYes, "age": 32}).Error; err != nil {
+				return err
+			}
+			return dao.RestoreContext(ctx, u.Id, 1)
+		}, 32},
+		{"UpdateBatch", func(dao *BaseDao, u *cacheUser) error {
+			_, err := UpdateBatch(ctx, dao, []ModelInterface{&cacheUser{BaseModel: BaseModel{Id: u.Id}, Age: 33}}, 1)
+			return err
+		}, 33},
+		{"DeleteByPks", func(dao *BaseDao, u *cacheUser) error {
+			_, err := DeleteByPks(ctx, dao, []int64{u.Id}, 1)
+			return err
+		}, -1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dao, counter := newCacheDao(t)
+			u := &cacheUser{Username: "a", Age: 20}
+			if err := dao.InsertContext(ctx, u, 1); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 2; i++ {
+				if _, err := dao.FindByPkContext(ctx, u.Id); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := dao.FindOneByColumnContext(ctx, "username", "a"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if n := counter.count("SELECT"); n != 2 {
+				t.Fatalf("expected the second reads from cache, got %d SELECT", n)
+			}
+			if err := c.write(dao, u); err != nil {
+				t.Fatal(err)
+			}
+			byPk, err := dao.FindByPkContext(ctx, u.Id)
+			if c.want < 0 {
+				if !errors.Is(err, ErrNotFound) {
+					t.Fatalf("FindByPk: expected ErrNotFound, got %v", err)
+				}
+			} else if err != nil || byPk.(*cacheUser).Age != c.want {
+				t.Fatalf("FindByPk: expected age %d, got %v, %v", c.want, byPk, err)
+			}
+			byColumn, err := dao.FindOneByColumnContext(ctx, "username", "a")
+			if c.want < 0 {
+				if !errors.Is(err, ErrNotFound) {
+					t.Fatalf("FindOneByColumn: expected ErrNotFound, got %v", err)
+				}
+			} else if err != nil || byColumn.(*cacheUser).Age != c.want {
+				t.Fatalf("FindOneByColumn: expected age %d, got %v, %v", c.want, byColumn, err)
+			}
+		})
+	}
+}
+
+func TestCacheColumnGeneration(t *testing.T) {
+	dao, _ := newCacheDao(t)
+	ctx := WithoutTenantScope(context.Background())
+	cache := getCache()
+	before, ok := dao.columnCacheKey(ctx, cache, "username", "a")
+	if !ok {
+		t.Fatal("expected column cache key")
+	}
+	if again, _ := dao.columnCacheKey(ctx, cache, "username", "a"); again != before {
+		t.Fatalf("expected stable key without writes, got %s and %s", before, again)
+	}
+	dao.invalidateCache(ctx)
+	if after, _ := dao.columnCacheKey(ctx, cache, "username", "a"); after == before {
+		t.Fatalf("expected generation bump after write, key is still %s", after)
+	}
+	if _, ok = dao.columnCacheKey(context.Background(), cache, "username", "a"); ok {
+		t.Fatal("expected no column cache key without tenant")
+	}
+}
+
+func TestCacheTenantCheck(t *testing.T) {
+	dao, counter := newCacheDao(t)
+	ctx1 := WithTenant(context.Background(), 1)
+	u := &cacheUser{Username: "a"}
+	if err := dao.InsertContext(ctx1, u, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dao.FindByPkContext(ctx1, u.Id); err != nil {
+		t.Fatal(err)
+	}
+	counter.reset()
+	if _, err := dao.FindByPkContext(WithTenant(context.Background(), 2), u.Id); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("other tenant: expected ErrNotFound, got %v", err)
+	}
+	if _, err := dao.FindByPkContext(context.Background(), u.Id); !errors.Is(err, ErrTenantRequired) {
+		t.Fatalf("no tenant: expected ErrTenantRequired, got %v", err)
+	}
+	if len(counter.statements) != 0 {
+		t.Fatalf("expected cache hits, got %v", counter.statements)
+	}
+	if m, err := dao.FindByPkContext(ctx1, u.Id); err != nil || m.(*cacheUser).Username != "a" {
+		t.Fatalf("own tenant: got %v, %v", m, err)
+	}
+}
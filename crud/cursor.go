@@ -0,0 +1,148 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"strings"
+)
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// cursorToken 游标内容: 排序规则及上一页最后一行的排序键
+type cursorToken struct {
+	Order  string            `json:"o"`
+	Values []json.RawMessage `json:"v"`
+}
+
+// orderSignature 排序规则签名, 游标只能用于生成它的排序规则
+func orderSignature(fields []OrderField) string {
+	items := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f.Desc {
+			items = append(items, "-"+f.Column())
+		} else {
+			items = append(items, f.Column())
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// cursorOrderFields 游标分页的排序字段, 末尾追加主键保证排序唯一
+func cursorOrderFields(fields []OrderField) []OrderField {
+	if len(fields) == 0 {
+		return fields
+	}
+	s := fields[0].Field.Schema
+	pk := s.PrioritizedPrimaryField
+	if pk == nil {
+		return fields
+	}
+	for _, f := range fields {
+		if f.Field == pk {
+			return fields
+		}
+	}
+	return append(append(make([]OrderField, 0, len(fields)+1), fields...), OrderField{Field: pk, Desc: fields[len(fields)-1].Desc})
+}
+
+// isNullableField 列是否可能为 NULL: 主键与标注 NOT NULL 的列不为 NULL,
+// 否则指针及 sql.NullString、gorm.DeletedAt 等实现 sql.Scanner 的结构体视为可能为 NULL
+func isNullableField(field *schema.Field) bool {
+	if field.PrimaryKey || field.NotNull {
+		return false
+	}
+	t := field.FieldType
+	if t.Kind() == reflect.Ptr {
+		return true
+	}
+	return t.Kind() == reflect.Struct && reflect.PtrTo(t).Implements(scannerType)
+}
+
+// checkCursorOrderFields 游标条件 (a > ?) OR (a = ? AND b > ?) 不能处理 NULL, 可能为 NULL 的排序字段返回 ErrValidation
+func checkCursorOrderFields(fields []OrderField) error {
+	for _, f := range fields {
+		if isNullableField(f.Field) {
+			return &DaoError{Kind: ErrValidation, Err: fmt.Errorf("order field %q is nullable and not supported by cursor pagination", JsonName(f.Field))}
+		}
+	}
+	return nil
+}
+
+// EncodeCursor 根据行生成游标
+func EncodeCursor(ctx context.Context, fields []OrderField, row reflect.Value) (string, error) {
+	for row.Kind() == reflect.Ptr || row.Kind() == reflect.Interface {
+		row = row.Elem()
+	}
+	token := cursorToken{Order: orderSignature(fields), Values: make([]json.RawMessage, 0, len(fields))}
+	for _, f := range fields {
+		value, _ := f.Field.ValueOf(ctx, row)
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		token.Values = append(token.Values, raw)
+	}
+	data, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor 解析游标, 排序规则不一致或格式错误时返回 ErrValidation
+func DecodeCursor(cursor string, fields []OrderField) ([]interface{}, error) {
+	invalid := func(err error) error {
+		return &DaoError{Kind: ErrValidation, Err: fmt.Errorf("invalid cursor: %v", err)}
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, invalid(err)
+	}
+	token := cursorToken{}
+	if err = json.Unmarshal(data, &token); err != nil {
+		return nil, invalid(err)
+	}
+	if token.Order != orderSignature(fields) || len(token.Values) != len(fields) {
+		return nil, invalid(fmt.Errorf("order mismatch"))
+	}
+	values := make([]interface{}, 0, len(fields))
+	for i, f := range fields {
+		v := reflect.New(f.Field.FieldType)
+		if err = json.Unmarshal(token.Values[i], v.Interface()); err != nil {
+			return nil, invalid(err)
+		}
+		values = append(values, v.Elem().Interface())
+	}
+	return values, nil
+}
+
+// keysetExpression 游标条件, 如 (a < ?) OR (a = ? AND b < ?), 排序字段均不为 NULL, 见 checkCursorOrderFields
+func keysetExpression(fields []OrderField, values []interface{}) clause.Expression {
+	ors := make([]clause.Expression, 0, len(fields))
+	for i, f := range fields {
+		ands := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: fields[j].Column()}, Value: values[j]})
+		}
+		column := clause.Column{Table: clause.CurrentTable, Name: f.Column()}
+		if f.Desc {
+			ands = append(ands, clause.Lt{Column: column, Value: values[i]})
+		} else {
+			ands = append(ands, clause.Gt{Column: column, Value: values[i]})
+		}
+		ors = append(ors, clause.And(ands...))
+	}
+	//gorm 将只有一个条件的 OrConditions 以 OR 连接到前面的条件
+	if len(ors) == 1 {
+		return ors[0]
+	}
+	return clause.Or(ors...)
+}
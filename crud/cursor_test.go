@@ -0,0 +1,125 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// nullableUser 排序字段可能为 NULL
+type nullableUser struct {
+	BaseModel
+	ModelFactory[nullableUser]
+	Nickname *string `json:"nickname"`
+	TailColumns
+}
+
+func (*nullableUser) Table() string { return "nullable_users" }
+
+func TestCursorEncoding(t *testing.T) {
+	fields, err := ParseOrderBy(DefaultDbEngine, new(testUser), "-age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields = cursorOrderFields(fields)
+	cursor, err := EncodeCursor(context.Background(), fields, reflect.ValueOf(&testUser{BaseModel: BaseModel{Id: 7}, Age: 30}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := DecodeCursor(cursor, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, []interface{}{30, int64(7)}) {
+		t.Fatalf("unexpected values %#v", values)
+	}
+
+	other, _ := ParseOrderBy(DefaultDbEngine, new(testUser), "age")
+	cases := []struct {
+		name   string
+		cursor string
+		fields []OrderField
+	}{
+		{"order mismatch", cursor, cursorOrderFields(other)},
+		{"bad base64", "!!!", fields},
+		{"bad json", "bm90IGpzb24", fields},
+		{"value count", "eyJvIjoiLWFnZSwtaWQiLCJ2IjpbMzBdfQ", fields},
+		{"value type", "eyJvIjoiLWFnZSwtaWQiLCJ2IjpbIngiLDddfQ", fields},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := DecodeCursor(c.cursor, c.fields); !errors.Is(err, ErrValidation) {
+				t.Fatalf("expected validation error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCursorPagination(t *testing.T) {
+	newTestDb(t, new(testUser))
+	dao := &BaseDao{Model: new(testUser)}
+	ctx := context.Background()
+	for i := 0; i < 7; i++ {
+		//排序键重复, 依靠主键区分
+		if err := dao.InsertContext(ctx, &testUser{Username: "u", Age: i / 3}, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, orderBy := range []string{"age", "-age"} {
+		t.Run(orderBy, func(t *testing.T) {
+			params := &BaseQueryParams{PageSize: 2, PageMode: PageModeCursor, OrderBy: orderBy}
+			seen := make(map[int64]bool)
+			lastAge := -1
+			if orderBy == "-age" {
+				lastAge = 100
+			}
+			for page := 0; ; page++ {
+				if page > 7 {
+					t.Fatal("pagination does not terminate")
+				}
+				rows, pageData, err := dao.FindPageContext(ctx, new(testUser), params)
+				if err != nil {
+					t.Fatal(err)
+				}
+				users, err := asModels[*testUser](rows, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, u := range users {
+					if seen[u.Id] {
+						t.Fatalf("row %d returned twice", u.Id)
+					}
+					seen[u.Id] = true
+					if (orderBy == "age" && u.Age < lastAge) || (orderBy == "-age" && u.Age > lastAge) {
+						t.Fatalf("row %d out of order", u.Id)
+					}
+					lastAge = u.Age
+				}
+				if !pageData.HasMore {
+					break
+				}
+				params.Cursor = pageData.NextCursor
+			}
+			if len(seen) != 7 {
+				t.Fatalf("expected 7 rows, got %d", len(seen))
+			}
+		})
+	}
+}
+
+func TestCursorNullableOrder(t *testing.T) {
+	newTestDb(t, new(nullableUser))
+	dao := &BaseDao{Model: new(nullableUser)}
+	params := &BaseQueryParams{PageSize: 2, PageMode: PageModeCursor, OrderBy: "nickname"}
+	if _, _, err := dao.FindPageContext(context.Background(), new(nullableUser), params); !errors.Is(err, ErrValidation) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	//offset 分页不受影响
+	params.PageMode = PageModeOffset
+	if _, _, err := dao.FindPageContext(context.Background(), new(nullableUser), params); err != nil {
+		t.Fatal(err)
+	}
+}
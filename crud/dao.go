@@ -2,6 +2,62 @@
 
 package crud
 
+import (
+	"context"
+	"gorm.io/gorm"
+	"reflect"
+	"time"
+)
+
+// DAOContextInterface 携带 context 并返回 error 的 DAO
+// 错误可通过 errors.Is 判断 ErrNotFound / ErrConflict / ErrValidation, 原始错误可通过 errors.As 获取
+type DAOContextInterface interface {
+	GetModel() ModelInterface
+	// GetEngine 数据库名
+	GetEngine() string
+	// InsertContext 插入
+	InsertContext(ctx context.Context, m ModelInterface, operator int64) error
+	// UpdateContext 更新
+	UpdateContext(ctx context.Context, m ModelInterface, operator int64) error
+	// UpdateColumnContext 更新
+	UpdateColumnContext(ctx context.Context, pk interface{}, column string, v interface{}, operator int64) error
+	// UpdateStatusContext 更新
+	UpdateStatusContext(ctx context.Context, pk int64, status interface{}, operator int64) error
+	// DeleteContext 删除
+	DeleteContext(ctx context.Context, m ModelInterface, operator int64) error
+	// DeleteByPkContext 逻辑删除
+	DeleteByPkContext(ctx context.Context, pk interface{}, operator int64) error
+	// RemoveContext 删除
+	RemoveContext(ctx context.Context, m ModelInterface, operator int64) error
+	// RemoveByPkContext 物理删除
+	RemoveByPkContext(ctx context.Context, pk interface{}) error
+	FindByPkContext(ctx context.Context, pk interface{}) (ModelInterface, error)
+	FindOneByColumnContext(ctx context.Context, column string, value interface{}) (ModelInterface, error)
+	// FindOneByColumnsContext 根据多列查询
+	FindOneByColumnsContext(ctx context.Context, columns map[string]interface{}) (ModelInterface, error)
+	// FindByPksContext 根据主键批量查询
+	FindByPksContext(ctx context.Context, pks []int64) (interface{}, error)
+	CountContext(ctx context.Context, query interface{}, args ...interface{}) (int64, error)
+	CountByPkContext(ctx context.Context, pk interface{}) (int64, error)
+	CountByColumnContext(ctx context.Context, column string, value interface{}) (int64, error)
+	FindPageContext(ctx context.Context, modelParams ModelInterface, baseParams *BaseQueryParams) (interface{}, PageData, error)
+	FindListContext(ctx context.Context, modelParams ModelInterface, baseParams *BaseQueryParams) (interface{}, error)
+	FindAllContext(ctx context.Context, modelParams ModelInterface, baseParams *BaseQueryParams) (interface{}, error)
+	FindListByColumnContext(ctx context.Context, column string, value interface{}) (interface{}, error)
+	// RestoreContext 恢复逻辑删除的数据
+	RestoreContext(ctx context.Context, pk interface{}, operator int64) error
+	// FindDeletedContext 查询已逻辑删除的数据
+	FindDeletedContext(ctx context.Context, modelParams ModelInterface, baseParams *BaseQueryParams) (interface{}, PageData, error)
+	// PurgeDeletedContext 物理删除逻辑删除超过 olderThan 的数据
+	PurgeDeletedContext(ctx context.Context, olderThan time.Duration) (int64, error)
+	// AggregateContext 聚合统计, 见 AggregateParams
+	AggregateContext(ctx context.Context, modelParams ModelInterface, baseParams *BaseQueryParams, params *AggregateParams) ([]AggregateRow, error)
+	// ExportContext 分批查询导出的数据
+	ExportContext(ctx context.Context, modelParams ModelInterface, baseParams *BaseQueryParams, fn func(rows interface{}) error) error
+}
+
+// DAOInterface 旧版 DAO, context 版本见 DAOContextInterface, BaseDao 同时实现两者
+// 只实现本接口的 DAO 通过 ContextDao 包装后使用
 type DAOInterface interface {
 	GetModel() ModelInterface
 	NewWrapper(modelParams ModelInterface, baseParams *BaseQueryParams) QueryWrapperInterface
@@ -32,6 +88,7 @@ type DAOInterface interface {
 	FindListByColumn(column string, value interface{}) interface{}
 	// AfterGet AfterGet
 	AfterGet(m ModelInterface)
+	// 以下钩子没有 ctx, 在其中通过 HookSess(m) 的写入参与 *WithHooks 的事务, 也可实现 BeforeInsertContextHook 等接口
 	// BeforeInsert 插入之前
 	BeforeInsert(m ModelInterface) (ok bool, msg string)
 	// AfterInsert 插入之后
@@ -51,7 +108,8 @@ type DAOInterface interface {
 }
 
 type BaseDao struct {
-	Model ModelInterface
+	Model  ModelInterface
+	Engine string // 数据库名(RegisterDbEngine), 为空时为默认数据库
 }
 
 // GetModel 取模型
@@ -59,31 +117,130 @@ func (dao *BaseDao) GetModel() ModelInterface {
 	return dao.Model
 }
 
+// GetEngine 取数据库名
+func (dao *BaseDao) GetEngine() string {
+	return engineName(dao.Engine)
+}
+
 // NewWrapper 取模型
 func (dao *BaseDao) NewWrapper(modelParams ModelInterface, baseParams *BaseQueryParams) QueryWrapperInterface {
+	return dao.newWrapper(modelParams, baseParams)
+}
+
+func (dao *BaseDao) newWrapper(modelParams ModelInterface, baseParams *BaseQueryParams) *BaseQueryWrapper {
+	if modelParams == nil || reflect.ValueOf(modelParams).IsNil() {
+		modelParams = dao.Model
+	}
 	return &BaseQueryWrapper{
 		ModelParams: modelParams,
 		BaseParams:  baseParams,
+		Engine:      dao.Engine,
 	}
 }
 
+// sess DAO 操作使用的会话(主库), 已附加租户过滤
+func (dao *BaseDao) sess(ctx context.Context) *gorm.DB {
+	return EngineSessContext(ctx, dao.Engine).Scopes(TenantScope(ctx, dao.Model)).Session(&gorm.Session{})
+}
+
+// readSess 列表查询与统计使用的会话, 有只读副本时使用副本, 见 EngineReadSessContext
+func (dao *BaseDao) readSess(ctx context.Context) *gorm.DB {
+	return EngineReadSessContext(ctx, dao.Engine).Scopes(TenantScope(ctx, dao.Model)).Session(&gorm.Session{})
+}
+
 // Insert 插入数据
 func (dao *BaseDao) Insert(m ModelInterface, operator int64) bool {
+	return dao.InsertContext(context.Background(), m, operator) == nil
+}
+
+// InsertContext 插入数据
+func (dao *BaseDao) InsertContext(ctx context.Context, m ModelInterface, operator int64) error {
 	m.SetCreatedBy(operator)
 	m.SetUpdatedBy(operator)
-	if DbSess().Create(m).Error == nil {
-		return true
+	if err := fillTenant(ctx, m); err != nil {
+		return err
+	}
+	return dao.auditTx(ctx, func(ctx context.Context) error {
+		if err := dao.sess(ctx).Create(m).Error; err != nil {
+			return wrapDbError(err)
+		}
+		return auditInsert(ctx, dao.Engine, dao.Model, m, operator)
+	})
+}
+
+// auditTx 开启审计时在 DAO 所在数据库的事务中执行 fn, 变更前快照、变更与审计写入在同一事务中, 审计写入失败时回滚变更
+func (dao *BaseDao) auditTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !auditEnabled(dao.Model) {
+		return fn(ctx)
+	}
+	return WithEngineTx(ctx, dao.Engine, fn)
+}
+
+// findForAudit 审计时查询变更前后的数据, 不过滤逻辑删除
+func (dao *BaseDao) findForAudit(ctx context.Context, pk interface{}) (ModelInterface, map[string]interface{}, error) {
+	dst := NewModelOf(dao.Model)
+	if err := dao.sess(ctx).Where("id = ?", pk).First(dst).Error; err != nil {
+		return nil, nil, wrapDbError(err)
 	}
-	return false
+	values, err := auditValues(ctx, dao.Engine, dst)
+	return dst, values, err
+}
+
+// auditChange 记录按主键的变更, 返回在变更之后调用的函数, 需在 auditTx 中调用
+func (dao *BaseDao) auditChange(ctx context.Context, pk interface{}, operator int64, action string) (ModelInterface, func() error, error) {
+	if !auditEnabled(dao.Model) {
+		return nil, func() error { return nil }, nil
+	}
+	last, before, err := dao.findForAudit(ctx, pk)
+	if err != nil {
+		return nil, nil, err
+	}
+	return last, func() error {
+		var after map[string]interface{}
+		if action != AuditRemove {
+			if _, after, err = dao.findForAudit(ctx, pk); err != nil {
+				return err
+			}
+		}
+		return writeAudit(ctx, dao.Engine, dao.Model, action, pk, operator, auditDiff(before, after))
+	}, nil
 }
 
 // Update 更新数据
 func (dao *BaseDao) Update(m ModelInterface, operator int64) bool {
+	return dao.UpdateContext(context.Background(), m, operator) == nil
+}
+
+// UpdateContext 更新数据, 记录不存在或已逻辑删除时返回 ErrNotFound
+// 乐观锁模型以 m 的版本号作为条件并递增, 版本不一致时返回 ErrVersionConflict
+func (dao *BaseDao) UpdateContext(ctx context.Context, m ModelInterface, operator int64) error {
 	m.SetUpdatedBy(operator)
+	return dao.auditTx(ctx, func(ctx context.Context) error {
+		return dao.update(ctx, m, operator)
+	})
+}
+
+// update 见 UpdateContext
+func (dao *BaseDao) update(ctx context.Context, m ModelInterface, operator int64) error {
+	last, audit, err := dao.auditChange(ctx, m.GetId(), operator, AuditUpdate)
+	if err != nil {
+		return err
+	}
+	if last != nil {
+		m.SetLastModel(last)
+	}
 
-	sess := DbSess()
+	sess := dao.sess(ctx).Where("deleted = ?", FlagNo)
 
 	updateCols := m.GetUpdateColumns()
+	vm, versioned := m.(VersionModelInterface)
+	if versioned {
+		sess = versionWhere(sess, vm.GetVersion())
+		vm.SetVersion(vm.GetVersion() + 1)
+		if updateCols != nil && len(updateCols) > 0 {
+			updateCols = append(append(make([]string, 0, len(updateCols)+1), updateCols...), VersionColumn)
+		}
+	}
 	if updateCols != nil && len(updateCols) > 0 {
 		sess = sess.Select(updateCols)
 	}
@@ -93,51 +250,177 @@ func (dao *BaseDao) Update(m ModelInterface, operator int64) bool {
 		sess = sess.Omit(omitCols...)
 	}
 
-	if sess.Updates(m).Error == nil {
-		return true
+	result := sess.Updates(m)
+	err = wrapDbError(result.Error)
+	if err == nil && result.RowsAffected == 0 {
+		err = dao.notFoundOrConflict(ctx, m.GetId(), FlagNo, versioned)
+	}
+	if err == nil {
+		dao.invalidateCache(ctx, m.GetId())
+		err = audit()
+	}
+	if err != nil && versioned {
+		vm.SetVersion(vm.GetVersion() - 1)
+	}
+	return err
+}
+
+// notFoundOrConflict 更新影响行数为0时, 区分记录不存在与版本冲突, deleted 为更新的删除标识条件
+func (dao *BaseDao) notFoundOrConflict(ctx context.Context, pk interface{}, deleted string, versioned bool) error {
+	if versioned {
+		var cnt int64
+		if err := dao.sess(ctx).Table(dao.Model.Table()).Where("id = ? AND deleted = ?", pk, deleted).Count(&cnt).Error; err != nil {
+			return wrapDbError(err)
+		}
+		if cnt > 0 {
+			return &DaoError{Kind: ErrVersionConflict}
+		}
 	}
-	return false
+	return &DaoError{Kind: ErrNotFound}
 }
 
 func (dao *BaseDao) Delete(m ModelInterface, operator int64) bool {
-	return dao.DeleteByPk(m.GetId(), operator)
+	return dao.DeleteContext(context.Background(), m, operator) == nil
+}
+
+func (dao *BaseDao) DeleteContext(ctx context.Context, m ModelInterface, operator int64) error {
+	return dao.DeleteByPkContext(ctx, m.GetId(), operator)
 }
 
 // DeleteByPk 删除数据(逻辑)
 func (dao *BaseDao) DeleteByPk(pk interface{}, operator int64) bool {
-	return dao.UpdateColumn(pk, "deleted", FlagYes, operator)
+	return dao.DeleteByPkContext(context.Background(), pk, operator) == nil
+}
+
+// DeleteByPkContext 删除数据(逻辑), 实现 DeletedModelInterface 的模型同时记录删除人与删除时间
+func (dao *BaseDao) DeleteByPkContext(ctx context.Context, pk interface{}, operator int64) error {
+	return dao.updateColumns(ctx, pk, deleteColumns(dao.Model, operator), operator, AuditDelete)
 }
 
 func (dao *BaseDao) Remove(m ModelInterface, operator int64) bool {
-	return dao.RemoveByPk(m.GetId())
+	return dao.RemoveContext(context.Background(), m, operator) == nil
+}
+
+func (dao *BaseDao) RemoveContext(ctx context.Context, m ModelInterface, operator int64) error {
+	return dao.RemoveByPkContext(ctx, m.GetId())
 }
 
 // RemoveByPk 删除数据(物理)
 func (dao *BaseDao) RemoveByPk(pk interface{}) bool {
-	if DbSess().Table(dao.Model.Table()).Delete("id = ?", pk).Error == nil {
-		return true
-	}
-	return false
+	return dao.RemoveByPkContext(context.Background(), pk) == nil
 }
 
-// FindByPk 根据主键查询
+// RemoveByPkContext 删除数据(物理), 记录不存在时返回 ErrNotFound
+// 操作人通过 WithOperator 设置
+func (dao *BaseDao) RemoveByPkContext(ctx context.Context, pk interface{}) error {
+	return dao.auditTx(ctx, func(ctx context.Context) error {
+		_, audit, err := dao.auditChange(ctx, pk, 0, AuditRemove)
+		if err != nil {
+			return err
+		}
+		result := dao.sess(ctx).Table(dao.Model.Table()).Where("id = ?", pk).Delete(NewModelOf(dao.Model))
+		if result.Error != nil {
+			return wrapDbError(result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return &DaoError{Kind: ErrNotFound}
+		}
+		dao.invalidateCache(ctx, pk)
+		return audit()
+	})
+}
+
+// FindByPk 根据主键查询, 记录不存在或查询出错时返回 nil, 需区分时使用 FindByPkContext
 func (dao *BaseDao) FindByPk(pk interface{}) ModelInterface {
-	if dao.CountByPk(pk) == 0 {
+	m, err := dao.FindByPkContext(context.Background(), pk)
+	if err != nil {
 		return nil
 	}
-	dst := dao.Model.NewModel()
-	DbSess().Where("id = ?", pk).First(dst)
-	return dst
+	return m
+}
+
+// FindByPkContext 根据主键查询, 记录不存在时返回 ErrNotFound
+// 模型实现 CacheModelInterface 且设置了 SetCache 时使用缓存
+// 默认查询全部列(含敏感列); 返回给前端时通过 WithDefaultFields 或 WithFields 指定查询的列, 见 SelectFields
+func (dao *BaseDao) FindByPkContext(ctx context.Context, pk interface{}) (ModelInterface, error) {
+	cache, ttl := dao.readCache(ctx)
+	if cache != nil {
+		if m, ok := dao.cacheGet(ctx, cache, dao.pkCacheKey(pk)); ok {
+			if err := checkCachedTenant(ctx, m); err != nil {
+				return nil, err
+			}
+			return m, clearUnselected(ctx, dao.Engine, m)
+		}
+	}
+	dst := NewModelOf(dao.Model)
+	if err := dao.lookupSess(ctx, cache).Where("id = ? and deleted = ?", pk, FlagNo).First(dst).Error; err != nil {
+		return nil, wrapDbError(err)
+	}
+	if cache != nil {
+		dao.cacheSet(ctx, cache, dao.pkCacheKey(pk), dst, ttl)
+		return dst, clearUnselected(ctx, dao.Engine, dst)
+	}
+	return dst, nil
+}
+
+// lookupSess 单条查询的会话, 查询的列见 lookupFieldsScope; 使用缓存时查询全部列以便写入缓存
+func (dao *BaseDao) lookupSess(ctx context.Context, cache Cache) *gorm.DB {
+	if cache != nil {
+		return dao.sess(ctx)
+	}
+	return dao.sess(ctx).Scopes(lookupFieldsScope(dao.Engine, dao.Model))
 }
 
-// FindOneByColumn 根据某列查询
+// FindOneByColumnsContext 根据多列(列名 => 值)查询, 记录不存在时返回 ErrNotFound, 查询的列同 FindByPkContext
+func (dao *BaseDao) FindOneByColumnsContext(ctx context.Context, columns map[string]interface{}) (ModelInterface, error) {
+	dst := NewModelOf(dao.Model)
+	if err := dao.lookupSess(ctx, nil).Where(columns).Where("deleted = ?", FlagNo).First(dst).Error; err != nil {
+		return nil, wrapDbError(err)
+	}
+	return dst, nil
+}
+
+// FindByPksContext 根据主键批量查询, 不包含已删除的数据, 查询的列同 FindByPkContext
+func (dao *BaseDao) FindByPksContext(ctx context.Context, pks []int64) (interface{}, error) {
+	rows := NewModelsOf(dao.Model)
+	if len(pks) == 0 {
+		return rows, nil
+	}
+	err := dao.lookupSess(ctx, nil).Where("id IN ? and deleted = ?", pks, FlagNo).Find(&rows).Error
+	return rows, wrapDbError(err)
+}
+
+// FindOneByColumn 根据某列查询, 记录不存在或查询出错时返回 nil, 需区分时使用 FindOneByColumnContext
 func (dao *BaseDao) FindOneByColumn(column string, value interface{}) ModelInterface {
-	if dao.CountByColumn(column, value) == 0 {
+	m, err := dao.FindOneByColumnContext(context.Background(), column, value)
+	if err != nil {
 		return nil
 	}
-	dst := dao.Model.NewModel()
-	DbSess().Where(column+" = ? and deleted = ?", value, FlagNo).First(dst)
-	return dst
+	return m
+}
+
+// FindOneByColumnContext 根据某列查询, 记录不存在时返回 ErrNotFound
+// 模型实现 CacheModelInterface 且设置了 SetCache 时使用缓存; 查询的列同 FindByPkContext
+func (dao *BaseDao) FindOneByColumnContext(ctx context.Context, column string, value interface{}) (ModelInterface, error) {
+	cache, ttl := dao.readCache(ctx)
+	key := ""
+	if cache != nil {
+		var ok bool
+		if key, ok = dao.columnCacheKey(ctx, cache, column, value); !ok {
+			cache = nil
+		} else if m, ok := dao.cacheGet(ctx, cache, key); ok {
+			return m, clearUnselected(ctx, dao.Engine, m)
+		}
+	}
+	dst := NewModelOf(dao.Model)
+	if err := dao.lookupSess(ctx, cache).Where(column+" = ? and deleted = ?", value, FlagNo).First(dst).Error; err != nil {
+		return nil, wrapDbError(err)
+	}
+	if cache != nil {
+		dao.cacheSet(ctx, cache, key, dst, ttl)
+		return dst, clearUnselected(ctx, dao.Engine, dst)
+	}
+	return dst, nil
 }
 
 // CountByPk 根据主键查询数量
@@ -145,74 +428,222 @@ func (dao *BaseDao) CountByPk(pk interface{}) int64 {
 	return dao.Count("id = ?", pk)
 }
 
+// CountByPkContext 根据主键查询数量
+func (dao *BaseDao) CountByPkContext(ctx context.Context, pk interface{}) (int64, error) {
+	return dao.CountContext(ctx, "id = ?", pk)
+}
+
 // CountByColumn 根据某列查询数量
 func (dao *BaseDao) CountByColumn(column string, value interface{}) int64 {
 	return dao.Count(column+" = ?", value)
 }
 
+// CountByColumnContext 根据某列查询数量
+func (dao *BaseDao) CountByColumnContext(ctx context.Context, column string, value interface{}) (int64, error) {
+	return dao.CountContext(ctx, column+" = ?", value)
+}
+
 // Count 查询数量
 func (dao *BaseDao) Count(query interface{}, args ...interface{}) int64 {
-	var cnt int64
-	DbSess().Table(dao.Model.Table()).Where(query, args...).Where("deleted = ?", FlagNo).Count(&cnt)
+	cnt, _ := dao.CountContext(context.Background(), query, args...)
 	return cnt
 }
 
+// CountContext 查询数量, 有只读副本时使用副本
+func (dao *BaseDao) CountContext(ctx context.Context, query interface{}, args ...interface{}) (int64, error) {
+	var cnt int64
+	err := dao.readSess(ctx).Table(dao.Model.Table()).Where(query, args...).Where("deleted = ?", FlagNo).Count(&cnt).Error
+	return cnt, wrapDbError(err)
+}
+
 // UpdateColumn 更新字段
 func (dao *BaseDao) UpdateColumn(pk interface{}, column string, v interface{}, operator int64) bool {
-	if DbSess().Table(dao.Model.Table()).Where("id = ?", pk).Updates(map[string]interface{}{
-		column:       v,
+	return dao.UpdateColumnContext(context.Background(), pk, column, v, operator) == nil
+}
+
+// UpdateColumnContext 更新字段, 记录不存在或已逻辑删除时返回 ErrNotFound
+// 乐观锁模型递增版本号, ctx 中有 WithVersion 时以其作为条件, 不一致时返回 ErrVersionConflict
+func (dao *BaseDao) UpdateColumnContext(ctx context.Context, pk interface{}, column string, v interface{}, operator int64) error {
+	return dao.updateColumns(ctx, pk, map[string]interface{}{column: v}, operator, AuditUpdate)
+}
+
+// updateColumns 按主键更新未删除记录的多列, action 为审计动作, 恢复(AuditRestore)时更新已删除的记录
+func (dao *BaseDao) updateColumns(ctx context.Context, pk interface{}, columns map[string]interface{}, operator int64, action string) error {
+	return dao.auditTx(ctx, func(ctx context.Context) error {
+		return dao.updateColumnsTx(ctx, pk, columns, operator, action)
+	})
+}
+
+// updateColumnsTx 见 updateColumns
+func (dao *BaseDao) updateColumnsTx(ctx context.Context, pk interface{}, columns map[string]interface{}, operator int64, action string) error {
+	deleted := FlagNo
+	if action == AuditRestore {
+		deleted = FlagYes
+	}
+	_, audit, err := dao.auditChange(ctx, pk, operator, action)
+	if err != nil {
+		return err
+	}
+	values := map[string]interface{}{
 		"updated_by": operator,
-	}).Error != nil {
-		return false
+		"updated_at": time.Now(),
 	}
-	return true
+	for column, v := range columns {
+		values[column] = v
+	}
+	sess := dao.sess(ctx).Table(dao.Model.Table()).Where("id = ? AND deleted = ?", pk, deleted)
+	versioned := IsVersionModel(dao.Model)
+	if versioned {
+		values[VersionColumn] = gorm.Expr(VersionColumn + " + 1")
+		if version, ok := VersionFromContext(ctx); ok {
+			sess = versionWhere(sess, version)
+		}
+	}
+	result := sess.Updates(values)
+	if result.Error != nil {
+		return wrapDbError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return dao.notFoundOrConflict(ctx, pk, deleted, versioned)
+	}
+	dao.invalidateCache(ctx, pk)
+	return audit()
 }
 
 // UpdateStatus 更新状态
 func (dao *BaseDao) UpdateStatus(pk int64, status interface{}, operator int64) bool {
-	return dao.UpdateColumn(pk, "status", status, operator)
+	return dao.UpdateStatusContext(context.Background(), pk, status, operator) == nil
+}
+
+// UpdateStatusContext 更新状态
+func (dao *BaseDao) UpdateStatusContext(ctx context.Context, pk int64, status interface{}, operator int64) error {
+	return dao.UpdateColumnContext(ctx, pk, "status", status, operator)
 }
 
 // FindPage 查询
 func (dao *BaseDao) FindPage(modelParams ModelInterface, baseParams *BaseQueryParams) (interface{}, PageData) {
-	rows := dao.Model.NewModels()
-	var total int64
-	db := DbSess()
-	wrapper := dao.NewWrapper(modelParams, baseParams)
-	db.Scopes(wrapper.QueryScope()).Table(dao.Model.Table()).Count(&total)
-	db.Scopes(wrapper.QueryScope(), wrapper.PageScope()).Find(&rows)
-	return rows, wrapper.PageResult(total)
+	rows, pageData, _ := dao.FindPageContext(context.Background(), modelParams, baseParams)
+	return rows, pageData
+}
+
+// FindPageContext 查询, 有只读副本时使用副本
+// 支持 OFFSET 分页与游标分页(BaseQueryParams.PageMode/Cursor), 总数统计方式见 BaseQueryParams.CountMode
+func (dao *BaseDao) FindPageContext(ctx context.Context, modelParams ModelInterface, baseParams *BaseQueryParams) (interface{}, PageData, error) {
+	return dao.findPage(ctx, dao.newWrapper(modelParams, baseParams))
+}
+
+// findPage 分页查询
+func (dao *BaseDao) findPage(ctx context.Context, wrapper *BaseQueryWrapper) (interface{}, PageData, error) {
+	rows := NewModelsOf(dao.Model)
+	db := dao.readSess(ctx)
+	total := int64(TotalUnknown)
+	switch wrapper.CountMode() {
+	case CountNone:
+	case CountEstimate:
+		//估算的是整表行数, 租户模型或有查询条件时使用 COUNT(*)
+		if !IsTenantModel(dao.Model) && !wrapper.hasConditions(db) {
+			if cnt, ok := estimateCount(db, dao.Model.Table()); ok {
+				total = cnt
+				break
+			}
+		}
+		fallthrough
+	default:
+		if err := db.Scopes(wrapper.QueryScope()).Table(dao.Model.Table()).Count(&total).Error; err != nil {
+			return rows, wrapper.PageResult(0), wrapDbError(err)
+		}
+	}
+	//多取一行判断是否还有下一页
+	rows, err := findRows(db.Scopes(wrapper.QueryScope(), wrapper.SelectScope(), wrapper.IncludeScope(), wrapper.pageScope(1)), rows)
+	if err != nil {
+		return rows, wrapper.PageResult(total), wrapDbError(err)
+	}
+	pageData := wrapper.PageResult(total)
+	_, pageSize := wrapper.pageParams()
+	var hasMore bool
+	rows, hasMore = truncateRows(rows, pageSize)
+	pageData.HasMore = hasMore
+	if wrapper.IsCursor() && hasMore {
+		fields, err := wrapper.CursorOrderFields()
+		if err != nil {
+			return rows, pageData, err
+		}
+		v := reflect.Indirect(reflect.ValueOf(rows))
+		if pageData.NextCursor, err = EncodeCursor(ctx, fields, v.Index(v.Len()-1)); err != nil {
+			return rows, pageData, err
+		}
+	}
+	return rows, pageData, nil
+}
+
+// findRows 查询到 rows(NewModelsOf 的结果), 以切片指针传给 gorm, Preload 不支持 *interface{}
+func findRows(db *gorm.DB, rows interface{}) (interface{}, error) {
+	if reflect.ValueOf(rows).Kind() == reflect.Ptr {
+		return rows, db.Find(rows).Error
+	}
+	ptr := reflect.New(reflect.TypeOf(rows))
+	ptr.Elem().Set(reflect.ValueOf(rows))
+	err := db.Find(ptr.Interface()).Error
+	return ptr.Elem().Interface(), err
+}
+
+// truncateRows 将结果截取为 size 行, 返回是否有多余的行
+func truncateRows(rows interface{}, size int) (interface{}, bool) {
+	v := reflect.ValueOf(rows)
+	if v.Kind() == reflect.Ptr {
+		if v.Elem().Len() <= size {
+			return rows, false
+		}
+		v.Elem().Set(v.Elem().Slice(0, size))
+		return rows, true
+	}
+	if v.Len() <= size {
+		return rows, false
+	}
+	return v.Slice(0, size).Interface(), true
 }
 
 // FindList 查询
 func (dao *BaseDao) FindList(modelParams ModelInterface, baseParams *BaseQueryParams) interface{} {
-	rows := dao.Model.NewModels()
-	wrapper := dao.NewWrapper(modelParams, baseParams)
-	DbSess().Scopes(wrapper.QueryScope(), wrapper.PageScope()).Find(&rows)
+	rows, _ := dao.FindListContext(context.Background(), modelParams, baseParams)
 	return rows
 }
 
+// FindListContext 查询, 有只读副本时使用副本
+func (dao *BaseDao) FindListContext(ctx context.Context, modelParams ModelInterface, baseParams *BaseQueryParams) (interface{}, error) {
+	rows := NewModelsOf(dao.Model)
+	wrapper := dao.newWrapper(modelParams, baseParams)
+	rows, err := findRows(dao.readSess(ctx).Scopes(wrapper.QueryScope(), wrapper.SelectScope(), wrapper.IncludeScope(), wrapper.PageScope()), rows)
+	return rows, wrapDbError(err)
+}
+
 // FindAll 查询
 func (dao *BaseDao) FindAll(modelParams ModelInterface, baseParams *BaseQueryParams) interface{} {
-	rows := dao.Model.NewModels()
-	wrapper := dao.NewWrapper(modelParams, baseParams)
-	db := DbSess().Scopes(wrapper.QueryScope())
-	if baseParams != nil && len(baseParams.OrderBy) > 0 {
-		db.Order(baseParams.OrderBy)
-	} else {
-		db.Order("id DESC")
-	}
-	db.Find(&rows)
+	rows, _ := dao.FindAllContext(context.Background(), modelParams, baseParams)
 	return rows
 }
 
+// FindAllContext 查询, 有只读副本时使用副本
+func (dao *BaseDao) FindAllContext(ctx context.Context, modelParams ModelInterface, baseParams *BaseQueryParams) (interface{}, error) {
+	rows := NewModelsOf(dao.Model)
+	wrapper := dao.newWrapper(modelParams, baseParams)
+	rows, err := findRows(dao.readSess(ctx).Scopes(wrapper.QueryScope(), wrapper.SelectScope(), wrapper.IncludeScope(), wrapper.OrderScope()), rows)
+	return rows, wrapDbError(err)
+}
+
 // FindListByColumn 查询
 func (dao *BaseDao) FindListByColumn(column string, value interface{}) interface{} {
-	rows := dao.Model.NewModels()
-	DbSess().Where(column+" = ?", value).Find(&rows)
+	rows, _ := dao.FindListByColumnContext(context.Background(), column, value)
 	return rows
 }
 
+// FindListByColumnContext 查询, 不包含已删除的数据, 有只读副本时使用副本, 查询的列同 FindByPkContext
+func (dao *BaseDao) FindListByColumnContext(ctx context.Context, column string, value interface{}) (interface{}, error) {
+	rows := NewModelsOf(dao.Model)
+	err := dao.readSess(ctx).Scopes(lookupFieldsScope(dao.Engine, dao.Model)).Where(column+" = ? and deleted = ?", value, FlagNo).Find(&rows).Error
+	return rows, wrapDbError(err)
+}
+
 func (dao *BaseDao) AfterGet(m ModelInterface) {
 
 }
@@ -0,0 +1,199 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// lookupCases 单条查询的路径, 与 net.BaseApi 的 HandleGet/HandleDelete/HandleRemove 一致
+var lookupCases = []struct {
+	name   string
+	lookup func(ctx context.Context, dao *BaseDao, pk int64) error
+}{
+	{"FindByPk", func(ctx context.Context, dao *BaseDao, pk int64) error {
+		if dao.FindByPk(pk) == nil {
+			return &DaoError{Kind: ErrNotFound}
+		}
+		return nil
+	}},
+	{"FindByPkContext", func(ctx context.Context, dao *BaseDao, pk int64) error {
+		_, err := dao.FindByPkContext(ctx, pk)
+		return err
+	}},
+	{"HandleGet", func(ctx context.Context, dao *BaseDao, pk int64) error {
+		_, err := dao.FindByPkContext(WithFields(ctx, "id,username"), pk)
+		return err
+	}},
+	{"HandleDelete", func(ctx context.Context, dao *BaseDao, pk int64) error {
+		m, err := dao.FindByPkContext(ctx, pk)
+		if err != nil {
+			return err
+		}
+		return DeleteWithHooks(ctx, dao, m, 1)
+	}},
+	{"HandleRemove", func(ctx context.Context, dao *BaseDao, pk int64) error {
+		m, err := dao.FindByPkContext(ctx, pk)
+		if err != nil {
+			return err
+		}
+		return RemoveWithHooks(ctx, dao, m, 1)
+	}},
+}
+
+// newLookupDao 建表并插入 n 条记录, 返回主键
+func newLookupDao(t testing.TB, n int) (*BaseDao, *sqlCounter, []int64) {
+	db := newTestDb(t, new(testUser))
+	dao := &BaseDao{Model: new(testUser)}
+	pks := make([]int64, 0, n)
+	for i := 0; i < n; i++ {
+		u := &testUser{Username: "u", Password: "p", Age: i}
+		if err := dao.InsertContext(context.Background(), u, 1); err != nil {
+			t.Fatal(err)
+		}
+		pks = append(pks, u.Id)
+	}
+	return dao, countSql(db), pks
+}
+
+func TestLookupSingleSelect(t *testing.T) {
+	for _, c := range lookupCases {
+		t.Run(c.name, func(t *testing.T) {
+			dao, counter, pks := newLookupDao(t, 1)
+			if err := c.lookup(context.Background(), dao, pks[0]); err != nil {
+				t.Fatal(err)
+			}
+			if n := counter.count("SELECT"); n != 1 {
+				t.Fatalf("expected 1 SELECT, got %d: %v", n, counter.statements)
+			}
+		})
+	}
+}
+
+func TestLookupSoftDeleted(t *testing.T) {
+	for _, c := range lookupCases {
+		t.Run(c.name, func(t *testing.T) {
+			dao, counter, pks := newLookupDao(t, 1)
+			if err := dao.DeleteByPkContext(context.Background(), pks[0], 1); err != nil {
+				t.Fatal(err)
+			}
+			counter.reset()
+			if err := c.lookup(context.Background(), dao, pks[0]); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("expected ErrNotFound, got %v", err)
+			}
+			if n := counter.count("SELECT"); n != 1 || len(counter.statements) != 1 {
+				t.Fatalf("expected only 1 SELECT, got %v", counter.statements)
+			}
+		})
+	}
+}
+
+func BenchmarkLookup(b *testing.B) {
+	for _, c := range lookupCases {
+		b.Run(c.name, func(b *testing.B) {
+			ctx := context.Background()
+			//删除类的路径每次需要新的记录
+			writes := c.name == "HandleDelete" || c.name == "HandleRemove"
+			n := 1
+			if writes {
+				n = b.N
+			}
+			dao, counter, pks := newLookupDao(b, n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				pk := pks[0]
+				if writes {
+					pk = pks[i]
+				}
+				if err := c.lookup(ctx, dao, pk); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			if n := counter.count("SELECT"); n != b.N {
+				b.Fatalf("expected %d SELECT, got %d", b.N, n)
+			}
+		})
+	}
+}
+
+// writeCases 更新的路径, 与 net.BaseApi 的 HandleUpdate/HandleUpdateStatus 一致, 不预先查询
+var writeCases = []struct {
+	name  string
+	write func(ctx context.Context, dao *BaseDao, pk int64) error
+}{
+	{"HandleUpdate", func(ctx context.Context, dao *BaseDao, pk int64) error {
+		return UpdateWithHooks(ctx, dao, &testUser{BaseModel: BaseModel{Id: pk}, Username: "v"}, 1)
+	}},
+	{"HandleUpdateStatus", func(ctx context.Context, dao *BaseDao, pk int64) error {
+		return dao.UpdateStatusContext(ctx, pk, FlagNo, 1)
+	}},
+}
+
+func TestWriteSingleUpdate(t *testing.T) {
+	for _, c := range writeCases {
+		t.Run(c.name, func(t *testing.T) {
+			dao, counter, pks := newLookupDao(t, 1)
+			if err := c.write(context.Background(), dao, pks[0]); err != nil {
+				t.Fatal(err)
+			}
+			if n := counter.count("UPDATE"); n != 1 || len(counter.statements) != 1 {
+				t.Fatalf("expected only 1 UPDATE, got %v", counter.statements)
+			}
+		})
+	}
+}
+
+func TestWriteSoftDeleted(t *testing.T) {
+	for _, c := range writeCases {
+		t.Run(c.name, func(t *testing.T) {
+			dao, counter, pks := newLookupDao(t, 1)
+			if err := dao.DeleteByPkContext(context.Background(), pks[0], 1); err != nil {
+				t.Fatal(err)
+			}
+			counter.reset()
+			if err := c.write(context.Background(), dao, pks[0]); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("expected ErrNotFound, got %v", err)
+			}
+			if n := counter.count("UPDATE"); n != 1 || len(counter.statements) != 1 {
+				t.Fatalf("expected only 1 UPDATE, got %v", counter.statements)
+			}
+		})
+	}
+}
+
+func BenchmarkWrite(b *testing.B) {
+	for _, c := range writeCases {
+		b.Run(c.name, func(b *testing.B) {
+			ctx := context.Background()
+			dao, counter, pks := newLookupDao(b, 1)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := c.write(ctx, dao, pks[0]); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			if n := counter.count("UPDATE"); n != b.N || len(counter.statements) != b.N {
+				b.Fatalf("expected %d UPDATE only, got %d of %d statements", b.N, n, len(counter.statements))
+			}
+		})
+	}
+}
+
+func TestFindListByColumnSoftDeleted(t *testing.T) {
+	dao, _, pks := newLookupDao(t, 2)
+	ctx := context.Background()
+	if err := dao.DeleteByPkContext(ctx, pks[0], 1); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := dao.FindListByColumnContext(ctx, "username", "u")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users := rows.([]*testUser); len(users) != 1 || users[0].Id != pks[1] {
+		t.Fatalf("expected only the live row, got %v", users)
+	}
+}
@@ -0,0 +1,336 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 差异类型
+const (
+	DriftMissingTable  = "missing_table"  // 表不存在
+	DriftMissingColumn = "missing_column" // 列不存在
+	DriftExtraColumn   = "extra_column"   // 数据库中多出的列, 不生成 SQL
+	DriftType          = "type"           // 类型或长度不一致
+	DriftNullable      = "nullable"       // 是否可空不一致
+	DriftComment       = "comment"        // 注释不一致
+	DriftMissingIndex  = "missing_index"  // 索引不存在
+	DriftExtraIndex    = "extra_index"    // 数据库中多出的索引, 不生成 SQL
+)
+
+// SchemaDrift 一项差异, Expected 为模型定义, Actual 为数据库现状
+type SchemaDrift struct {
+	Table    string `json:"table"`
+	Column   string `json:"column,omitempty"`
+	Index    string `json:"index,omitempty"`
+	Kind     string `json:"kind"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Sql      string `json:"sql,omitempty"` // 修复的 SQL, 数据库不支持(如 sqlite 修改列)时为空
+}
+
+// SchemaDriftReport 差异报告
+type SchemaDriftReport struct {
+	Drifts []SchemaDrift `json:"drifts"`
+}
+
+// HasDrift 是否有差异
+func (report *SchemaDriftReport) HasDrift() bool {
+	return len(report.Drifts) > 0
+}
+
+// Sql 修复差异的 SQL, 按差异顺序去重
+func (report *SchemaDriftReport) Sql() []string {
+	sqls := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, drift := range report.Drifts {
+		for _, sql := range strings.Split(drift.Sql, ";\n") {
+			if len(sql) == 0 || seen[sql] {
+				continue
+			}
+			seen[sql] = true
+			sqls = append(sqls, sql)
+		}
+	}
+	return sqls
+}
+
+func (report *SchemaDriftReport) add(drift SchemaDrift) {
+	report.Drifts = append(report.Drifts, drift)
+}
+
+// DetectSchemaDrift 对比模型与数据库的表结构(列、类型、可空、注释、索引), 不做任何修改
+// models 为空时对比 RegisterModels 注册的模型
+func DetectSchemaDrift(ctx context.Context, models ...ModelInterface) (*SchemaDriftReport, error) {
+	if len(models) == 0 {
+		models = RegisteredModels()
+	}
+	report := &SchemaDriftReport{Drifts: make([]SchemaDrift, 0)}
+	for _, m := range models {
+		if err := detectTableDrift(DbSessContext(ctx).Table(m.Table()), m, report); err != nil {
+			return nil, fmt.Errorf("detect %s failed: %w", m.Table(), err)
+		}
+	}
+	return report, nil
+}
+
+func detectTableDrift(db *gorm.DB, m ModelInterface, report *SchemaDriftReport) error {
+	s, err := dbModelSchema(db, m)
+	if err != nil {
+		return err
+	}
+	table := m.Table()
+	migrator := db.Migrator()
+	if !migrator.HasTable(m) {
+		sql, err := captureSql(db, func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(m)
+		})
+		if err != nil {
+			return err
+		}
+		report.add(SchemaDrift{Table: table, Kind: DriftMissingTable, Sql: sql})
+		return nil
+	}
+
+	columnTypes, err := migrator.ColumnTypes(m)
+	if err != nil {
+		return err
+	}
+	actual := make(map[string]gorm.ColumnType, len(columnTypes))
+	for _, columnType := range columnTypes {
+		actual[strings.ToLower(columnType.Name())] = columnType
+	}
+	for _, dbName := range s.DBNames {
+		field := s.FieldsByDBName[dbName]
+		if field.IgnoreMigration {
+			continue
+		}
+		columnType, ok := actual[strings.ToLower(dbName)]
+		if !ok {
+			report.add(SchemaDrift{
+				Table:    table,
+				Column:   dbName,
+				Kind:     DriftMissingColumn,
+				Expected: migrator.FullDataTypeOf(field).SQL,
+				Sql: db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+					return tx.Exec("ALTER TABLE ? ADD ? ?", clause.Table{Name: table}, clause.Column{Name: dbName}, migrator.FullDataTypeOf(field))
+				}),
+			})
+			continue
+		}
+		delete(actual, strings.ToLower(dbName))
+		detectColumnDrift(db, table, field, columnType, report)
+	}
+	for _, columnType := range columnTypes {
+		if _, ok := actual[strings.ToLower(columnType.Name())]; ok {
+			report.add(SchemaDrift{Table: table, Column: columnType.Name(), Kind: DriftExtraColumn, Actual: columnType.DatabaseTypeName()})
+		}
+	}
+	return detectIndexDrift(db, m, s, report)
+}
+
+// sizeRegexp 类型中的长度, 如 varchar(100)
+var sizeRegexp = regexp.MustCompile(`\((\d+)`)
+
+// typeArgsRegexp 类型中括号内的参数, 如 varchar(100)、decimal(10,2)
+var typeArgsRegexp = regexp.MustCompile(`\([^)]*\)`)
+
+// typeAliases 同一类型的不同写法, 如 postgres 返回 int8、bool, 模型定义为 bigint、boolean
+var typeAliases = map[string]string{
+	"int8":                        "bigint",
+	"bigserial":                   "bigint",
+	"int":                         "integer",
+	"int4":                        "integer",
+	"serial":                      "integer",
+	"int2":                        "smallint",
+	"smallserial":                 "smallint",
+	"bool":                        "boolean",
+	"character varying":           "varchar",
+	"character":                   "char",
+	"bpchar":                      "char",
+	"float8":                      "double",
+	"double precision":            "double",
+	"float4":                      "real",
+	"numeric":                     "decimal",
+	"timestamp without time zone": "timestamp",
+	"timestamp with time zone":    "timestamptz",
+	"time without time zone":      "time",
+	"time with time zone":         "timetz",
+}
+
+// dialectTypeAliases 数据库特有的别名, 如 mysql 的 boolean 即 tinyint(1)
+var dialectTypeAliases = map[string]map[string]string{
+	"mysql": {
+		"boolean": "tinyint",
+		"integer": "int",
+	},
+	"sqlite": {
+		//sqlite 按类型亲和性存储, 驱动原样返回建表时的类型名
+		"int":    "integer",
+		"bigint": "integer",
+	},
+}
+
+// normalizeColumnType 类型的规范名称, 去掉长度等参数及 unsigned 等修饰, 统一别名
+func normalizeColumnType(dialect, t string) string {
+	t = strings.Join(strings.Fields(strings.ToLower(typeArgsRegexp.ReplaceAllString(t, " "))), " ")
+	name := t
+	if fields := strings.Fields(t); len(fields) > 0 {
+		name = fields[0]
+	}
+	//多个单词组成的类型名
+	for alias := range typeAliases {
+		if strings.Contains(alias, " ") && strings.HasPrefix(t, alias) {
+			name = alias
+			break
+		}
+	}
+	if alias, ok := typeAliases[name]; ok {
+		name = alias
+	}
+	if alias, ok := dialectTypeAliases[dialect][name]; ok {
+		name = alias
+	}
+	return name
+}
+
+func detectColumnDrift(db *gorm.DB, table string, field *schema.Field, columnType gorm.ColumnType, report *SchemaDriftReport) {
+	if field.PrimaryKey {
+		return
+	}
+	expected := strings.ToLower(db.Dialector.DataTypeOf(field))
+	realType := strings.ToLower(columnType.DatabaseTypeName())
+	actualType := realType
+	if full, ok := columnType.ColumnType(); ok && len(full) > 0 {
+		actualType = strings.ToLower(full)
+	}
+	typeDrift := normalizeColumnType(db.Dialector.Name(), expected) != normalizeColumnType(db.Dialector.Name(), realType)
+	if length, ok := columnType.Length(); ok && length > 0 {
+		size := int64(field.Size)
+		if matches := sizeRegexp.FindStringSubmatch(expected); len(matches) == 2 {
+			size, _ = strconv.ParseInt(matches[1], 10, 64)
+		}
+		if size > 0 && size != length {
+			typeDrift = true
+		}
+	}
+	if typeDrift {
+		report.add(SchemaDrift{Table: table, Column: field.DBName, Kind: DriftType, Expected: expected, Actual: actualType,
+			Sql: alterColumnSql(db, table, field, DriftType)})
+	}
+	//sqlite 驱动返回的可空信息不可靠, 不检查
+	if nullable, ok := columnType.Nullable(); ok && nullable == field.NotNull && db.Dialector.Name() != "sqlite" {
+		report.add(SchemaDrift{Table: table, Column: field.DBName, Kind: DriftNullable,
+			Expected: strconv.FormatBool(!field.NotNull), Actual: strconv.FormatBool(nullable),
+			Sql: alterColumnSql(db, table, field, DriftNullable)})
+	}
+	if comment, ok := columnType.Comment(); ok && comment != field.Comment {
+		report.add(SchemaDrift{Table: table, Column: field.DBName, Kind: DriftComment, Expected: field.Comment, Actual: comment,
+			Sql: alterColumnSql(db, table, field, DriftComment)})
+	}
+}
+
+// alterColumnSql 修改列的 SQL, 不支持的数据库返回空
+func alterColumnSql(db *gorm.DB, table string, field *schema.Field, kind string) string {
+	t, c := clause.Table{Name: table}, clause.Column{Name: field.DBName}
+	switch db.Dialector.Name() {
+	case "mysql":
+		return db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+			return tx.Exec("ALTER TABLE ? MODIFY COLUMN ? ?", t, c, db.Migrator().FullDataTypeOf(field))
+		})
+	case "sqlserver":
+		return db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+			return tx.Exec("ALTER TABLE ? ALTER COLUMN ? ?", t, c, db.Migrator().FullDataTypeOf(field))
+		})
+	case "postgres":
+		switch kind {
+		case DriftType:
+			return db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+				return tx.Exec("ALTER TABLE ? ALTER COLUMN ? TYPE ?", t, c, clause.Expr{SQL: db.Dialector.DataTypeOf(field)})
+			})
+		case DriftNullable:
+			action := "DROP NOT NULL"
+			if field.NotNull {
+				action = "SET NOT NULL"
+			}
+			return db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+				return tx.Exec("ALTER TABLE ? ALTER COLUMN ? "+action, t, c)
+			})
+		case DriftComment:
+			return db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+				return tx.Exec("COMMENT ON COLUMN ?.? IS ?", t, c, field.Comment)
+			})
+		}
+	}
+	return ""
+}
+
+func detectIndexDrift(db *gorm.DB, m ModelInterface, s *schema.Schema, report *SchemaDriftReport) error {
+	migrator := db.Migrator()
+	expected := make(map[string]bool)
+	for name := range s.ParseIndexes() {
+		expected[strings.ToLower(name)] = true
+		if migrator.HasIndex(m, name) {
+			continue
+		}
+		sql, err := captureSql(db, func(tx *gorm.DB) error {
+			return tx.Migrator().CreateIndex(m, name)
+		})
+		if err != nil {
+			return err
+		}
+		report.add(SchemaDrift{Table: m.Table(), Index: name, Kind: DriftMissingIndex, Sql: sql})
+	}
+	//部分数据库驱动未实现 GetIndexes, 此时不检查多出的索引
+	indexes, err := migrator.GetIndexes(m)
+	if err != nil {
+		return nil
+	}
+	for _, index := range indexes {
+		if primary, ok := index.PrimaryKey(); ok && primary {
+			continue
+		}
+		if !expected[strings.ToLower(index.Name())] {
+			report.add(SchemaDrift{Table: m.Table(), Index: index.Name(), Kind: DriftExtraIndex, Actual: strings.Join(index.Columns(), ",")})
+		}
+	}
+	return nil
+}
+
+// captureSql 以 DryRun 方式执行 fn, 返回生成的 SQL, 多条以 ";\n" 分隔
+func captureSql(db *gorm.DB, fn func(tx *gorm.DB) error) (sql string, err error) {
+	collector := &sqlCollector{Interface: logger.Discard}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("generate sql failed: %v", r)
+		}
+	}()
+	if err = fn(db.Session(&gorm.Session{DryRun: true, Logger: collector})); err != nil {
+		return "", err
+	}
+	return strings.Join(collector.sqls, ";\n"), nil
+}
+
+// sqlCollector 收集执行的 SQL
+type sqlCollector struct {
+	logger.Interface
+	sqls []string
+}
+
+func (collector *sqlCollector) LogMode(logger.LogLevel) logger.Interface {
+	return collector
+}
+
+func (collector *sqlCollector) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	sql, _ := fc()
+	collector.sqls = append(collector.sqls, sql)
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNormalizeColumnType(t *testing.T) {
+	cases := []struct {
+		dialect        string
+		expected, real string
+		same           bool
+	}{
+		{"postgres", "bigint", "int8", true},
+		{"postgres", "boolean", "bool", true},
+		{"postgres", "varchar(100)", "character varying", true},
+		{"postgres", "varchar(100)", "varchar", true},
+		{"postgres", "integer", "int4", true},
+		{"postgres", "smallint", "int2", true},
+		{"postgres", "decimal(10,2)", "numeric", true},
+		{"postgres", "timestamptz", "timestamp with time zone", true},
+		{"postgres", "timestamptz", "timestamp", false},
+		{"postgres", "text", "varchar", false},
+		{"postgres", "bigint", "int4", false},
+		{"mysql", "boolean", "tinyint", true},
+		{"mysql", "bigint unsigned", "bigint", true},
+		{"mysql", "datetime(3)", "datetime", true},
+		{"mysql", "varchar(50)", "VARCHAR", true},
+		{"mysql", "int", "integer", true},
+		{"mysql", "varchar(50)", "text", false},
+		{"mysql", "int", "bigint", false},
+		{"sqlite", "integer", "INTEGER", true},
+		{"sqlite", "bigint", "integer", true},
+		{"sqlite", "text", "numeric", false},
+	}
+	for _, c := range cases {
+		t.Run(c.dialect+" "+c.expected+" "+c.real, func(t *testing.T) {
+			a, b := normalizeColumnType(c.dialect, c.expected), normalizeColumnType(c.dialect, c.real)
+			if (a == b) != c.same {
+				t.Fatalf("expected same=%v, got %q and %q", c.same, a, b)
+			}
+		})
+	}
+}
+
+func TestDetectSchemaDriftNoFalsePositive(t *testing.T) {
+	newTestDb(t, new(testUser), new(versionUser))
+	report, err := DetectSchemaDrift(context.Background(), new(testUser), new(versionUser))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, drift := range report.Drifts {
+		if drift.Kind == DriftType {
+			t.Fatalf("unexpected type drift %+v", drift)
+		}
+	}
+}
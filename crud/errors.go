@@ -0,0 +1,95 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"strings"
+)
+
+var (
+	// ErrNotFound 记录不存在
+	ErrNotFound = errors.New("record not found")
+	// ErrConflict 主键或唯一键冲突
+	ErrConflict = errors.New("record conflict")
+	// ErrValidation 校验失败, 一般由 Before/After 钩子返回
+	ErrValidation = errors.New("validation failed")
+)
+
+// DaoError DAO 错误, Kind 为上面定义的错误类型, Err 为原始错误(如驱动错误)
+type DaoError struct {
+	Kind error
+	Err  error
+}
+
+func (e *DaoError) Error() string {
+	if e.Err == nil {
+		return e.Kind.Error()
+	}
+	if e.Kind == ErrValidation || e.Kind.Error() == e.Err.Error() {
+		return e.Err.Error()
+	}
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap 返回原始错误, 便于 errors.As 取驱动错误
+func (e *DaoError) Unwrap() error {
+	return e.Err
+}
+
+// Is 支持 errors.Is(err, ErrNotFound) 等判断
+func (e *DaoError) Is(target error) bool {
+	return e.Kind == target
+}
+
+// NewValidationError 钩子校验失败的错误, msg 为钩子返回的提示
+func NewValidationError(msg string) error {
+	return &DaoError{Kind: ErrValidation, Err: errors.New(msg)}
+}
+
+// ValidationMessage 取校验失败的提示
+func ValidationMessage(err error) string {
+	var daoErr *DaoError
+	if errors.As(err, &daoErr) && daoErr.Kind == ErrValidation && daoErr.Err != nil {
+		return daoErr.Err.Error()
+	}
+	return ""
+}
+
+// duplicateKeywords 各数据库驱动唯一键冲突时的错误信息
+var duplicateKeywords = []string{
+	"duplicate entry",                           // mysql
+	"duplicate key value",                       // postgres
+	"unique constraint failed",                  // sqlite
+	"violation of unique key constraint",        // sqlserver
+	"cannot insert duplicate key row in object", // sqlserver
+}
+
+func isDuplicateError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, keyword := range duplicateKeywords {
+		if strings.Contains(msg, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// wrapDbError 将 gorm/驱动错误转换为 DaoError, 保留原始错误
+func wrapDbError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var daoErr *DaoError
+	if errors.As(err, &daoErr) {
+		return err
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &DaoError{Kind: ErrNotFound, Err: err}
+	}
+	if isDuplicateError(err) {
+		return &DaoError{Kind: ErrConflict, Err: err}
+	}
+	return err
+}
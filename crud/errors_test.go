@@ -0,0 +1,91 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestWrapDbError(t *testing.T) {
+	driverErr := errors.New("driver: bad connection")
+	validation := NewValidationError("名称不能为空")
+	cases := []struct {
+		name string
+		err  error
+		kind error
+	}{
+		{"nil", nil, nil},
+		{"not found", gorm.ErrRecordNotFound, ErrNotFound},
+		{"wrapped not found", fmt.Errorf("find: %w", gorm.ErrRecordNotFound), ErrNotFound},
+		{"mysql duplicate", errors.New("Error 1062: Duplicate entry 'a' for key 'username'"), ErrConflict},
+		{"postgres duplicate", errors.New(`ERROR: duplicate key value violates unique constraint "users_pkey"`), ErrConflict},
+		{"sqlite duplicate", errors.New("UNIQUE constraint failed: users.username"), ErrConflict},
+		{"sqlserver duplicate", errors.New("Violation of UNIQUE KEY constraint 'uk'"), ErrConflict},
+		{"sqlserver duplicate row", errors.New("Cannot insert duplicate key row in object 'dbo.users'"), ErrConflict},
+		{"dao error kept", validation, ErrValidation},
+		{"other", driverErr, nil},
+	}
+	kinds := []error{ErrNotFound, ErrConflict, ErrValidation}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := wrapDbError(c.err)
+			if c.err == nil {
+				if err != nil {
+					t.Fatalf("expected nil, got %v", err)
+				}
+				return
+			}
+			if c.kind == nil && err != c.err {
+				t.Fatalf("expected the error unchanged, got %v", err)
+			}
+			if c.kind != nil && !errors.Is(err, c.err) {
+				t.Fatalf("expected %v to keep the original error", err)
+			}
+			for _, kind := range kinds {
+				if errors.Is(err, kind) != (kind == c.kind) {
+					t.Fatalf("errors.Is(%v, %v) = %v", err, kind, !(kind == c.kind))
+				}
+			}
+		})
+	}
+}
+
+func TestDaoError(t *testing.T) {
+	driverErr := errors.New("UNIQUE constraint failed: users.username")
+	cases := []struct {
+		err   *DaoError
+		kind  error
+		msg   string
+		cause error
+	}{
+		{&DaoError{Kind: ErrNotFound}, ErrNotFound, "record not found", nil},
+		{&DaoError{Kind: ErrNotFound, Err: gorm.ErrRecordNotFound}, ErrNotFound, "record not found", gorm.ErrRecordNotFound},
+		{&DaoError{Kind: ErrConflict, Err: driverErr}, ErrConflict, "record conflict: " + driverErr.Error(), driverErr},
+		{NewValidationError("名称不能为空").(*DaoError), ErrValidation, "名称不能为空", nil},
+	}
+	for _, c := range cases {
+		if !errors.Is(c.err, c.kind) {
+			t.Fatalf("expected %v to be %v", c.err, c.kind)
+		}
+		if msg := c.err.Error(); msg != c.msg {
+			t.Fatalf("expected message %q, got %q", c.msg, msg)
+		}
+		if c.cause != nil && errors.Unwrap(c.err) != c.cause {
+			t.Fatalf("expected Unwrap to return %v, got %v", c.cause, errors.Unwrap(c.err))
+		}
+		wrapped := fmt.Errorf("handler: %w", c.err)
+		var daoErr *DaoError
+		if !errors.Is(wrapped, c.kind) || !errors.As(wrapped, &daoErr) || daoErr != c.err {
+			t.Fatalf("expected %v to match through wrapping", wrapped)
+		}
+	}
+	if msg := ValidationMessage(NewValidationError("名称不能为空")); msg != "名称不能为空" {
+		t.Fatalf("unexpected validation message %q", msg)
+	}
+	if msg := ValidationMessage(&DaoError{Kind: ErrConflict, Err: driverErr}); msg != "" {
+		t.Fatalf("expected no validation message for a conflict, got %q", msg)
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/zhouhp1295/g3/helpers"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ExportableInterface 可选, 模型声明默认导出的字段及顺序(json 名、字段名或列名)
+// 未声明时导出默认查询的字段, 不含 json:"-" 与 `export:"-"` 的字段
+type ExportableInterface interface {
+	ExportFields() []string
+}
+
+// 导出的限制
+var (
+	ExportChunkSize = 500    // 每批查询的行数
+	ExportMaxRows   = 100000 // 最多导出的行数, 0 为不限制
+)
+
+// ErrExportTruncated 导出的行数超过 ExportMaxRows, 只导出了前 ExportMaxRows 行
+var ErrExportTruncated = errors.New("export truncated")
+
+// ExportColumn 导出的列
+type ExportColumn struct {
+	Field  *schema.Field
+	Header string
+}
+
+type localeContextKey struct{}
+
+// WithLocale 设置语言, 如 en、zh-CN, 导出时用于选择表头, 见 ExportHeader
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeContextKey{}, locale)
+}
+
+// LocaleFromContext 取 WithLocale 设置的语言
+func LocaleFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	locale, _ := ctx.Value(localeContextKey{}).(string)
+	return locale
+}
+
+// ExportHeader 列的表头, 依次为:
+// 语言对应的标签 `export_en:"Order No"`(zh-CN 依次查找 export_zh_cn、export_zh)、`export:"订单号"`、
+// gorm 的 COMMENT(第一个空格前的部分)、json 名
+func ExportHeader(field *schema.Field, locale string) string {
+	locale = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "-", "_"))
+	for len(locale) > 0 {
+		if label := field.StructField.Tag.Get("export_" + locale); len(label) > 0 {
+			return label
+		}
+		i := strings.LastIndex(locale, "_")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	if label := field.StructField.Tag.Get("export"); len(label) > 0 && label != "-" {
+		return label
+	}
+	if words := strings.Fields(field.Comment); len(words) > 0 {
+		return words[0]
+	}
+	if name := JsonName(field); len(name) > 0 {
+		return name
+	}
+	return field.Name
+}
+
+// isExportable 字段是否可以导出, 导入时同样忽略不可导出的字段
+func isExportable(field *schema.Field) bool {
+	return len(field.DBName) > 0 &&
+		!IsSensitiveField(field) &&
+		field.StructField.Tag.Get("export") != "-" &&
+		strings.Split(field.StructField.Tag.Get("json"), ",")[0] != "-"
+}
+
+// ExportColumns 导出的列: fields 参数指定的字段(按指定的顺序), 否则为 ExportableInterface 声明的字段, 再为默认字段
+// engine 为模型所在数据库; 未知、敏感或不可导出(json:"-"、`export:"-"`)的字段返回 ErrValidation
+func ExportColumns(ctx context.Context, engine string, m ModelInterface, fields string) ([]ExportColumn, error) {
+	s, err := EngineModelSchema(engine, m)
+	if err != nil {
+		return nil, err
+	}
+	var selected []*schema.Field
+	switch exportable, ok := m.(ExportableInterface); {
+	case len(strings.TrimSpace(fields)) > 0:
+		if selected, err = parseFields(s, strings.Split(fields, ",")); err != nil {
+			return nil, err
+		}
+		//指定的字段同样不能导出 json:"-" 与 `export:"-"` 的字段
+		for _, field := range selected {
+			if !isExportable(field) {
+				return nil, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("field %q is not exportable", field.Name)}
+			}
+		}
+	case ok:
+		selected, err = parseFields(s, exportable.ExportFields())
+	default:
+		if selected, err = defaultFields(m, s); selected == nil && err == nil {
+			selected = s.Fields
+		}
+		exportable := make([]*schema.Field, 0, len(selected))
+		for _, field := range selected {
+			if isExportable(field) {
+				exportable = append(exportable, field)
+			}
+		}
+		selected = exportable
+	}
+	if err != nil {
+		return nil, err
+	}
+	locale := LocaleFromContext(ctx)
+	columns := make([]ExportColumn, 0, len(selected))
+	for _, field := range selected {
+		columns = append(columns, ExportColumn{Field: field, Header: ExportHeader(field, locale)})
+	}
+	return columns, nil
+}
+
+// Value 取行中该列的值, 数值保持原类型, 时间格式化为 helpers.DateFormatDefault, 空指针为 ""
+func (column ExportColumn) Value(ctx context.Context, row reflect.Value) interface{} {
+	row = reflect.Indirect(row)
+	v, _ := column.Field.ValueOf(ctx, row)
+	if valuer, ok := v.(driver.Valuer); ok {
+		if rv := reflect.ValueOf(valuer); rv.Kind() != reflect.Ptr || !rv.IsNil() {
+			v, _ = valuer.Value()
+		}
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return ""
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return ""
+	}
+	switch value := rv.Interface().(type) {
+	case time.Time:
+		if value.IsZero() {
+			return ""
+		}
+		return helpers.FormatDefaultDate(value)
+	case []byte:
+		return string(value)
+	case string, bool,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		return value
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// ExportContext 按列表查询的条件分批查询, 每批最多 ExportChunkSize 行, 回调的 rows 与 FindListContext 的结果类型一致
+// 以游标分页逐批读取, 排序字段不支持游标(如可为 NULL)时改用偏移分页; 不统计总数, 排序见 BaseQueryParams.OrderBy
+// 超过 ExportMaxRows 时只导出前 ExportMaxRows 行, 并返回 ErrExportTruncated
+func (dao *BaseDao) ExportContext(ctx context.Context, modelParams ModelInterface, baseParams *BaseQueryParams, fn func(rows interface{}) error) error {
+	params := BaseQueryParams{}
+	if baseParams != nil {
+		params = *baseParams
+	}
+	params.PageMode = PageModeCursor
+	params.PageNum = 1
+	params.PageSize = ExportChunkSize
+	params.CountMode = CountNone
+	params.Cursor = ""
+	if _, err := dao.newWrapper(modelParams, &params).CursorOrderFields(); err != nil {
+		fields, err := dao.newWrapper(modelParams, &params).OrderFields()
+		if err != nil {
+			return err
+		}
+		//偏移分页按主键兜底排序, 各批之间顺序稳定
+		params.PageMode = PageModeOffset
+		params.OrderBy = orderSignature(cursorOrderFields(fields))
+	}
+	exported := 0
+	for {
+		rows, pageData, err := dao.findPage(ctx, dao.newWrapper(modelParams, &params))
+		if err != nil {
+			return err
+		}
+		hasMore := pageData.HasMore
+		if ExportMaxRows > 0 {
+			var cut bool
+			rows, cut = truncateRows(rows, ExportMaxRows-exported)
+			hasMore = hasMore || cut
+		}
+		n := reflect.Indirect(reflect.ValueOf(rows)).Len()
+		if n > 0 {
+			if err = fn(rows); err != nil {
+				return err
+			}
+		}
+		exported += n
+		if !hasMore {
+			return nil
+		}
+		if ExportMaxRows > 0 && exported >= ExportMaxRows {
+			return &DaoError{Kind: ErrExportTruncated, Err: fmt.Errorf("only the first %d rows are exported", ExportMaxRows)}
+		}
+		if params.PageMode == PageModeOffset {
+			params.PageNum++
+			continue
+		}
+		if len(pageData.NextCursor) == 0 {
+			return nil
+		}
+		params.Cursor = pageData.NextCursor
+	}
+}
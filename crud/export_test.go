@@ -0,0 +1,176 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// exportUser 含不可导出字段的模型
+type exportUser struct {
+	BaseModel
+	ModelFactory[exportUser]
+	Username string `gorm:"COMMENT:用户名 登录名" json:"username" export_en:"User"`
+	Password string `json:"password" sensitive:"true"`
+	Token    string `json:"-"`
+	Internal string `json:"internal" export:"-"`
+	Age      int    `json:"age" export:"年龄"`
+	TailColumns
+}
+
+func (*exportUser) Table() string { return "export_users" }
+
+func TestExportColumns(t *testing.T) {
+	cases := []struct {
+		name    string
+		locale  string
+		fields  string
+		headers string
+		err     string // 期望 ErrValidation 的错误信息
+	}{
+		{"explicit", "", "age,username", "年龄,用户名", ""},
+		{"explicit locale", "en-US", "username, age", "User,年龄", ""},
+		{"json hidden", "", "username,token", "", "not exportable"},
+		{"export hidden", "", "internal", "", "not exportable"},
+		{"sensitive", "", "password", "", "not selectable"},
+		{"unknown", "", "nope", "", "unknown field"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			columns, err := ExportColumns(WithLocale(context.Background(), c.locale), DefaultDbEngine, new(exportUser), c.fields)
+			if len(c.err) > 0 {
+				if !errors.Is(err, ErrValidation) || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expected ErrValidation %q, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			headers := make([]string, 0, len(columns))
+			for _, column := range columns {
+				headers = append(headers, column.Header)
+			}
+			if strings.Join(headers, ",") != c.headers {
+				t.Fatalf("expected headers %s, got %v", c.headers, headers)
+			}
+		})
+	}
+
+	//默认导出的字段不含敏感与隐藏的字段
+	columns, err := ExportColumns(context.Background(), DefaultDbEngine, new(exportUser), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, column := range columns {
+		switch column.Field.Name {
+		case "Password", "Token", "Internal", "Deleted":
+			t.Fatalf("field %s should not be exported", column.Field.Name)
+		}
+	}
+}
+
+func TestImportField(t *testing.T) {
+	s, err := ModelSchema(new(exportUser))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		locale string
+		header string
+		want   string // 为空时期望忽略该列
+	}{
+		{"", "用户名", "Username"},
+		{"", "USERNAME", "Username"},
+		{"en", "User", "Username"},
+		{"", "年龄", "Age"},
+		{"", "age", "Age"},
+		{"", "remark", "Remark"},
+		{"", "token", ""},
+		{"", "Token", ""},
+		{"", "internal", ""},
+		{"", "password", ""},
+		{"", "created_by", ""},
+		{"", "nope", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.header, func(t *testing.T) {
+			field := ImportField(WithLocale(context.Background(), c.locale), s, c.header)
+			name := ""
+			if field != nil {
+				name = field.Name
+			}
+			if name != c.want {
+				t.Fatalf("expected field %q, got %q", c.want, name)
+			}
+		})
+	}
+}
+
+func TestExportContext(t *testing.T) {
+	newTestDb(t, new(nullableUser))
+	dao := &BaseDao{Model: new(nullableUser)}
+	ctx := context.Background()
+	for i := 0; i < 7; i++ {
+		user := new(nullableUser)
+		if i%2 == 0 {
+			name := "same"
+			user.Nickname = &name
+		}
+		if err := dao.InsertContext(ctx, user, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chunk, max := ExportChunkSize, ExportMaxRows
+	defer func() { ExportChunkSize, ExportMaxRows = chunk, max }()
+	ExportChunkSize = 2
+
+	export := func(orderBy string) ([]int64, error) {
+		ids := make([]int64, 0)
+		err := dao.ExportContext(ctx, new(nullableUser), &BaseQueryParams{OrderBy: orderBy}, func(rows interface{}) error {
+			for _, row := range rows.([]*nullableUser) {
+				ids = append(ids, row.Id)
+			}
+			return nil
+		})
+		return ids, err
+	}
+	cases := []struct {
+		name      string
+		orderBy   string
+		max       int
+		rows      int
+		truncated bool
+	}{
+		{"cursor", "-id", 0, 7, false},
+		{"nullable order", "nickname", 0, 7, false},
+		{"exact max", "-id", 7, 7, false},
+		{"truncated", "-id", 5, 5, true},
+		{"truncated nullable order", "-nickname", 3, 3, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ExportMaxRows = c.max
+			ids, err := export(c.orderBy)
+			if c.truncated != errors.Is(err, ErrExportTruncated) {
+				t.Fatalf("expected truncated %v, got %v", c.truncated, err)
+			}
+			if !c.truncated && err != nil {
+				t.Fatal(err)
+			}
+			seen := make(map[int64]bool)
+			for _, id := range ids {
+				if seen[id] {
+					t.Fatalf("row %d exported twice: %v", id, ids)
+				}
+				seen[id] = true
+			}
+			if len(ids) != c.rows {
+				t.Fatalf("expected %d rows, got %v", c.rows, ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"strings"
+)
+
+// IsSensitiveField 是否敏感字段, 标注 `sensitive:"true"` 的列在列表、导出及 WithDefaultFields 的查询中不查询,
+// 也不能通过 fields 参数指定; 列表中需要读取时使用 WithAllFields
+func IsSensitiveField(field *schema.Field) bool {
+	return field.StructField.Tag.Get("sensitive") == "true"
+}
+
+type fieldsContextKey struct{}
+
+// fieldsOption 查询的字段, all 为 true 时查询全部列
+type fieldsOption struct {
+	fields string
+	all    bool
+}
+
+// WithFields 指定 FindByPk 等单条查询返回的字段, 如 "id,name", 格式见 ParseFields, 为空时同 WithDefaultFields
+// 列表查询使用 BaseQueryParams.Fields, 未指定时也使用此设置
+func WithFields(ctx context.Context, fields string) context.Context {
+	return context.WithValue(ctx, fieldsContextKey{}, fieldsOption{fields: fields})
+}
+
+// WithDefaultFields FindByPk、FindOneByColumn 等单条查询也按模型的默认字段(GetSelectColumns, 不含敏感列)查询,
+// 用于返回给前端的查询; 未设置时单条查询读取全部列(含敏感列, 如校验密码时读取密码哈希)
+func WithDefaultFields(ctx context.Context) context.Context {
+	return WithFields(ctx, "")
+}
+
+// WithAllFields 查询全部列, 包括敏感列, 用于列表等默认按字段查询的内部读取
+func WithAllFields(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fieldsContextKey{}, fieldsOption{all: true})
+}
+
+func fieldsFromContext(ctx context.Context) (fieldsOption, bool) {
+	if ctx == nil {
+		return fieldsOption{}, false
+	}
+	option, ok := ctx.Value(fieldsContextKey{}).(fieldsOption)
+	return option, ok
+}
+
+// ParseFields 解析 fields 参数, 如 "id,name,status", 字段可为 json 名、字段名或列名, engine 为模型所在数据库
+// 未知或敏感字段返回 ErrValidation
+func ParseFields(engine string, m ModelInterface, fields string) ([]*schema.Field, error) {
+	s, err := EngineModelSchema(engine, m)
+	if err != nil {
+		return nil, err
+	}
+	return parseFields(s, strings.Split(fields, ","))
+}
+
+func parseFields(s *schema.Schema, names []string) ([]*schema.Field, error) {
+	result := make([]*schema.Field, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		field := LookUpField(s, name)
+		if field == nil {
+			return nil, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("unknown field %q", name)}
+		}
+		if IsSensitiveField(field) {
+			return nil, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("field %q is not selectable", name)}
+		}
+		result = append(result, field)
+	}
+	return result, nil
+}
+
+// defaultFields 模型默认查询的字段: GetSelectColumns, 未声明时为全部非敏感列; 返回 nil 表示查询全部列
+func defaultFields(m ModelInterface, s *schema.Schema) ([]*schema.Field, error) {
+	if columns := m.GetSelectColumns(); len(columns) > 0 {
+		return parseFields(s, columns)
+	}
+	fields := make([]*schema.Field, 0, len(s.Fields))
+	sensitive := false
+	for _, field := range s.Fields {
+		if len(field.DBName) == 0 {
+			continue
+		}
+		if IsSensitiveField(field) {
+			sensitive = true
+			continue
+		}
+		fields = append(fields, field)
+	}
+	if !sensitive {
+		return nil, nil
+	}
+	return fields, nil
+}
+
+// SelectFields 查询的字段: fields 参数, 为空时为 ctx 中的 WithFields, 再为模型的默认字段, engine 为模型所在数据库
+// 返回 nil 表示查询全部列; 指定字段时始终包含主键、租户列、版本号列及 extra
+func SelectFields(ctx context.Context, engine string, m ModelInterface, fields string, extra ...*schema.Field) ([]*schema.Field, error) {
+	option, _ := fieldsFromContext(ctx)
+	if option.all {
+		return nil, nil
+	}
+	if len(fields) == 0 {
+		fields = option.fields
+	}
+	s, err := EngineModelSchema(engine, m)
+	if err != nil {
+		return nil, err
+	}
+	return selectFields(m, s, fields, extra...)
+}
+
+// selectFields 见 SelectFields, s 为 m 的 schema
+func selectFields(m ModelInterface, s *schema.Schema, fields string, extra ...*schema.Field) ([]*schema.Field, error) {
+	var selected []*schema.Field
+	var err error
+	if len(strings.TrimSpace(fields)) > 0 {
+		selected, err = parseFields(s, strings.Split(fields, ","))
+	} else {
+		selected, err = defaultFields(m, s)
+	}
+	if err != nil || selected == nil {
+		return nil, err
+	}
+	required := append(make([]*schema.Field, 0, len(selected)+len(extra)+3), selected...)
+	required = append(required, extra...)
+	if s.PrioritizedPrimaryField != nil {
+		required = append(required, s.PrioritizedPrimaryField)
+	}
+	for _, column := range []string{TenantColumn, VersionColumn} {
+		if field, ok := s.FieldsByDBName[column]; ok {
+			required = append(required, field)
+		}
+	}
+	//按模型中的顺序返回, extra 可来自关联解析的 schema, 按列名比较
+	result := make([]*schema.Field, 0, len(required))
+	for _, field := range s.Fields {
+		for _, item := range required {
+			if len(field.DBName) > 0 && item.DBName == field.DBName {
+				result = append(result, field)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// fieldsScope 按 SelectFields 设置查询的列
+func fieldsScope(engine string, m ModelInterface, fields string, extra ...*schema.Field) func(db *gorm.DB) *gorm.DB {
+	return selectScope(m, func(db *gorm.DB) ([]*schema.Field, error) {
+		return SelectFields(db.Statement.Context, engine, m, fields, extra...)
+	})
+}
+
+// lookupFieldsScope 单条查询等按主键或列直接查询的列: 默认查询全部列,
+// ctx 中有 WithFields/WithDefaultFields 时按 SelectFields
+func lookupFieldsScope(engine string, m ModelInterface) func(db *gorm.DB) *gorm.DB {
+	return selectScope(m, func(db *gorm.DB) ([]*schema.Field, error) {
+		return lookupFields(db.Statement.Context, engine, m)
+	})
+}
+
+// lookupFields 单条查询的字段, 返回 nil 表示查询全部列
+func lookupFields(ctx context.Context, engine string, m ModelInterface) ([]*schema.Field, error) {
+	if _, ok := fieldsFromContext(ctx); !ok {
+		return nil, nil
+	}
+	return SelectFields(ctx, engine, m, "")
+}
+
+// clearUnselected 未查询的字段置为零值, 用于缓存中(全部列)的记录
+func clearUnselected(ctx context.Context, engine string, m ModelInterface) error {
+	selected, err := lookupFields(ctx, engine, m)
+	if err != nil || selected == nil {
+		return err
+	}
+	s, err := EngineModelSchema(engine, m)
+	if err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(m)
+	for _, field := range s.Fields {
+		if len(field.DBName) == 0 || containsField(selected, field) {
+			continue
+		}
+		field.ReflectValueOf(ctx, rv).Set(reflect.Zero(field.FieldType))
+	}
+	return nil
+}
+
+func containsField(fields []*schema.Field, field *schema.Field) bool {
+	for _, item := range fields {
+		if item == field {
+			return true
+		}
+	}
+	return false
+}
+
+// relatedFieldsScope 关联模型查询默认字段, 只受 WithAllFields 影响
+func relatedFieldsScope(m ModelInterface, extra ...*schema.Field) func(db *gorm.DB) *gorm.DB {
+	return selectScope(m, func(db *gorm.DB) ([]*schema.Field, error) {
+		if option, _ := fieldsFromContext(db.Statement.Context); option.all {
+			return nil, nil
+		}
+		s, err := dbModelSchema(db, m)
+		if err != nil {
+			return nil, err
+		}
+		return selectFields(m, s, "", extra...)
+	})
+}
+
+// selectScope 设置查询的列, 列名带表名以免与 JOIN 的表冲突
+func selectScope(m ModelInterface, resolve func(db *gorm.DB) ([]*schema.Field, error)) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		selected, err := resolve(db)
+		if err != nil {
+			_ = db.AddError(err)
+			return db
+		}
+		if selected == nil {
+			return db
+		}
+		columns := make([]string, 0, len(selected))
+		for _, field := range selected {
+			columns = append(columns, db.Statement.Quote(clause.Column{Table: m.Table(), Name: field.DBName}))
+		}
+		return db.Select(columns)
+	}
+}
+
+// hasDefaultFields 模型是否限制了默认查询的字段
+func hasDefaultFields(engine string, m ModelInterface) bool {
+	s, err := EngineModelSchema(engine, m)
+	if err != nil {
+		return false
+	}
+	fields, err := defaultFields(m, s)
+	return err == nil && fields != nil
+}
+
+// SelectedJsonNames 指定 fields 时返回的 json 名: 指定的字段、主键及 include 的关联, 用于裁剪输出
+func SelectedJsonNames(engine string, m ModelInterface, fields string, include string) ([]string, error) {
+	selected, err := ParseFields(engine, m, fields)
+	if err != nil {
+		return nil, err
+	}
+	s, err := EngineModelSchema(engine, m)
+	if err != nil {
+		return nil, err
+	}
+	if s.PrioritizedPrimaryField != nil {
+		selected = append(selected, s.PrioritizedPrimaryField)
+	}
+	names := make([]string, 0, len(selected))
+	for _, field := range selected {
+		if name := JsonName(field); len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+	includes, err := ParseInclude(engine, m, include)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range includes {
+		if name := JsonName(item.Relation.Field); len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
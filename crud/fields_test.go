@@ -0,0 +1,78 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// cachedUser 使用缓存的模型
+type cachedUser struct {
+	BaseModel
+	ModelFactory[cachedUser]
+	Username string `json:"username"`
+	Password string `json:"password" sensitive:"true"`
+	Age      int    `json:"age"`
+	TailColumns
+}
+
+func (*cachedUser) Table() string { return "cached_users" }
+
+func (*cachedUser) CacheTTL() time.Duration { return time.Minute }
+
+func TestLookupProjection(t *testing.T) {
+	newTestDb(t, new(testUser), new(cachedUser))
+	SetCache(NewLruCache(100))
+	defer SetCache(nil)
+	ctx := context.Background()
+
+	for _, model := range []ModelInterface{new(testUser), new(cachedUser)} {
+		dao := &BaseDao{Model: model}
+		m := NewModelOf(model)
+		switch u := m.(type) {
+		case *testUser:
+			u.Username, u.Password, u.Age = "alice", "hash", 30
+		case *cachedUser:
+			u.Username, u.Password, u.Age = "alice", "hash", 30
+		}
+		if err := dao.InsertContext(ctx, m, 1); err != nil {
+			t.Fatal(err)
+		}
+		cases := []struct {
+			name     string
+			lookup   func() (ModelInterface, error)
+			password string
+			age      int
+		}{
+			{"FindByPk", func() (ModelInterface, error) { return dao.FindByPk(m.GetId()), nil }, "hash", 30},
+			{"FindOneByColumn", func() (ModelInterface, error) { return dao.FindOneByColumn("username", "alice"), nil }, "hash", 30},
+			{"FindOneByColumns", func() (ModelInterface, error) {
+				return dao.FindOneByColumnsContext(ctx, map[string]interface{}{"username": "alice"})
+			}, "hash", 30},
+			{"default fields", func() (ModelInterface, error) { return dao.FindByPkContext(WithDefaultFields(ctx), m.GetId()) }, "", 30},
+			{"default fields by column", func() (ModelInterface, error) {
+				return dao.FindOneByColumnContext(WithDefaultFields(ctx), "username", "alice")
+			}, "", 30},
+			{"explicit fields", func() (ModelInterface, error) { return dao.FindByPkContext(WithFields(ctx, "username"), m.GetId()) }, "", 0},
+			//默认字段读取后缓存中仍为全部列
+			{"FindByPk after cache", func() (ModelInterface, error) { return dao.FindByPkContext(ctx, m.GetId()) }, "hash", 30},
+		}
+		for _, c := range cases {
+			t.Run(model.Table()+" "+c.name, func(t *testing.T) {
+				found, err := c.lookup()
+				if err != nil || found == nil {
+					t.Fatalf("lookup failed: %v", err)
+				}
+				u, ok := found.(*testUser)
+				if cu, cached := found.(*cachedUser); cached {
+					u, ok = &testUser{Username: cu.Username, Password: cu.Password, Age: cu.Age}, true
+				}
+				if !ok || u.Username != "alice" || u.Password != c.password || u.Age != c.age {
+					t.Fatalf("unexpected row %+v", found)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,574 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"encoding/json"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// FilterableInterface 可选, 模型声明可通过 filter 参数过滤的字段(json 名、字段名或列名)
+// 也可在字段上标注 `filterable:"true"`; 两者都未声明时, 所有非敏感列均可过滤
+type FilterableInterface interface {
+	FilterableFields() []string
+}
+
+// filter 参数的限制
+var (
+	FilterMaxDepth      = 5   // 最大嵌套层数, 顶层条件为 1 层
+	FilterMaxConditions = 20  // 最多的条件数
+	FilterMaxValues     = 100 // in 条件最多的值数
+)
+
+// Filter 过滤条件的语法树, 每个节点只能是 And、Or、Not 或单个字段条件(Field + Op + Value) 之一
+//
+//	{"and": [{"field": "status", "op": "eq", "value": 1}, {"or": [...]}, {"not": {...}}]}
+//
+// Op 为 query 标签的操作符, 可加 ;ci 忽略大小写, 如 "like;ci"; in/between 的 Value 为数组, isnull/notnull 无 Value
+type Filter struct {
+	And   []*Filter   `json:"and,omitempty"`
+	Or    []*Filter   `json:"or,omitempty"`
+	Not   *Filter     `json:"not,omitempty"`
+	Field string      `json:"field,omitempty"`
+	Op    string      `json:"op,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+func filterError(format string, args ...interface{}) error {
+	return &DaoError{Kind: ErrValidation, Err: fmt.Errorf(format, args...)}
+}
+
+// ParseFilter 解析 filter 参数, 以 { 或 [ 开头时为 JSON(数组为 AND), 否则为简写形式:
+//
+//	status:eq:1,or(name:like:foo,age:gte:18),not(deleted_at:isnull)
+//
+// 顶层的多个条件为 AND; in/between 的多个值以 | 分隔, 如 id:in:1|2|3;
+// 值含 , ) | 或首尾空格时用双引号, 如 name:eq:"a,b"; 语法错误或超过限制时返回 ErrValidation
+func ParseFilter(filter string) (*Filter, error) {
+	filter = strings.TrimSpace(filter)
+	if len(filter) == 0 {
+		return nil, nil
+	}
+	var f *Filter
+	var err error
+	if filter[0] == '{' || filter[0] == '[' {
+		f, err = parseJsonFilter(filter)
+	} else {
+		p := &filterParser{input: filter}
+		f, err = p.parse()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err = f.check(1); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseJsonFilter(filter string) (*Filter, error) {
+	decoder := json.NewDecoder(strings.NewReader(filter))
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+	var f *Filter
+	if filter[0] == '[' {
+		f = new(Filter)
+		if err := decoder.Decode(&f.And); err != nil {
+			return nil, filterError("invalid filter: %v", err)
+		}
+	} else if err := decoder.Decode(&f); err != nil {
+		return nil, filterError("invalid filter: %v", err)
+	}
+	if decoder.More() {
+		return nil, filterError("invalid filter: unexpected data after filter")
+	}
+	return f, nil
+}
+
+// check 检查节点结构与层数, 返回条件数
+func (f *Filter) check(depth int) (int, error) {
+	if f == nil {
+		return 0, filterError("invalid filter: empty condition")
+	}
+	if depth > FilterMaxDepth {
+		return 0, filterError("filter is nested too deeply, max depth is %d", FilterMaxDepth)
+	}
+	kinds := 0
+	for _, set := range []bool{f.And != nil, f.Or != nil, f.Not != nil, len(f.Field) > 0 || len(f.Op) > 0} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return 0, filterError("invalid filter: a condition must have exactly one of and, or, not, field")
+	}
+	children := f.And
+	switch {
+	case f.Or != nil:
+		children = f.Or
+	case f.Not != nil:
+		children = []*Filter{f.Not}
+	case len(f.Field) > 0 || len(f.Op) > 0:
+		if len(f.Field) == 0 || len(f.Op) == 0 {
+			return 0, filterError("invalid filter: field and op are required")
+		}
+		return 1, nil
+	}
+	if len(children) == 0 {
+		return 0, filterError("invalid filter: empty group")
+	}
+	total := 0
+	for _, child := range children {
+		n, err := child.check(depth + 1)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	if total > FilterMaxConditions {
+		return 0, filterError("filter has too many conditions, max is %d", FilterMaxConditions)
+	}
+	return total, nil
+}
+
+// filterParser 简写形式的解析
+type filterParser struct {
+	input string
+	pos   int
+}
+
+func (p *filterParser) parse() (*Filter, error) {
+	list, err := p.parseList(1)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.input) {
+		return nil, p.error("unexpected %q", p.input[p.pos])
+	}
+	if len(list) == 1 {
+		return list[0], nil
+	}
+	return &Filter{And: list}, nil
+}
+
+func (p *filterParser) error(format string, args ...interface{}) error {
+	return filterError("invalid filter at %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *filterParser) skipSpace() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *filterParser) peek() byte {
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+// parseList 逗号分隔的条件, 到 ) 或结尾为止
+func (p *filterParser) parseList(depth int) ([]*Filter, error) {
+	//解析时即检查层数, 避免过深的递归
+	if depth > FilterMaxDepth {
+		return nil, filterError("filter is nested too deeply, max depth is %d", FilterMaxDepth)
+	}
+	list := make([]*Filter, 0)
+	for {
+		f, err := p.parseExpr(depth)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, f)
+		if len(list) > FilterMaxConditions {
+			return nil, filterError("filter has too many conditions, max is %d", FilterMaxConditions)
+		}
+		p.skipSpace()
+		if p.peek() != ',' {
+			return list, nil
+		}
+		p.pos++
+	}
+}
+
+// parseExpr and(...) or(...) not(...) 或 field:op[:value]
+func (p *filterParser) parseExpr(depth int) (*Filter, error) {
+	p.skipSpace()
+	name := p.parseName()
+	if len(name) == 0 {
+		if p.pos < len(p.input) {
+			return nil, p.error("unexpected %q", p.input[p.pos])
+		}
+		return nil, p.error("unexpected end")
+	}
+	if p.peek() == '(' {
+		group := strings.ToLower(name)
+		if group != "and" && group != "or" && group != "not" {
+			return nil, p.error("unknown group %q", name)
+		}
+		p.pos++
+		list, err := p.parseList(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.peek() != ')' {
+			return nil, p.error("missing )")
+		}
+		p.pos++
+		switch group {
+		case "and":
+			return &Filter{And: list}, nil
+		case "or":
+			return &Filter{Or: list}, nil
+		}
+		if len(list) == 1 {
+			return &Filter{Not: list[0]}, nil
+		}
+		return &Filter{Not: &Filter{And: list}}, nil
+	}
+	if p.peek() != ':' {
+		return nil, p.error("missing operator of %q", name)
+	}
+	p.pos++
+	op := p.parseName()
+	if len(op) == 0 {
+		return nil, p.error("missing operator of %q", name)
+	}
+	f := &Filter{Field: name, Op: op}
+	if p.peek() != ':' {
+		return f, nil
+	}
+	p.pos++
+	values, err := p.parseValues()
+	if err != nil {
+		return nil, err
+	}
+	base := strings.ToLower(strings.TrimSpace(strings.Split(op, ";")[0]))
+	if base == QueryIn || base == QueryBetween || len(values) > 1 {
+		f.Value = values
+	} else {
+		f.Value = values[0]
+	}
+	return f, nil
+}
+
+// parseName 字段名、操作符或分组名
+func (p *filterParser) parseName() string {
+	start := p.pos
+	for p.pos < len(p.input) && !strings.ContainsRune(":(),|\"", rune(p.input[p.pos])) {
+		p.pos++
+	}
+	return strings.TrimSpace(p.input[start:p.pos])
+}
+
+// parseValues | 分隔的值, 值可用双引号
+func (p *filterParser) parseValues() ([]interface{}, error) {
+	values := make([]interface{}, 0)
+	for {
+		p.skipSpace()
+		if p.peek() == '"' {
+			value, err := p.parseQuoted()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			p.skipSpace()
+		} else {
+			start := p.pos
+			for p.pos < len(p.input) && !strings.ContainsRune(",)|", rune(p.input[p.pos])) {
+				p.pos++
+			}
+			values = append(values, strings.TrimSpace(p.input[start:p.pos]))
+		}
+		if p.peek() != '|' {
+			return values, nil
+		}
+		p.pos++
+		if len(values) >= FilterMaxValues {
+			return nil, filterError("filter has too many values, max is %d", FilterMaxValues)
+		}
+	}
+}
+
+func (p *filterParser) parseQuoted() (string, error) {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.input) {
+		switch p.input[p.pos] {
+		case '\\':
+			p.pos += 2
+			continue
+		case '"':
+			p.pos++
+			value, err := strconv.Unquote(p.input[start:p.pos])
+			if err != nil {
+				return "", p.error("invalid quoted value %s", p.input[start:p.pos])
+			}
+			return value, nil
+		}
+		p.pos++
+	}
+	p.pos = start
+	return "", p.error("unterminated quoted value")
+}
+
+// filterableFields 模型声明的可过滤字段, nil 表示不限制(敏感列除外)
+func filterableFields(m ModelInterface, s *schema.Schema) []*schema.Field {
+	fields := make([]*schema.Field, 0)
+	if filterable, ok := m.(FilterableInterface); ok {
+		for _, name := range filterable.FilterableFields() {
+			if field := LookUpField(s, name); field != nil {
+				fields = append(fields, field)
+			}
+		}
+	}
+	for _, field := range s.Fields {
+		if len(field.DBName) > 0 && field.StructField.Tag.Get("filterable") == "true" {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// CompileFilter 校验过滤条件并转换为 gorm 条件, 字段须为模型的可过滤字段, engine 为模型所在数据库
+// 未知字段、操作符或值的类型不符时返回 ErrValidation
+func CompileFilter(engine string, m ModelInterface, f *Filter) (clause.Expression, error) {
+	if f == nil {
+		return nil, nil
+	}
+	s, err := EngineModelSchema(engine, m)
+	if err != nil {
+		return nil, err
+	}
+	return compileFilter(m, s, f)
+}
+
+// compileFilter 见 CompileFilter, s 为 m 的 schema
+func compileFilter(m ModelInterface, s *schema.Schema, f *Filter) (clause.Expression, error) {
+	if f == nil {
+		return nil, nil
+	}
+	if _, err := f.check(1); err != nil {
+		return nil, err
+	}
+	return f.compile(s, filterableFields(m, s))
+}
+
+func (f *Filter) compile(s *schema.Schema, allowed []*schema.Field) (clause.Expression, error) {
+	compileList := func(list []*Filter) ([]clause.Expression, error) {
+		exprs := make([]clause.Expression, 0, len(list))
+		for _, item := range list {
+			expr, err := item.compile(s, allowed)
+			if err != nil {
+				return nil, err
+			}
+			exprs = append(exprs, expr)
+		}
+		return exprs, nil
+	}
+	switch {
+	case f.And != nil:
+		exprs, err := compileList(f.And)
+		if err != nil {
+			return nil, err
+		}
+		return clause.And(exprs...), nil
+	case f.Or != nil:
+		exprs, err := compileList(f.Or)
+		if err != nil {
+			return nil, err
+		}
+		//只有一个条件的 OrConditions 会以 OR 连接到前面的条件
+		if len(exprs) == 1 {
+			return exprs[0], nil
+		}
+		return clause.Or(exprs...), nil
+	case f.Not != nil:
+		expr, err := f.Not.compile(s, allowed)
+		if err != nil {
+			return nil, err
+		}
+		return clause.Not(expr), nil
+	}
+	return f.compileField(s, allowed)
+}
+
+// compileField 单个字段条件, 按 query 标签的操作符生成
+func (f *Filter) compileField(s *schema.Schema, allowed []*schema.Field) (clause.Expression, error) {
+	field := LookUpField(s, f.Field)
+	if field == nil {
+		return nil, filterError("unknown filter field %q", f.Field)
+	}
+	if !isFilterable(allowed, field) {
+		return nil, filterError("field %q is not filterable", f.Field)
+	}
+	qf := queryField{name: f.Field}
+	for i, item := range strings.Split(f.Op, ";") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		switch {
+		case i == 0:
+			qf.op = item
+		case item == queryOptCi:
+			qf.ci = true
+		default:
+			return nil, filterError("unknown option %q of filter operator %q", item, f.Op)
+		}
+	}
+	var value interface{}
+	var err error
+	switch qf.op {
+	case QueryIsNull, QueryNotNull:
+		if f.Value != nil {
+			return nil, filterError("filter operator %s of %q takes no value", qf.op, f.Field)
+		}
+		value = true
+	case QueryIn, QueryBetween:
+		value, err = filterValues(field, qf.op, f.Value)
+	case QueryLike, QueryPrefix, QuerySuffix:
+		//gorm 的 type 标签会覆盖 DataType, 按 Go 类型判断
+		if field.IndirectFieldType.Kind() != reflect.String {
+			return nil, filterError("filter operator %s requires a string field, %q is not", qf.op, f.Field)
+		}
+		value, err = filterValue(field, f.Value)
+	case QueryEq, QueryNe, QueryGt, QueryGte, QueryLt, QueryLte:
+		value, err = filterValue(field, f.Value)
+	default:
+		return nil, filterError("unknown filter operator %q", f.Op)
+	}
+	if err != nil {
+		return nil, err
+	}
+	expr, err := queryExpression(qf, field.DBName, reflect.ValueOf(value))
+	if err != nil {
+		return nil, filterError("%v", err)
+	}
+	if expr == nil {
+		return nil, filterError("filter condition of %q has no value", f.Field)
+	}
+	return expr, nil
+}
+
+// isFilterable 同 isSortable: 敏感字段不可过滤; 模型未声明可过滤字段时, json:"-" 的字段不可过滤
+func isFilterable(allowed []*schema.Field, field *schema.Field) bool {
+	if IsSensitiveField(field) {
+		return false
+	}
+	if allowed == nil {
+		return len(JsonName(field)) > 0
+	}
+	return containsField(allowed, field)
+}
+
+// filterValues in/between 的值, 可为数组或逗号分隔的字符串
+func filterValues(field *schema.Field, op string, value interface{}) ([]interface{}, error) {
+	var items []interface{}
+	switch v := value.(type) {
+	case []interface{}:
+		items = v
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			items = append(items, strings.TrimSpace(item))
+		}
+	default:
+		if rv := reflect.ValueOf(value); rv.Kind() == reflect.Slice {
+			for i := 0; i < rv.Len(); i++ {
+				items = append(items, rv.Index(i).Interface())
+			}
+		} else {
+			items = []interface{}{value}
+		}
+	}
+	switch {
+	case op == QueryBetween && len(items) != 2:
+		return nil, filterError("filter operator between of %q requires two values, got %d", field.Name, len(items))
+	case len(items) == 0:
+		return nil, filterError("filter operator in of %q requires values", field.Name)
+	case len(items) > FilterMaxValues:
+		return nil, filterError("filter has too many values, max is %d", FilterMaxValues)
+	}
+	values := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		v, err := filterValue(field, item)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// filterValue 按字段类型转换值, 简写形式与 JSON 的值统一转换
+func filterValue(field *schema.Field, value interface{}) (interface{}, error) {
+	switch value.(type) {
+	case nil:
+		return nil, filterError("filter field %q requires a value, use isnull for null", field.Name)
+	case []interface{}, map[string]interface{}:
+		return nil, filterError("filter value of %q must be a scalar", field.Name)
+	}
+	s := fmt.Sprint(value)
+	v, err := parseFieldValue(field, s)
+	if err != nil {
+		return nil, filterError("invalid filter value %q of %q", s, field.Name)
+	}
+	return v, nil
+}
+
+// parseFieldValue 按字段类型解析字符串, 数值与布尔类型之外原样返回
+func parseFieldValue(field *schema.Field, s string) (interface{}, error) {
+	t := field.FieldType
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(s, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(s, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(s, 64)
+	case reflect.Bool:
+		return strconv.ParseBool(s)
+	}
+	return s, nil
+}
+
+// FilterScope 按 filter 参数过滤, 格式见 ParseFilter
+func FilterScope(m ModelInterface, filter string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		whereFilter(db, m, filter)
+		return db
+	}
+}
+
+func whereFilter(db *gorm.DB, m ModelInterface, filter string) {
+	f, err := ParseFilter(filter)
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	s, err := dbModelSchema(db, m)
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	expr, err := compileFilter(m, s, f)
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	if expr != nil {
+		db.Where(expr)
+	}
+}
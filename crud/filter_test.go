@@ -0,0 +1,164 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// nestedFilter n 层嵌套的 or(...) 条件
+func nestedFilter(n int) string {
+	return strings.Repeat("or(", n) + "age:eq:1" + strings.Repeat(")", n)
+}
+
+// nestedJsonFilter n 层嵌套的 not 条件
+func nestedJsonFilter(n int) string {
+	return strings.Repeat(`{"not":`, n) + `{"field":"age","op":"eq","value":1}` + strings.Repeat("}", n)
+}
+
+func repeatFilter(item, sep string, n int) string {
+	items := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		items = append(items, strings.ReplaceAll(item, "$i", strconv.Itoa(i)))
+	}
+	return strings.Join(items, sep)
+}
+
+func TestParseFilter(t *testing.T) {
+	cases := []struct {
+		name   string
+		filter string
+		want   string // 解析结果的 JSON, * 表示只要求解析成功, 为空时期望 ErrValidation
+	}{
+		{"empty", "  ", "null"},
+		{"single", "status:eq:1", `{"field":"status","op":"eq","value":"1"}`},
+		{"and", "status:eq:1, age:gte:18", `{"and":[{"field":"status","op":"eq","value":"1"},{"field":"age","op":"gte","value":"18"}]}`},
+		{"or", "or(username:like:foo,age:gte:18)", `{"or":[{"field":"username","op":"like","value":"foo"},{"field":"age","op":"gte","value":"18"}]}`},
+		{"not", "NOT(remark:isnull)", `{"not":{"field":"remark","op":"isnull"}}`},
+		{"not list", "not(age:eq:1,age:eq:2)", `{"not":{"and":[{"field":"age","op":"eq","value":"1"},{"field":"age","op":"eq","value":"2"}]}}`},
+		{"in", "id:in:1|2|3", `{"field":"id","op":"in","value":["1","2","3"]}`},
+		{"in single", "id:in:1", `{"field":"id","op":"in","value":["1"]}`},
+		{"between", "age:between:1 | 5", `{"field":"age","op":"between","value":["1","5"]}`},
+		{"option", "username:like;ci:Foo", `{"field":"username","op":"like;ci","value":"Foo"}`},
+		{"quoted", `username:eq:"a,b)|c"`, `{"field":"username","op":"eq","value":"a,b)|c"}`},
+		{"escaped quote", `username:eq:"a\"b"`, `{"field":"username","op":"eq","value":"a\"b"}`},
+		{"json object", `{"field":"age","op":"gte","value":18}`, `{"field":"age","op":"gte","value":18}`},
+		{"json array", `[{"field":"age","op":"gte","value":18},{"or":[{"field":"username","op":"eq","value":"a"},{"field":"username","op":"eq","value":"b"}]}]`,
+			`{"and":[{"field":"age","op":"gte","value":18},{"or":[{"field":"username","op":"eq","value":"a"},{"field":"username","op":"eq","value":"b"}]}]}`},
+		{"at max depth", nestedFilter(FilterMaxDepth - 1), "*"},
+		{"at max json depth", nestedJsonFilter(FilterMaxDepth - 1), "*"},
+		{"at max conditions", repeatFilter("age:eq:$i", ",", FilterMaxConditions), "*"},
+		{"at max values", "id:in:" + repeatFilter("$i", "|", FilterMaxValues), "*"},
+
+		{"missing )", "or(age:eq:1", ""},
+		{"unexpected )", "age:eq:1)", ""},
+		{"unknown group", "xor(age:eq:1)", ""},
+		{"missing operator", "age", ""},
+		{"empty operator", "age::1", ""},
+		{"empty condition", "age:eq:1,,age:eq:2", ""},
+		{"trailing comma", "age:eq:1,", ""},
+		{"unterminated quote", `username:eq:"abc`, ""},
+		{"json unknown field", `{"field":"age","op":"eq","bogus":1}`, ""},
+		{"json invalid", `{"field":`, ""},
+		{"json trailing data", `{"field":"age","op":"eq","value":1} {}`, ""},
+		{"json missing op", `{"field":"age"}`, ""},
+		{"json multiple kinds", `{"field":"age","op":"eq","not":{"field":"age","op":"eq"}}`, ""},
+		{"json empty group", `{"or":[]}`, ""},
+		{"json empty condition", `{}`, ""},
+		{"too deep", nestedFilter(FilterMaxDepth), ""},
+		{"too deep json", nestedJsonFilter(FilterMaxDepth), ""},
+		{"too many conditions", repeatFilter("age:eq:$i", ",", FilterMaxConditions+1), ""},
+		{"too many nested conditions", "or(" + repeatFilter("age:eq:$i", ",", FilterMaxConditions/2) + ")," + repeatFilter("age:eq:$i", ",", FilterMaxConditions/2+1), ""},
+		{"too many json conditions", "[" + repeatFilter(`{"field":"age","op":"eq","value":$i}`, ",", FilterMaxConditions+1) + "]", ""},
+		{"too many values", "id:in:" + repeatFilter("$i", "|", FilterMaxValues+1), ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f, err := ParseFilter(c.filter)
+			if len(c.want) == 0 {
+				if !errors.Is(err, ErrValidation) {
+					t.Fatalf("expected ErrValidation, got %v (%+v)", err, f)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.want == "*" {
+				return
+			}
+			data, _ := json.Marshal(f)
+			if string(data) != c.want {
+				t.Fatalf("unexpected filter\n got: %s\nwant: %s", data, c.want)
+			}
+		})
+	}
+}
+
+func TestCompileFilter(t *testing.T) {
+	newTestDb(t, new(testUser))
+	dao := &BaseDao{Model: new(testUser)}
+	ctx := context.Background()
+	for i, name := range []string{"alice", "bob", "carol", "Dave"} {
+		if err := dao.InsertContext(ctx, &testUser{Username: name, Password: "p", Age: 20 + i*10}, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cases := []struct {
+		name   string
+		filter string
+		want   []string // 为 nil 时期望 ErrValidation
+	}{
+		{"eq", "username:eq:bob", []string{"bob"}},
+		{"and", "age:gte:30,age:lt:50", []string{"bob", "carol"}},
+		{"or", "or(username:eq:alice,age:gt:40)", []string{"Dave", "alice"}},
+		{"not", "not(username:in:alice|bob)", []string{"Dave", "carol"}},
+		{"between", "age:between:30|40", []string{"bob", "carol"}},
+		{"like ci", "username:like;ci:DA", []string{"Dave"}},
+		{"prefix", "username:prefix:ca", []string{"carol"}},
+		{"json name", `{"field":"age","op":"eq","value":20}`, []string{"alice"}},
+		{"column name", "created_at:notnull,age:lt:30", []string{"alice"}},
+
+		{"unknown field", "nope:eq:1", nil},
+		{"sensitive field", "password:eq:p", nil},
+		{"json hidden field", "created_by:eq:1", nil},
+		{"json hidden field like", "deleted:like:0", nil},
+		{"unknown operator", "age:near:1", nil},
+		{"unknown option", "username:eq;x:a", nil},
+		{"like on int", "age:like:1", nil},
+		{"isnull with value", "age:isnull:1", nil},
+		{"between one value", "age:between:1", nil},
+		{"between three values", "age:between:1|2|3", nil},
+		{"invalid value", "age:eq:abc", nil},
+		{"missing value", `{"field":"age","op":"eq"}`, nil},
+		{"non scalar value", `{"field":"age","op":"eq","value":{"a":1}}`, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rows, err := dao.FindAllContext(ctx, new(testUser), &BaseQueryParams{Filter: c.filter})
+			if c.want == nil {
+				if !errors.Is(err, ErrValidation) {
+					t.Fatalf("expected ErrValidation, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := make([]string, 0)
+			for _, u := range rows.([]*testUser) {
+				names = append(names, u.Username)
+			}
+			sort.Strings(names)
+			if strings.Join(names, ",") != strings.Join(c.want, ",") {
+				t.Fatalf("expected %v, got %v", c.want, names)
+			}
+		})
+	}
+}
@@ -0,0 +1,384 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"gorm.io/gorm/schema"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	registeredDaos   = make(map[string]DAOInterface)
+	registeredDaosMu sync.RWMutex
+)
+
+// RegisterDao 注册 DAO, 按表名查找, 用于 Fixtures 等按表名操作的功能
+func RegisterDao(daos ...DAOInterface) {
+	registeredDaosMu.Lock()
+	defer registeredDaosMu.Unlock()
+	for _, dao := range daos {
+		registeredDaos[dao.GetModel().Table()] = dao
+	}
+}
+
+// LookUpDao 按表名查找注册的 DAO
+func LookUpDao(table string) (DAOInterface, bool) {
+	registeredDaosMu.RLock()
+	defer registeredDaosMu.RUnlock()
+	dao, ok := registeredDaos[table]
+	return dao, ok
+}
+
+// fixture 记录中的特殊字段
+const (
+	FixtureKeyField = "_key"  // 记录的引用名, 其他记录通过 "$ref:引用名" 引用其主键
+	FixtureRefValue = "$ref:" // 引用前缀
+)
+
+// fixtureRecord 一条待插入的记录
+type fixtureRecord struct {
+	table  string
+	key    string
+	values map[string]interface{}
+}
+
+// Fixtures 从 YAML/JSON 文件加载数据, 文件内容按表名分组:
+//
+//	sys_role:
+//	  - _key: admin_role
+//	    code: admin
+//	sys_user:
+//	  - username: admin
+//	    roleId: $ref:admin_role
+//
+// 字段按 json 名、字段名或列名赋值, 记录通过表名对应的 DAO(RegisterDao) 插入并执行 Insert 钩子;
+// 按自然键(NaturalKeys, 未设置时为模型的 ConflictColumns)判断记录已存在时跳过, 可重复加载
+type Fixtures struct {
+	Operator    int64
+	NaturalKeys map[string][]string // 表名 => 自然键列
+	Inserted    int                 // 插入的记录数, 加载失败回滚时不计入
+	Skipped     int                 // 已存在而跳过的记录数, 加载失败回滚时不计入
+	refs        map[string]ModelInterface
+}
+
+// NewFixtures 创建 Fixtures, operator 为插入记录的操作人
+func NewFixtures(operator int64) *Fixtures {
+	return &Fixtures{
+		Operator:    operator,
+		NaturalKeys: make(map[string][]string),
+		refs:        make(map[string]ModelInterface),
+	}
+}
+
+// Ref 取引用名对应的记录(已存在的记录为数据库中的数据)
+func (fixtures *Fixtures) Ref(key string) (ModelInterface, bool) {
+	m, ok := fixtures.refs[key]
+	return m, ok
+}
+
+// LoadFiles 在一个事务中加载文件, 按扩展名(.yaml/.yml/.json)解析, 目录则加载其中的全部文件
+// 记录按引用关系排序插入, 不同文件之间也可引用; 各表的 DAO 须使用同一数据库, 否则返回错误
+func (fixtures *Fixtures) LoadFiles(ctx context.Context, paths ...string) error {
+	records := make([]*fixtureRecord, 0)
+	for _, path := range paths {
+		files, err := fixtureFiles(path)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			parsed, err := parseFixtures(file, data)
+			if err != nil {
+				return fmt.Errorf("parse fixture %s failed: %w", file, err)
+			}
+			records = append(records, parsed...)
+		}
+	}
+	return fixtures.load(ctx, records)
+}
+
+// Load 在一个事务中加载数据, name 的扩展名决定格式, 同 LoadFiles 各表的 DAO 须使用同一数据库
+func (fixtures *Fixtures) Load(ctx context.Context, name string, data []byte) error {
+	records, err := parseFixtures(name, data)
+	if err != nil {
+		return fmt.Errorf("parse fixture %s failed: %w", name, err)
+	}
+	return fixtures.load(ctx, records)
+}
+
+// fixtureFiles 路径为目录时返回其中的 fixture 文件, 按文件名排序
+func fixtureFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0)
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".yaml", ".yml", ".json":
+			if !entry.IsDir() {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func parseFixtures(name string, data []byte) ([]*fixtureRecord, error) {
+	tables := make(map[string][]map[string]interface{})
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &tables); err != nil {
+			return nil, err
+		}
+	case ".json":
+		if err := json.Unmarshal(data, &tables); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported fixture format %q", filepath.Ext(name))
+	}
+	names := make([]string, 0, len(tables))
+	for table := range tables {
+		names = append(names, table)
+	}
+	sort.Strings(names)
+	records := make([]*fixtureRecord, 0)
+	for _, table := range names {
+		for _, values := range tables[table] {
+			record := &fixtureRecord{table: table, values: make(map[string]interface{}, len(values))}
+			for k, v := range values {
+				if k == FixtureKeyField {
+					record.key = fmt.Sprint(v)
+					continue
+				}
+				if !strings.HasPrefix(k, "_") {
+					record.values[k] = normalizeYamlValue(v)
+				}
+			}
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// normalizeYamlValue yaml.v2 的 map[interface{}]interface{} 转换为 map[string]interface{}, 便于转 json
+func normalizeYamlValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			m[fmt.Sprint(k)] = normalizeYamlValue(item)
+		}
+		return m
+	case []interface{}:
+		for i := range value {
+			value[i] = normalizeYamlValue(value[i])
+		}
+	}
+	return v
+}
+
+// load 按引用关系依次插入, 每轮插入引用已全部解析的记录
+func (fixtures *Fixtures) load(ctx context.Context, records []*fixtureRecord) error {
+	seen := make(map[string]bool)
+	for _, record := range records {
+		if len(record.key) == 0 {
+			continue
+		}
+		if seen[record.key] {
+			return fmt.Errorf("duplicate fixture key %q", record.key)
+		}
+		seen[record.key] = true
+	}
+	//回滚时恢复计数与引用
+	inserted, skipped := fixtures.Inserted, fixtures.Skipped
+	refs := make(map[string]ModelInterface, len(fixtures.refs))
+	for k, m := range fixtures.refs {
+		refs[k] = m
+	}
+	engine, err := fixtureEngine(records)
+	if err != nil {
+		return err
+	}
+	err = WithEngineTx(ctx, engine, func(ctx context.Context) error {
+		for len(records) > 0 {
+			pending := make([]*fixtureRecord, 0)
+			for _, record := range records {
+				values, ok := fixtures.resolve(record.values)
+				if !ok {
+					pending = append(pending, record)
+					continue
+				}
+				if err := fixtures.insert(ctx, record, values); err != nil {
+					return fmt.Errorf("load fixture %s %s failed: %w", record.table, record.key, err)
+				}
+			}
+			if len(pending) == len(records) {
+				return fmt.Errorf("unresolved fixture references in %s, check for missing keys or cycles", pending[0].table)
+			}
+			records = pending
+		}
+		return nil
+	})
+	if err != nil {
+		fixtures.Inserted, fixtures.Skipped, fixtures.refs = inserted, skipped, refs
+	}
+	return err
+}
+
+// fixtureEngine 记录的 DAO 所在的数据库, 涉及多个数据库时无法在一个事务中加载, 返回错误
+func fixtureEngine(records []*fixtureRecord) (string, error) {
+	engine := ""
+	for _, record := range records {
+		dao, ok := LookUpDao(record.table)
+		if !ok {
+			//未注册的表在插入时返回错误
+			continue
+		}
+		name := engineName(ContextDao(dao).GetEngine())
+		if len(engine) > 0 && name != engine {
+			return "", fmt.Errorf("fixtures span database engines %q and %q, load them separately", engine, name)
+		}
+		engine = name
+	}
+	return engine, nil
+}
+
+// resolve 替换 "$ref:引用名" 为引用记录的主键, 有未插入的引用时返回 false
+func (fixtures *Fixtures) resolve(values map[string]interface{}) (map[string]interface{}, bool) {
+	resolved := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		var ok bool
+		if resolved[k], ok = fixtures.resolveValue(v); !ok {
+			return nil, false
+		}
+	}
+	return resolved, true
+}
+
+func (fixtures *Fixtures) resolveValue(v interface{}) (interface{}, bool) {
+	switch value := v.(type) {
+	case string:
+		if !strings.HasPrefix(value, FixtureRefValue) {
+			return v, true
+		}
+		m, ok := fixtures.refs[strings.TrimPrefix(value, FixtureRefValue)]
+		if !ok {
+			return nil, false
+		}
+		return m.GetId(), true
+	case []interface{}:
+		items := make([]interface{}, len(value))
+		for i := range value {
+			var ok bool
+			if items[i], ok = fixtures.resolveValue(value[i]); !ok {
+				return nil, false
+			}
+		}
+		return items, true
+	}
+	return v, true
+}
+
+// insert 按自然键判断是否已存在, 不存在时插入
+func (fixtures *Fixtures) insert(ctx context.Context, record *fixtureRecord, values map[string]interface{}) error {
+	dao, ok := LookUpDao(record.table)
+	if !ok {
+		return fmt.Errorf("no dao registered for table %s", record.table)
+	}
+	engine := ContextDao(dao).GetEngine()
+	m, err := fixtureModel(ctx, engine, dao.GetModel(), values)
+	if err != nil {
+		return err
+	}
+	keys := fixtures.NaturalKeys[record.table]
+	if len(keys) == 0 {
+		if cm, ok := m.(ConflictColumnsInterface); ok {
+			keys = cm.ConflictColumns()
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no natural key for table %s, set NaturalKeys or implement ConflictColumns", record.table)
+	}
+	cond, err := columnCondition(ctx, engine, m, keys)
+	if err != nil {
+		return err
+	}
+	existing, err := ContextDao(dao).FindOneByColumnsContext(ctx, cond)
+	switch {
+	case err == nil:
+		fixtures.Skipped++
+		m = existing
+	case errors.Is(err, ErrNotFound):
+		if err = InsertWithHooks(ctx, dao, m, fixtures.Operator); err != nil {
+			return err
+		}
+		fixtures.Inserted++
+	default:
+		return err
+	}
+	if len(record.key) > 0 {
+		fixtures.refs[record.key] = m
+	}
+	return nil
+}
+
+// fixtureModel 按 json 名、字段名或列名(见 LookUpField)给模型赋值, json:"-" 的字段也可赋值, engine 为模型所在数据库
+func fixtureModel(ctx context.Context, engine string, model ModelInterface, values map[string]interface{}) (ModelInterface, error) {
+	s, err := EngineModelSchema(engine, model)
+	if err != nil {
+		return nil, err
+	}
+	m := NewModelOf(model)
+	rv := reflect.ValueOf(m)
+	for name, v := range values {
+		field := LookUpField(s, name)
+		if field == nil {
+			return nil, fmt.Errorf("unknown field %q on %s", name, model.Table())
+		}
+		if err = setFixtureValue(ctx, field, rv, v); err != nil {
+			return nil, fmt.Errorf("invalid value for %q: %w", name, err)
+		}
+	}
+	return m, nil
+}
+
+// setFixtureValue 基本类型直接赋值, 对象与数组等按 json 转换为字段类型后赋值
+func setFixtureValue(ctx context.Context, field *schema.Field, rv reflect.Value, v interface{}) error {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+	default:
+		return field.Set(ctx, rv, v)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	ptr := reflect.New(field.FieldType)
+	if err = json.Unmarshal(data, ptr.Interface()); err != nil {
+		return err
+	}
+	return field.Set(ctx, rv, ptr.Elem().Interface())
+}
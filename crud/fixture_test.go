@@ -0,0 +1,143 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// fixtureUser 含 json:"-" 字段及自引用
+type fixtureUser struct {
+	BaseModel
+	ModelFactory[fixtureUser]
+	Username string `gorm:"TYPE:VARCHAR(50)" json:"username"`
+	Secret   string `gorm:"TYPE:VARCHAR(50)" json:"-"`
+	ParentId int64  `json:"parentId"`
+	TailColumns
+}
+
+func (*fixtureUser) Table() string { return "fixture_users" }
+
+func (*fixtureUser) ConflictColumns() []string { return []string{"username"} }
+
+const fixtureYaml = `
+fixture_users:
+  - _key: child
+    username: child
+    parentId: $ref:root
+  - _key: root
+    username: root
+    secret: s3cret
+    status: "0"
+`
+
+func TestFixturesLoad(t *testing.T) {
+	newTestDb(t, new(fixtureUser))
+	RegisterDao(&BaseDao{Model: new(fixtureUser)})
+	ctx := context.Background()
+
+	fixtures := NewFixtures(1)
+	if err := fixtures.Load(ctx, "users.yaml", []byte(fixtureYaml)); err != nil {
+		t.Fatal(err)
+	}
+	if fixtures.Inserted != 2 || fixtures.Skipped != 0 {
+		t.Fatalf("unexpected counters inserted=%d skipped=%d", fixtures.Inserted, fixtures.Skipped)
+	}
+	root, child := new(fixtureUser), new(fixtureUser)
+	if err := DbSess().Where("username = ?", "root").First(root).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := DbSess().Where("username = ?", "child").First(child).Error; err != nil {
+		t.Fatal(err)
+	}
+	if root.Secret != "s3cret" || root.Status != FlagNo || root.CreatedBy != 1 {
+		t.Fatalf("fields not set: %+v", root)
+	}
+	if child.ParentId != root.Id {
+		t.Fatalf("reference not resolved: parentId=%d, root=%d", child.ParentId, root.Id)
+	}
+
+	//重复加载时跳过
+	again := NewFixtures(1)
+	if err := again.Load(ctx, "users.yaml", []byte(fixtureYaml)); err != nil {
+		t.Fatal(err)
+	}
+	if again.Inserted != 0 || again.Skipped != 2 {
+		t.Fatalf("unexpected counters inserted=%d skipped=%d", again.Inserted, again.Skipped)
+	}
+}
+
+func TestFixturesRollback(t *testing.T) {
+	newTestDb(t, new(fixtureUser))
+	RegisterDao(&BaseDao{Model: new(fixtureUser)})
+	ctx := context.Background()
+	fixtures := NewFixtures(1)
+	cases := []struct {
+		name string
+		data string
+	}{
+		{"unknown field", "fixture_users:\n  - _key: a\n    username: a\n  - username: b\n    nope: 1\n"},
+		{"unknown table", "fixture_users:\n  - _key: a\n    username: a\nmissing_table:\n  - code: x\n"},
+		{"invalid value", "fixture_users:\n  - _key: a\n    username: a\n  - username: b\n    parentId: abc\n"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := fixtures.Load(ctx, "bad.yaml", []byte(c.data)); err == nil {
+				t.Fatal("expected error")
+			}
+			if fixtures.Inserted != 0 || fixtures.Skipped != 0 {
+				t.Fatalf("counters not reset: inserted=%d skipped=%d", fixtures.Inserted, fixtures.Skipped)
+			}
+			if _, ok := fixtures.Ref("a"); ok {
+				t.Fatal("reference to rolled back record kept")
+			}
+			var count int64
+			if err := DbSess().Model(new(fixtureUser)).Count(&count).Error; err != nil || count != 0 {
+				t.Fatalf("expected no rows, got %d: %v", count, err)
+			}
+		})
+	}
+}
+
+func TestFixturesEngine(t *testing.T) {
+	newTestDb(t)
+	db := openTestDb(t, new(fixtureUser))
+	RegisterDbEngine("fixtures", db)
+	RegisterDao(&BaseDao{Model: new(fixtureUser), Engine: "fixtures"})
+	ctx := context.Background()
+
+	fixtures := NewFixtures(1)
+	bad := "fixture_users:\n  - _key: a\n    username: a\n  - username: b\n    parentId: abc\n"
+	if err := fixtures.Load(ctx, "bad.yaml", []byte(bad)); err == nil {
+		t.Fatal("expected error")
+	}
+	var count int64
+	if err := db.Model(new(fixtureUser)).Count(&count).Error; err != nil || count != 0 {
+		t.Fatalf("expected the load to roll back on the dao's engine, got %d rows: %v", count, err)
+	}
+
+	if err := fixtures.Load(ctx, "users.yaml", []byte(fixtureYaml)); err != nil {
+		t.Fatal(err)
+	}
+	root, child := new(fixtureUser), new(fixtureUser)
+	if err := db.Where("username = ?", "root").First(root).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Where("username = ?", "child").First(child).Error; err != nil {
+		t.Fatal(err)
+	}
+	if child.ParentId != root.Id {
+		t.Fatalf("reference not resolved: parentId=%d, root=%d", child.ParentId, root.Id)
+	}
+
+	RegisterDao(&BaseDao{Model: new(testUser)})
+	mixed := "fixture_users:\n  - username: c\ntest_users:\n  - username: d\n"
+	if err := NewFixtures(1).Load(ctx, "mixed.yaml", []byte(mixed)); err == nil || !strings.Contains(err.Error(), "span database engines") {
+		t.Fatalf("expected an error for fixtures on several engines, got %v", err)
+	}
+	if err := db.Model(new(fixtureUser)).Where("username = ?", "c").Count(&count).Error; err != nil || count != 0 {
+		t.Fatalf("expected nothing loaded, got %d rows: %v", count, err)
+	}
+}
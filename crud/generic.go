@@ -0,0 +1,138 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Page 分页结果
+type Page[T any] struct {
+	Rows []T      `json:"rows"`
+	Page PageData `json:"page"`
+}
+
+// DaoInterface 泛型 DAO, T 为模型指针类型, 如 *User
+type DaoInterface[T ModelInterface] interface {
+	DAOInterface
+	DAOContextInterface
+	// Get 根据主键查询, 记录不存在时返回 ErrNotFound
+	Get(ctx context.Context, pk interface{}) (T, error)
+	// GetByColumn 根据某列查询, 记录不存在时返回 ErrNotFound
+	GetByColumn(ctx context.Context, column string, value interface{}) (T, error)
+	List(ctx context.Context, modelParams T, baseParams *BaseQueryParams) ([]T, error)
+	Page(ctx context.Context, modelParams T, baseParams *BaseQueryParams) (Page[T], error)
+	All(ctx context.Context, modelParams T, baseParams *BaseQueryParams) ([]T, error)
+	ListByColumn(ctx context.Context, column string, value interface{}) ([]T, error)
+}
+
+// Dao 泛型 DAO, 内嵌 BaseDao, 钩子等用法与 BaseDao 一致
+type Dao[T ModelInterface] struct {
+	BaseDao
+}
+
+// NewDao 创建泛型 DAO, 模型可内嵌 ModelFactory 实现 NewModel/NewModels
+func NewDao[T ModelInterface]() *Dao[T] {
+	var zero T
+	m := reflect.New(reflect.TypeOf(zero).Elem()).Interface().(ModelInterface)
+	return &Dao[T]{
+		BaseDao: BaseDao{Model: m},
+	}
+}
+
+// Get 根据主键查询
+func (dao *Dao[T]) Get(ctx context.Context, pk interface{}) (T, error) {
+	m, err := dao.FindByPkContext(ctx, pk)
+	return asModel[T](m, err)
+}
+
+// GetByColumn 根据某列查询
+func (dao *Dao[T]) GetByColumn(ctx context.Context, column string, value interface{}) (T, error) {
+	m, err := dao.FindOneByColumnContext(ctx, column, value)
+	return asModel[T](m, err)
+}
+
+// List 查询
+func (dao *Dao[T]) List(ctx context.Context, modelParams T, baseParams *BaseQueryParams) ([]T, error) {
+	rows, err := dao.FindListContext(ctx, modelParams, baseParams)
+	return asModels[T](rows, err)
+}
+
+// Page 分页查询
+func (dao *Dao[T]) Page(ctx context.Context, modelParams T, baseParams *BaseQueryParams) (Page[T], error) {
+	rows, pageData, err := dao.FindPageContext(ctx, modelParams, baseParams)
+	models, err := asModels[T](rows, err)
+	return Page[T]{Rows: models, Page: pageData}, err
+}
+
+// All 查询全部
+func (dao *Dao[T]) All(ctx context.Context, modelParams T, baseParams *BaseQueryParams) ([]T, error) {
+	rows, err := dao.FindAllContext(ctx, modelParams, baseParams)
+	return asModels[T](rows, err)
+}
+
+// ListByColumn 根据某列查询
+func (dao *Dao[T]) ListByColumn(ctx context.Context, column string, value interface{}) ([]T, error) {
+	rows, err := dao.FindListByColumnContext(ctx, column, value)
+	return asModels[T](rows, err)
+}
+
+// asModel 将查询结果转换为 T, 类型不符时返回错误
+func asModel[T ModelInterface](m ModelInterface, err error) (T, error) {
+	var zero T
+	if err != nil {
+		return zero, err
+	}
+	if t, ok := m.(T); ok {
+		return t, nil
+	}
+	return zero, fmt.Errorf("model %T is not %s", m, reflect.TypeOf(&zero).Elem())
+}
+
+// asModels 将 NewModels 返回的切片转换为 []T
+// 兼容 []T / *[]T 及元素为结构体的 []User / *[]User(取元素的指针), 其他类型返回错误
+func asModels[T ModelInterface](rows interface{}, err error) ([]T, error) {
+	switch v := rows.(type) {
+	case []T:
+		return v, err
+	case *[]T:
+		if v != nil {
+			return *v, err
+		}
+		return make([]T, 0), err
+	case nil:
+		return make([]T, 0), err
+	}
+	var zero T
+	t := reflect.TypeOf(&zero).Elem()
+	rv := reflect.ValueOf(rows)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Slice {
+		return make([]T, 0), convertError(err, fmt.Errorf("rows %T is not a slice of %s", rows, t))
+	}
+	result := make([]T, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		elem := rv.Index(i)
+		switch {
+		case elem.Type().AssignableTo(t):
+			result = append(result, elem.Interface().(T))
+		case elem.Addr().Type().AssignableTo(t):
+			result = append(result, elem.Addr().Interface().(T))
+		default:
+			return make([]T, 0), convertError(err, fmt.Errorf("rows %T is not a slice of %s", rows, t))
+		}
+	}
+	return result, err
+}
+
+// convertError 查询出错时返回查询的错误, 否则返回转换的错误
+func convertError(err, convertErr error) error {
+	if err != nil {
+		return err
+	}
+	return convertErr
+}
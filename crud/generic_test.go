@@ -0,0 +1,81 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"testing"
+)
+
+// valueUser NewModels 返回 []valueUser
+type valueUser struct {
+	BaseModel
+	ModelFactory[valueUser]
+	Username string `json:"username"`
+	TailColumns
+}
+
+func (*valueUser) Table() string { return "value_users" }
+
+func (*valueUser) NewModels() interface{} { return make([]valueUser, 0) }
+
+// ptrValueUser NewModels 返回 *[]ptrValueUser
+type ptrValueUser struct {
+	BaseModel
+	ModelFactory[ptrValueUser]
+	Username string `json:"username"`
+	TailColumns
+}
+
+func (*ptrValueUser) Table() string { return "ptr_value_users" }
+
+func (*ptrValueUser) NewModels() interface{} {
+	rows := make([]ptrValueUser, 0)
+	return &rows
+}
+
+func TestDaoListStructSlices(t *testing.T) {
+	db := newTestDb(t, new(valueUser), new(ptrValueUser))
+	db.Create(&valueUser{Username: "a"})
+	db.Create(&valueUser{Username: "b"})
+	db.Create(&ptrValueUser{Username: "c"})
+	ctx := context.Background()
+
+	//默认按 id 倒序
+	values, err := NewDao[*valueUser]().List(ctx, nil, nil)
+	if err != nil || len(values) != 2 || values[0].Username != "b" || values[1].Username != "a" {
+		t.Fatalf("[]valueUser: got %v, %v", values, err)
+	}
+	page, err := NewDao[*ptrValueUser]().Page(ctx, nil, nil)
+	if err != nil || len(page.Rows) != 1 || page.Rows[0].Username != "c" {
+		t.Fatalf("*[]ptrValueUser: got %v, %v", page.Rows, err)
+	}
+}
+
+func TestAsModelsMismatch(t *testing.T) {
+	if rows, err := asModels[*valueUser]([]*testUser{{}}, nil); err == nil || len(rows) != 0 {
+		t.Fatalf("expected error for []*testUser, got %v, %v", rows, err)
+	}
+	if rows, err := asModels[*valueUser](1, nil); err == nil || len(rows) != 0 {
+		t.Fatalf("expected error for int, got %v, %v", rows, err)
+	}
+	if _, err := asModel[*valueUser](new(testUser), nil); err == nil {
+		t.Fatal("expected error for *testUser")
+	}
+	if rows, err := asModels[*valueUser](nil, nil); err != nil || rows == nil {
+		t.Fatalf("nil rows: got %v, %v", rows, err)
+	}
+}
+
+func TestModelFactory(t *testing.T) {
+	var m ModelInterface = new(testUser)
+	if n, ok := m.NewModel().(*testUser); !ok || n == nil {
+		t.Fatalf("expected a new *testUser, got %#v", m.NewModel())
+	}
+	if rows, ok := m.NewModels().([]*testUser); !ok || rows == nil {
+		t.Fatalf("expected an empty []*testUser, got %#v", m.NewModels())
+	}
+	if rows, ok := NewModelsOf(new(valueUser)).([]valueUser); !ok || rows == nil {
+		t.Fatalf("expected the model's own NewModels, got %#v", NewModelsOf(new(valueUser)))
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"fmt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// testUser 测试用模型
+type testUser struct {
+	BaseModel
+	ModelFactory[testUser]
+	Username string `gorm:"TYPE:VARCHAR(50);COMMENT:用户名" json:"username" form:"username" query:"eq"`
+	Password string `gorm:"TYPE:VARCHAR(100)" json:"password" sensitive:"true"`
+	Age      int    `json:"age" form:"age"`
+	TailColumns
+}
+
+func (*testUser) Table() string { return "test_users" }
+
+var testDbSeq int64
+
+// newTestDb 创建独立的内存 sqlite 数据库并注册为默认数据库, 建好 models 的表
+func newTestDb(t testing.TB, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db := openTestDb(t, models...)
+	InitDbEngine(db)
+	return db
+}
+
+// openTestDb 创建独立的内存 sqlite 数据库, 建好 models 的表, 不注册
+func openTestDb(t testing.TB, models ...interface{}) *gorm.DB {
+	t.Helper()
+	dsn := fmt.Sprintf("file:test%d?mode=memory&cache=shared", atomic.AddInt64(&testDbSeq, 1))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// sqlCounter 统计执行的语句
+type sqlCounter struct {
+	statements []string
+}
+
+// countSql 在 db 上注册回调, 记录之后执行的语句
+func countSql(db *gorm.DB) *sqlCounter {
+	counter := new(sqlCounter)
+	record := func(db *gorm.DB) {
+		counter.statements = append(counter.statements, db.Statement.SQL.String())
+	}
+	name := fmt.Sprintf("test:count%d", atomic.AddInt64(&testDbSeq, 1))
+	_ = db.Callback().Query().After("gorm:query").Register(name, record)
+	_ = db.Callback().Row().After("gorm:row").Register(name, record)
+	_ = db.Callback().Raw().After("gorm:raw").Register(name, record)
+	_ = db.Callback().Create().After("gorm:create").Register(name, record)
+	_ = db.Callback().Update().After("gorm:update").Register(name, record)
+	_ = db.Callback().Delete().After("gorm:delete").Register(name, record)
+	return counter
+}
+
+func (counter *sqlCounter) reset() {
+	counter.statements = nil
+}
+
+// count 以 prefix 开头(不区分大小写)的语句数
+func (counter *sqlCounter) count(prefix string) int {
+	n := 0
+	for _, statement := range counter.statements {
+		if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(statement)), strings.ToUpper(prefix)) {
+			n++
+		}
+	}
+	return n
+}
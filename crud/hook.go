@@ -0,0 +1,190 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"sync"
+)
+
+// 以下为可选的钩子接口, DAO 实现后替代对应的 BeforeXxx/AfterXxx,
+// ctx 中携带事务, 钩子内通过 DbSessContext(ctx) 或 DAO 的 *Context 方法读写即可参与同一事务
+//
+// 旧版钩子 BeforeXxx(m)/AfterXxx(m) 没有 ctx, 钩子内通过 HookSess(m) 读写即可参与同一事务;
+// 通过 DbSess() 或其他 DAO 的旧版方法的读写不在 *WithHooks 的事务中, 后续步骤失败时不会回滚
+
+type BeforeInsertContextHook interface {
+	BeforeInsertContext(ctx context.Context, m ModelInterface) error
+}
+
+type AfterInsertContextHook interface {
+	AfterInsertContext(ctx context.Context, m ModelInterface) error
+}
+
+type BeforeUpdateContextHook interface {
+	BeforeUpdateContext(ctx context.Context, m ModelInterface) error
+}
+
+type AfterUpdateContextHook interface {
+	AfterUpdateContext(ctx context.Context, m ModelInterface) error
+}
+
+type BeforeDeleteContextHook interface {
+	BeforeDeleteContext(ctx context.Context, m ModelInterface) error
+}
+
+type AfterDeleteContextHook interface {
+	AfterDeleteContext(ctx context.Context, m ModelInterface) error
+}
+
+type BeforeRemoveContextHook interface {
+	BeforeRemoveContext(ctx context.Context, m ModelInterface) error
+}
+
+type AfterRemoveContextHook interface {
+	AfterRemoveContext(ctx context.Context, m ModelInterface) error
+}
+
+// hookSessions 正在执行旧版钩子的模型 => 所在事务的会话, 见 HookSess
+var hookSessions sync.Map
+
+// HookSess 旧版钩子 BeforeXxx(m)/AfterXxx(m) 内使用的会话, m 为钩子的参数
+// 钩子由 *WithHooks 或批量操作调用时返回其事务, 否则同 DbSess()
+func HookSess(m ModelInterface) *gorm.DB {
+	if sess, ok := hookSessions.Load(m); ok {
+		return sess.(*gorm.DB)
+	}
+	return DbSess()
+}
+
+// legacyHook 执行旧版钩子, 执行期间 HookSess(m) 返回 ctx 中 dao 所在数据库的事务
+func legacyHook(ctx context.Context, dao DAOInterface, m ModelInterface, hook func(m ModelInterface) (bool, string)) error {
+	hookSessions.Store(m, EngineSessContext(ctx, ContextDao(dao).GetEngine()))
+	defer hookSessions.Delete(m)
+	return hookResult(hook(m))
+}
+
+// hookResult 将 (ok, msg) 形式的钩子结果转换为 error
+func hookResult(ok bool, msg string) error {
+	if ok {
+		return nil
+	}
+	return NewValidationError(msg)
+}
+
+func beforeInsert(ctx context.Context, dao DAOInterface, m ModelInterface) error {
+	if hook, ok := dao.(BeforeInsertContextHook); ok {
+		return hook.BeforeInsertContext(ctx, m)
+	}
+	return legacyHook(ctx, dao, m, dao.BeforeInsert)
+}
+
+func afterInsert(ctx context.Context, dao DAOInterface, m ModelInterface) error {
+	if hook, ok := dao.(AfterInsertContextHook); ok {
+		return hook.AfterInsertContext(ctx, m)
+	}
+	return legacyHook(ctx, dao, m, dao.AfterInsert)
+}
+
+func beforeUpdate(ctx context.Context, dao DAOInterface, m ModelInterface) error {
+	if hook, ok := dao.(BeforeUpdateContextHook); ok {
+		return hook.BeforeUpdateContext(ctx, m)
+	}
+	return legacyHook(ctx, dao, m, dao.BeforeUpdate)
+}
+
+func afterUpdate(ctx context.Context, dao DAOInterface, m ModelInterface) error {
+	if hook, ok := dao.(AfterUpdateContextHook); ok {
+		return hook.AfterUpdateContext(ctx, m)
+	}
+	return legacyHook(ctx, dao, m, dao.AfterUpdate)
+}
+
+func beforeDelete(ctx context.Context, dao DAOInterface, m ModelInterface) error {
+	if hook, ok := dao.(BeforeDeleteContextHook); ok {
+		return hook.BeforeDeleteContext(ctx, m)
+	}
+	return legacyHook(ctx, dao, m, dao.BeforeDelete)
+}
+
+func afterDelete(ctx context.Context, dao DAOInterface, m ModelInterface) error {
+	if hook, ok := dao.(AfterDeleteContextHook); ok {
+		return hook.AfterDeleteContext(ctx, m)
+	}
+	return legacyHook(ctx, dao, m, dao.AfterDelete)
+}
+
+func beforeRemove(ctx context.Context, dao DAOInterface, m ModelInterface) error {
+	if hook, ok := dao.(BeforeRemoveContextHook); ok {
+		return hook.BeforeRemoveContext(ctx, m)
+	}
+	return legacyHook(ctx, dao, m, dao.BeforeRemove)
+}
+
+func afterRemove(ctx context.Context, dao DAOInterface, m ModelInterface) error {
+	if hook, ok := dao.(AfterRemoveContextHook); ok {
+		return hook.AfterRemoveContext(ctx, m)
+	}
+	return legacyHook(ctx, dao, m, dao.AfterRemove)
+}
+
+// InsertWithHooks 在一个事务中执行 BeforeInsert -> Insert -> AfterInsert, 任一步失败则回滚
+// 钩子优先使用 BeforeInsertContextHook 等 ctx 版本, 旧版钩子内通过 HookSess(m) 的写入参与事务
+func InsertWithHooks(ctx context.Context, dao DAOInterface, m ModelInterface, operator int64) error {
+	cd := ContextDao(dao)
+	return WithEngineTx(ctx, cd.GetEngine(), func(ctx context.Context) error {
+		if err := beforeInsert(ctx, dao, m); err != nil {
+			return err
+		}
+		if err := cd.InsertContext(ctx, m, operator); err != nil {
+			return err
+		}
+		return afterInsert(ctx, dao, m)
+	})
+}
+
+// UpdateWithHooks 在一个事务中执行 BeforeUpdate -> Update -> AfterUpdate, 任一步失败则回滚
+// 钩子优先使用 BeforeUpdateContextHook 等 ctx 版本, 旧版钩子内通过 HookSess(m) 的写入参与事务
+func UpdateWithHooks(ctx context.Context, dao DAOInterface, m ModelInterface, operator int64) error {
+	cd := ContextDao(dao)
+	return WithEngineTx(ctx, cd.GetEngine(), func(ctx context.Context) error {
+		if err := beforeUpdate(ctx, dao, m); err != nil {
+			return err
+		}
+		if err := cd.UpdateContext(ctx, m, operator); err != nil {
+			return err
+		}
+		return afterUpdate(ctx, dao, m)
+	})
+}
+
+// DeleteWithHooks 在一个事务中执行 BeforeDelete -> Delete -> AfterDelete, 任一步失败则回滚
+// 钩子优先使用 BeforeDeleteContextHook 等 ctx 版本, 旧版钩子内通过 HookSess(m) 的写入参与事务
+func DeleteWithHooks(ctx context.Context, dao DAOInterface, m ModelInterface, operator int64) error {
+	cd := ContextDao(dao)
+	return WithEngineTx(ctx, cd.GetEngine(), func(ctx context.Context) error {
+		if err := beforeDelete(ctx, dao, m); err != nil {
+			return err
+		}
+		if err := cd.DeleteContext(ctx, m, operator); err != nil {
+			return err
+		}
+		return afterDelete(ctx, dao, m)
+	})
+}
+
+// RemoveWithHooks 在一个事务中执行 BeforeRemove -> Remove -> AfterRemove, 任一步失败则回滚
+// 钩子优先使用 BeforeRemoveContextHook 等 ctx 版本, 旧版钩子内通过 HookSess(m) 的写入参与事务
+func RemoveWithHooks(ctx context.Context, dao DAOInterface, m ModelInterface, operator int64) error {
+	cd := ContextDao(dao)
+	return WithEngineTx(ctx, cd.GetEngine(), func(ctx context.Context) error {
+		if err := beforeRemove(ctx, dao, m); err != nil {
+			return err
+		}
+		if err := cd.RemoveContext(ctx, m, operator); err != nil {
+			return err
+		}
+		return afterRemove(ctx, dao, m)
+	})
+}
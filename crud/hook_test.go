@@ -0,0 +1,51 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// hookUserDao 旧版钩子: 插入前通过 HookSess 写入一行, 插入后按 reject 拒绝
+type hookUserDao struct {
+	BaseDao
+	reject bool
+}
+
+func (dao *hookUserDao) BeforeInsert(m ModelInterface) (bool, string) {
+	if err := HookSess(m).Create(&testUser{Username: "hook"}).Error; err != nil {
+		return false, err.Error()
+	}
+	return true, ""
+}
+
+func (dao *hookUserDao) AfterInsert(ModelInterface) (bool, string) {
+	if dao.reject {
+		return false, "rejected"
+	}
+	return true, ""
+}
+
+func TestInsertWithLegacyHooks(t *testing.T) {
+	newTestDb(t, new(testUser))
+	ctx := context.Background()
+	dao := &hookUserDao{BaseDao: BaseDao{Model: new(testUser)}, reject: true}
+
+	err := InsertWithHooks(ctx, dao, &testUser{Username: "a"}, 1)
+	if !errors.Is(err, ErrValidation) {
+		t.Fatalf("expected ErrValidation, got %v", err)
+	}
+	if cnt, _ := dao.CountContext(ctx, "1 = 1"); cnt != 0 {
+		t.Fatalf("rejected insert: expected insert and hook write rolled back, got %d rows", cnt)
+	}
+
+	dao.reject = false
+	if err = InsertWithHooks(ctx, dao, &testUser{Username: "b"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if cnt, _ := dao.CountContext(ctx, "1 = 1"); cnt != 2 {
+		t.Fatalf("expected inserted row and hook row, got %d rows", cnt)
+	}
+}
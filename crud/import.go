@@ -0,0 +1,237 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/zhouhp1295/g3/helpers"
+	"gorm.io/gorm/schema"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// 导入方式
+const (
+	ImportInsert = "insert" // 只插入, 见 InsertBatch
+	ImportUpsert = "upsert" // 不存在时插入, 存在时更新, 见 UpsertWithHooks(乐观锁模型需提供版本号或使用 WithUpsertOverwrite)
+)
+
+// ImportMaxRows 最多导入的行数, 超过时返回 ErrValidation
+var ImportMaxRows = 10000
+
+// importSkipColumns 导入时忽略的系统列
+var importSkipColumns = []string{
+	"deleted", "created_at", "created_by", "updated_at", "updated_by",
+	TenantColumn, VersionColumn, DeletedAtColumn, DeletedByColumn,
+}
+
+// ImportReader 逐行读取导入的数据, 第一行为表头, 读完时返回 io.EOF; *csv.Reader 即可使用
+type ImportReader interface {
+	Read() (record []string, err error)
+}
+
+// ImportOptions 导入参数
+type ImportOptions struct {
+	Mode     string                       // insert(默认) upsert
+	DryRun   bool                         // 试运行, 执行校验、钩子与写入后回滚
+	Validate func(m ModelInterface) error // 写入前校验每行, 如 binding 标签
+}
+
+// ImportError 一行的错误
+type ImportError struct {
+	Row    int    `json:"row"`              // 文件中的行号, 表头为第 1 行
+	Column string `json:"column,omitempty"` // 出错的列(表头), 为空时为整行的错误
+	Msg    string `json:"msg"`
+}
+
+// ImportResult 导入结果
+type ImportResult struct {
+	Total     int           `json:"total"`     // 数据行数, 不含表头与空行
+	Succeeded int           `json:"succeeded"` // 成功的行数, 未提交时为可以成功的行数
+	Inserted  int           `json:"inserted"`
+	Updated   int           `json:"updated"`
+	Committed bool          `json:"committed"` // 是否已写入, 试运行或有错误整体回滚时为 false
+	Ignored   []string      `json:"ignored"`   // 未导入的列(表头)
+	Errors    []ImportError `json:"errors"`
+}
+
+func (result *ImportResult) fail(row int, column string, err error) {
+	msg := ValidationMessage(err)
+	if len(msg) == 0 {
+		msg = err.Error()
+	}
+	result.Errors = append(result.Errors, ImportError{Row: row, Column: column, Msg: msg})
+}
+
+// errImportRollback 试运行或整体回滚时用于回滚事务
+var errImportRollback = errors.New("import rollback")
+
+// ImportField 表头对应的字段: 当前语言与默认的表头(见 ExportHeader)、json 名、字段名或列名, 不区分大小写
+// 未知、系统列、标注 `import:"-"` 或不可导出(敏感、json:"-"、`export:"-"`, 见 isExportable)的字段返回 nil
+func ImportField(ctx context.Context, s *schema.Schema, header string) *schema.Field {
+	header = strings.TrimSpace(header)
+	if len(header) == 0 {
+		return nil
+	}
+	locale := LocaleFromContext(ctx)
+	for _, field := range s.Fields {
+		if len(field.DBName) == 0 {
+			continue
+		}
+		names := []string{ExportHeader(field, locale), ExportHeader(field, ""), JsonName(field), field.Name, field.DBName}
+		for _, name := range names {
+			if !strings.EqualFold(name, header) {
+				continue
+			}
+			if !isExportable(field) || field.StructField.Tag.Get("import") == "-" || helpers.IndexOf[string](importSkipColumns, field.DBName) >= 0 {
+				return nil
+			}
+			return field
+		}
+	}
+	return nil
+}
+
+// Import 导入数据, 每行转换为模型后按 options.Mode 写入, 执行 Insert/Update 钩子
+// 默认任一行失败时全部不写入, 仍校验并写入(后回滚)其余行以报告全部错误; ctx 设置 WithPartialBatch 时写入成功的行
+// 文件格式或表头有误时返回 ErrValidation, 有行失败且未写入时返回 ErrBatchFailed, 错误明细见 ImportResult.Errors
+func Import(ctx context.Context, dao DAOInterface, reader ImportReader, operator int64, options ImportOptions) (*ImportResult, error) {
+	mode := options.Mode
+	if len(mode) == 0 {
+		mode = ImportInsert
+	}
+	if mode != ImportInsert && mode != ImportUpsert {
+		return nil, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("unknown import mode %q", options.Mode)}
+	}
+	model := dao.GetModel()
+	s, err := EngineModelSchema(ContextDao(dao).GetEngine(), model)
+	if err != nil {
+		return nil, err
+	}
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, &DaoError{Kind: ErrValidation, Err: errors.New("empty file")}
+	}
+	if err != nil {
+		return nil, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("row 1: %v", err)}
+	}
+	result := &ImportResult{Ignored: make([]string, 0), Errors: make([]ImportError, 0)}
+	columns := make([]*schema.Field, len(header))
+	for i, name := range header {
+		field := ImportField(ctx, s, name)
+		if field == nil {
+			if len(strings.TrimSpace(name)) > 0 {
+				result.Ignored = append(result.Ignored, name)
+			}
+			continue
+		}
+		if containsField(columns, field) {
+			return nil, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("duplicate column %q", name)}
+		}
+		columns[i] = field
+	}
+
+	ms := make([]ModelInterface, 0)
+	rows := make([]int, 0) //ms 中各记录在文件中的行号
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("row %d: %v", row, err)}
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		if result.Total++; result.Total > ImportMaxRows {
+			return nil, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("too many rows, max is %d", ImportMaxRows)}
+		}
+		m := NewModelOf(model)
+		rv := reflect.ValueOf(m)
+		failed := false
+		for i, cell := range record {
+			cell = strings.TrimSpace(cell)
+			if i >= len(columns) || columns[i] == nil || len(cell) == 0 {
+				continue
+			}
+			v, err := parseFieldValue(columns[i], cell)
+			if err == nil {
+				err = columns[i].Set(ctx, rv, v)
+			}
+			if err != nil {
+				result.fail(row, header[i], &DaoError{Kind: ErrValidation, Err: fmt.Errorf("invalid value %q", cell)})
+				failed = true
+			}
+		}
+		if !failed && options.Validate != nil {
+			if err := options.Validate(m); err != nil {
+				result.fail(row, "", err)
+				failed = true
+			}
+		}
+		if !failed {
+			ms = append(ms, m)
+			rows = append(rows, row)
+		}
+	}
+
+	write := func(ctx context.Context) error {
+		var batch *BatchResult
+		var err error
+		inserted := 0
+		if mode == ImportUpsert {
+			batch, err = runBatch(ctx, dao, len(ms), func(ctx context.Context, batch *BatchResult, begin, end int) error {
+				for i := begin; i < end; i++ {
+					m := ms[i]
+					batchRecord(ctx, dao, batch, i, nil, func(ctx context.Context) error {
+						ok, err := UpsertWithHooks(ctx, dao, m, operator)
+						if err == nil && ok {
+							inserted++
+						}
+						return err
+					})
+				}
+				return nil
+			})
+		} else {
+			batch, err = InsertBatch(ctx, dao, ms, operator)
+			inserted = batch.Succeeded
+		}
+		for _, e := range batch.Errors {
+			result.Errors = append(result.Errors, ImportError{Row: rows[e.Index], Msg: e.Msg})
+		}
+		if err != nil {
+			return err
+		}
+		result.Succeeded = batch.Succeeded
+		result.Inserted = inserted
+		result.Updated = batch.Succeeded - inserted
+		return nil
+	}
+	if options.DryRun || (len(result.Errors) > 0 && !isPartialBatch(ctx)) {
+		//逐行写入以收集全部错误, 最后回滚
+		err = WithEngineTx(ctx, ContextDao(dao).GetEngine(), func(ctx context.Context) error {
+			if err := write(WithPartialBatch(ctx)); err != nil {
+				return err
+			}
+			return errImportRollback
+		})
+		if errors.Is(err, errImportRollback) {
+			err = nil
+		}
+	} else if err = write(ctx); err == nil {
+		result.Committed = true
+	}
+	sort.SliceStable(result.Errors, func(i, j int) bool {
+		return result.Errors[i].Row < result.Errors[j].Row
+	})
+	if err == nil && !result.Committed && !options.DryRun {
+		err = &DaoError{Kind: ErrBatchFailed, Err: fmt.Errorf("%d of %d rows failed", len(result.Errors), result.Total)}
+	}
+	return result, err
+}
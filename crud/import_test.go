@@ -0,0 +1,110 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// importUserDao 插入用户名为 bad 的记录时 AfterInsert 钩子失败
+type importUserDao struct {
+	BaseDao
+}
+
+func (dao *importUserDao) AfterInsert(m ModelInterface) (bool, string) {
+	if m.(*testUser).Username == "bad" {
+		return false, "rejected"
+	}
+	return true, ""
+}
+
+func TestImport(t *testing.T) {
+	cases := []struct {
+		name      string
+		csv       string
+		options   ImportOptions
+		partial   bool
+		err       error
+		succeeded int
+		inserted  int
+		updated   int
+		committed bool
+		errors    int
+		users     []string // 导入后的用户名, 按主键排序
+	}{
+		{
+			name:      "insert",
+			csv:       "username,age\ncarol,20\ndave,21\n",
+			succeeded: 2, inserted: 2, committed: true,
+			users: []string{"alice", "bob", "carol", "dave"},
+		},
+		{
+			name:      "upsert",
+			csv:       "id,username\n1,alice2\n,carol\n",
+			options:   ImportOptions{Mode: ImportUpsert},
+			succeeded: 2, inserted: 1, updated: 1, committed: true,
+			users: []string{"alice2", "bob", "carol"},
+		},
+		{
+			name:      "dry run",
+			csv:       "id,username\n1,alice2\n,carol\n",
+			options:   ImportOptions{Mode: ImportUpsert, DryRun: true},
+			succeeded: 2, inserted: 1, updated: 1,
+			users: []string{"alice", "bob"},
+		},
+		{
+			name:    "failed",
+			csv:     "id,username\n1,alice2\n,bad\n,carol\n",
+			options: ImportOptions{Mode: ImportUpsert},
+			err:     ErrBatchFailed,
+			errors:  1,
+			users:   []string{"alice", "bob"},
+		},
+		{
+			name:      "partial",
+			csv:       "id,username,age\n1,alice2,\n,bad,\n,carol,x\n2,bob2,\n,dave,\n",
+			options:   ImportOptions{Mode: ImportUpsert},
+			partial:   true,
+			succeeded: 3, inserted: 1, updated: 2, committed: true, errors: 2,
+			users: []string{"alice2", "bob2", "dave"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			newTestDb(t, new(testUser))
+			dao := &importUserDao{BaseDao: BaseDao{Model: new(testUser)}}
+			ctx := context.Background()
+			for _, name := range []string{"alice", "bob"} {
+				if err := dao.InsertContext(ctx, &testUser{Username: name}, 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if c.partial {
+				ctx = WithPartialBatch(ctx)
+			}
+			result, err := Import(ctx, dao, csv.NewReader(strings.NewReader(c.csv)), 1, c.options)
+			if c.err == nil && err != nil || c.err != nil && !errors.Is(err, c.err) {
+				t.Fatalf("expected error %v, got %v", c.err, err)
+			}
+			if result.Succeeded != c.succeeded || result.Inserted != c.inserted || result.Updated != c.updated ||
+				result.Committed != c.committed || len(result.Errors) != c.errors {
+				t.Fatalf("unexpected result %+v", result)
+			}
+			users := make([]*testUser, 0)
+			if err = dao.readSess(context.Background()).Order("id").Find(&users).Error; err != nil {
+				t.Fatal(err)
+			}
+			names := make([]string, 0, len(users))
+			for _, user := range users {
+				names = append(names, user.Username)
+			}
+			if strings.Join(names, ",") != strings.Join(c.users, ",") {
+				t.Fatalf("expected users %v, got %v", c.users, names)
+			}
+		})
+	}
+}
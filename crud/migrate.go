@@ -6,11 +6,17 @@ import (
 	"fmt"
 	"gorm.io/gorm"
 	"strings"
+	"time"
 )
 
+// Migration 迁移记录, Version 为 0 的记录由 DoMigrate 写入
 type Migration struct {
 	BaseModel
-	Code string `gorm:"TYPE:VARCHAR(100);UNIQUE;COMMENT:编号"`
+	Code      string     `gorm:"TYPE:VARCHAR(100);UNIQUE;COMMENT:编号"`
+	Version   int64      `gorm:"NOT NULL;DEFAULT:0;INDEX;COMMENT:版本"`
+	Name      string     `gorm:"TYPE:VARCHAR(200);NOT NULL;DEFAULT:'';COMMENT:名称"`
+	Checksum  string     `gorm:"TYPE:VARCHAR(64);NOT NULL;DEFAULT:'';COMMENT:校验和"`
+	AppliedAt *time.Time `gorm:"COMMENT:执行时间"`
 	TailColumns
 }
 
@@ -25,9 +31,25 @@ func SyncTables(tx *gorm.DB, tables []interface{}) error {
 	return nil
 }
 
-func MigrateTables(tx *gorm.DB, tables []interface{}) error {
+// MigrateOptions MigrateTables 的选项
+type MigrateOptions struct {
+	AddColumns bool // 已存在的表补充缺少的列, 不修改已有列
+}
+
+// MigrateTables 创建不存在的表, 默认不修改已存在的表, 补充缺少的列见 MigrateOptions.AddColumns
+func MigrateTables(tx *gorm.DB, tables []interface{}, options ...MigrateOptions) error {
+	addColumns := false
+	for _, option := range options {
+		addColumns = addColumns || option.AddColumns
+	}
 	for _, table := range tables {
 		if tx.Migrator().HasTable(table) {
+			if !addColumns {
+				continue
+			}
+			if err := addMissingColumns(tx, table); err != nil {
+				return err
+			}
 			continue
 		}
 		strings.TrimPrefix(fmt.Sprintf("%T", table), "*db.")
@@ -39,22 +61,44 @@ func MigrateTables(tx *gorm.DB, tables []interface{}) error {
 	return nil
 }
 
-func DoMigrate(code string, f func() error) {
+// addMissingColumns 补充表中缺少的列
+func addMissingColumns(tx *gorm.DB, table interface{}) error {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(table); err != nil {
+		return err
+	}
+	migrator := tx.Migrator()
+	for _, dbName := range stmt.Schema.DBNames {
+		if migrator.HasColumn(table, dbName) {
+			continue
+		}
+		if err := migrator.AddColumn(table, dbName); err != nil {
+			return fmt.Errorf("add column %s.%s failed: %w", stmt.Schema.Table, dbName, err)
+		}
+	}
+	return nil
+}
+
+// DoMigrate 按编号只执行一次 f, 执行失败时返回错误且不记录
+// 不保证顺序, 也不支持回滚, 新的迁移建议使用 RegisterMigration
+func DoMigrate(code string, f func() error) error {
 	var cnt int64
 	err := DbSess().Model(new(Migration)).Where("code = ?", code).Count(&cnt).Error
 	if err != nil {
-		return
+		return err
 	}
 	if cnt > 0 {
-		return
+		return nil
 	}
 
-	err = f()
-	if err != nil {
-		return
+	if err = f(); err != nil {
+		return fmt.Errorf("migration %s failed: %w", code, err)
 	}
 
+	now := time.Now()
 	e := new(Migration)
 	e.Code = code
-	DbSess().Create(e)
+	e.Name = code
+	e.AppliedAt = &now
+	return DbSess().Create(e).Error
 }
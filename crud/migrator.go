@@ -0,0 +1,325 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrMigrationChecksum 已执行的迁移与注册的迁移校验和不一致
+	ErrMigrationChecksum = errors.New("migration checksum mismatch")
+	// ErrMigrationIrreversible 迁移没有 Down, 无法回滚
+	ErrMigrationIrreversible = errors.New("migration is irreversible")
+	// ErrMigrationLocked 未能取得迁移锁
+	ErrMigrationLocked = errors.New("migration lock not acquired")
+)
+
+// MigrationLockName 迁移锁名称, 多个应用共用一个数据库时需区分
+var MigrationLockName = "g3_migration"
+
+// MigrationLockTimeout 等待迁移锁的时间
+var MigrationLockTimeout = time.Minute
+
+// MigrationStep 一个版本的迁移
+// Up/Down 在事务中执行, 通过 DbSessContext(ctx) 或 DAO 的 *Context 方法读写即可参与事务;
+// 注意 mysql 的 DDL 会隐式提交, 失败时无法回滚
+type MigrationStep struct {
+	Version int64
+	Name    string
+	Up      func(ctx context.Context) error
+	Down    func(ctx context.Context) error
+	// Checksum 迁移内容的校验和, 为空时按 Sql 计算; 已执行的迁移被修改时 RunMigrations 返回 ErrMigrationChecksum
+	// 只有 Up 函数的迁移无法计算内容, 需自行设置(如修改 Up 时递增的 "v2"), 否则只按 Version 与 Name 计算并在执行时输出警告
+	Checksum string
+	// Sql 迁移的 SQL, 用于 DryRunMigrations 展示及计算校验和
+	Sql string
+}
+
+// checksum 迁移的校验和
+func (step MigrationStep) checksum() string {
+	if len(step.Checksum) > 0 {
+		return step.Checksum
+	}
+	if len(step.Sql) > 0 {
+		return checksumOf(step.Sql)
+	}
+	return checksumOf(fmt.Sprintf("%d:%s", step.Version, step.Name))
+}
+
+// code 迁移在 Migration 表中的编号
+func (step MigrationStep) code() string {
+	return fmt.Sprintf("%d_%s", step.Version, step.Name)
+}
+
+func checksumOf(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// SqlMigration 以 SQL 定义的迁移, 校验和按 SQL 计算; down 为空时不可回滚
+func SqlMigration(version int64, name string, up, down string) MigrationStep {
+	step := MigrationStep{
+		Version:  version,
+		Name:     name,
+		Checksum: checksumOf(up + "\n--\n" + down),
+		Sql:      up,
+		Up: func(ctx context.Context) error {
+			return DbSessContext(ctx).Exec(up).Error
+		},
+	}
+	if len(down) > 0 {
+		step.Down = func(ctx context.Context) error {
+			return DbSessContext(ctx).Exec(down).Error
+		}
+	}
+	return step
+}
+
+var (
+	migrationSteps   []MigrationStep
+	migrationStepsMu sync.Mutex
+)
+
+// RegisterMigration 注册迁移, 一般在 init 中调用, 版本号重复时 panic
+func RegisterMigration(steps ...MigrationStep) {
+	migrationStepsMu.Lock()
+	defer migrationStepsMu.Unlock()
+	for _, step := range steps {
+		if step.Version <= 0 || step.Up == nil {
+			panic(fmt.Sprintf("invalid migration %d %s", step.Version, step.Name))
+		}
+		for _, registered := range migrationSteps {
+			if registered.Version == step.Version {
+				panic(fmt.Sprintf("duplicate migration version %d", step.Version))
+			}
+		}
+		migrationSteps = append(migrationSteps, step)
+	}
+	sort.Slice(migrationSteps, func(i, j int) bool {
+		return migrationSteps[i].Version < migrationSteps[j].Version
+	})
+}
+
+// registeredMigrations 已注册的迁移, 按版本升序
+func registeredMigrations() []MigrationStep {
+	migrationStepsMu.Lock()
+	defer migrationStepsMu.Unlock()
+	return append(make([]MigrationStep, 0, len(migrationSteps)), migrationSteps...)
+}
+
+// appliedMigrations 已执行的迁移, 版本 => 记录
+func appliedMigrations(db *gorm.DB) (map[int64]*Migration, error) {
+	rows := make([]*Migration, 0)
+	if err := db.Where("version > ?", 0).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]*Migration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// pendingMigrations 未执行的迁移, 并校验已执行迁移的校验和
+func pendingMigrations(db *gorm.DB) ([]MigrationStep, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	pending := make([]MigrationStep, 0)
+	for _, step := range registeredMigrations() {
+		row, ok := applied[step.Version]
+		if !ok {
+			pending = append(pending, step)
+			continue
+		}
+		if len(row.Checksum) > 0 && row.Checksum != step.checksum() {
+			return nil, &DaoError{Kind: ErrMigrationChecksum, Err: fmt.Errorf("migration %s: applied %s, registered %s", step.code(), row.Checksum, step.checksum())}
+		}
+	}
+	return pending, nil
+}
+
+// PendingMigrations 未执行的迁移
+func PendingMigrations(ctx context.Context) ([]MigrationStep, error) {
+	return pendingMigrations(DbSessContext(ctx))
+}
+
+// MigrationPlan 待执行迁移的说明
+type MigrationPlan struct {
+	Version  int64  `json:"version"`
+	Name     string `json:"name"`
+	Checksum string `json:"checksum"`
+	Sql      string `json:"sql,omitempty"`
+}
+
+// DryRunMigrations 列出将要执行的迁移, 不做任何修改
+func DryRunMigrations(ctx context.Context) ([]MigrationPlan, error) {
+	pending, err := PendingMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plans := make([]MigrationPlan, 0, len(pending))
+	for _, step := range pending {
+		plans = append(plans, MigrationPlan{
+			Version:  step.Version,
+			Name:     step.Name,
+			Checksum: step.checksum(),
+			Sql:      step.Sql,
+		})
+	}
+	return plans, nil
+}
+
+// RunMigrations 按版本顺序执行未执行的迁移, 返回本次执行的迁移
+// 执行期间持有数据库锁(mysql/postgres), 多个实例同时启动时依次执行; 任一迁移失败即停止
+func RunMigrations(ctx context.Context) ([]MigrationStep, error) {
+	done := make([]MigrationStep, 0)
+	err := withMigrationLock(ctx, func(ctx context.Context) error {
+		pending, err := PendingMigrations(ctx)
+		if err != nil {
+			return err
+		}
+		for _, step := range pending {
+			step := step
+			if len(step.Checksum) == 0 && len(step.Sql) == 0 {
+				DbSessContext(ctx).Logger.Warn(ctx, "migration %s has no Checksum or Sql, changes to its Up will not be detected", step.code())
+			}
+			err = WithTx(ctx, func(ctx context.Context) error {
+				if err := step.Up(ctx); err != nil {
+					return err
+				}
+				now := time.Now()
+				return DbSessContext(ctx).Create(&Migration{
+					Code:      step.code(),
+					Version:   step.Version,
+					Name:      step.Name,
+					Checksum:  step.checksum(),
+					AppliedAt: &now,
+				}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %s failed: %w", step.code(), err)
+			}
+			done = append(done, step)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// RollbackMigrations 按版本倒序回滚版本大于 toVersion 的已执行迁移, 返回本次回滚的迁移
+// 需回滚的迁移中有未注册或没有 Down 的迁移时不做任何回滚并返回错误
+func RollbackMigrations(ctx context.Context, toVersion int64) ([]MigrationStep, error) {
+	done := make([]MigrationStep, 0)
+	err := withMigrationLock(ctx, func(ctx context.Context) error {
+		applied, err := appliedMigrations(DbSessContext(ctx))
+		if err != nil {
+			return err
+		}
+		registered := make(map[int64]MigrationStep)
+		for _, step := range registeredMigrations() {
+			registered[step.Version] = step
+		}
+		steps := make([]MigrationStep, 0)
+		for version := range applied {
+			if version <= toVersion {
+				continue
+			}
+			step, ok := registered[version]
+			if !ok {
+				return &DaoError{Kind: ErrMigrationIrreversible, Err: fmt.Errorf("migration %s is not registered", applied[version].Code)}
+			}
+			if step.Down == nil {
+				return &DaoError{Kind: ErrMigrationIrreversible, Err: fmt.Errorf("migration %s has no down", step.code())}
+			}
+			steps = append(steps, step)
+		}
+		sort.Slice(steps, func(i, j int) bool {
+			return steps[i].Version > steps[j].Version
+		})
+		for _, step := range steps {
+			step := step
+			err = WithTx(ctx, func(ctx context.Context) error {
+				if err := step.Down(ctx); err != nil {
+					return err
+				}
+				return DbSessContext(ctx).Where("version = ?", step.Version).Delete(new(Migration)).Error
+			})
+			if err != nil {
+				return fmt.Errorf("rollback %s failed: %w", step.code(), err)
+			}
+			done = append(done, step)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// withMigrationLock 在同一连接上持有数据库锁执行 fn, 其他数据库不加锁
+func withMigrationLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	return DbSessContext(ctx).Connection(func(conn *gorm.DB) error {
+		//后续读写都在持有锁的连接上进行, 不作为事务存放, 各迁移仍在自己的事务中执行
+		ctx := withEngineConn(ctx, DefaultDbEngine, conn)
+		switch conn.Dialector.Name() {
+		case "mysql":
+			var got int
+			if err := conn.Raw("SELECT GET_LOCK(?, ?)", MigrationLockName, int(MigrationLockTimeout.Seconds())).Scan(&got).Error; err != nil {
+				return err
+			}
+			if got != 1 {
+				return &DaoError{Kind: ErrMigrationLocked}
+			}
+			defer conn.Exec("SELECT RELEASE_LOCK(?)", MigrationLockName)
+		case "postgres":
+			key := migrationLockKey()
+			if err := tryAdvisoryLock(ctx, conn, key); err != nil {
+				return err
+			}
+			defer conn.Exec("SELECT pg_advisory_unlock(?)", key)
+		}
+		return fn(ctx)
+	})
+}
+
+// migrationLockRetry 等待 postgres advisory lock 时重试的间隔
+var migrationLockRetry = 500 * time.Millisecond
+
+// tryAdvisoryLock 在 MigrationLockTimeout 内重试 pg_try_advisory_lock, 与 mysql 的 GET_LOCK 超时一致
+func tryAdvisoryLock(ctx context.Context, conn *gorm.DB, key int64) error {
+	deadline := time.Now().Add(MigrationLockTimeout)
+	for {
+		var got bool
+		if err := conn.Raw("SELECT pg_try_advisory_lock(?)", key).Scan(&got).Error; err != nil {
+			return err
+		}
+		if got {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return &DaoError{Kind: ErrMigrationLocked}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(migrationLockRetry):
+		}
+	}
+}
+
+// migrationLockKey postgres advisory lock 的键
+func migrationLockKey() int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(MigrationLockName))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMigrationChecksum(t *testing.T) {
+	up := func(ctx context.Context) error { return nil }
+	cases := []struct {
+		name  string
+		a, b  MigrationStep
+		equal bool
+	}{
+		{"explicit", MigrationStep{Version: 1, Name: "a", Up: up, Checksum: "v1"}, MigrationStep{Version: 1, Name: "a", Up: up, Checksum: "v1", Sql: "x"}, true},
+		{"explicit changed", MigrationStep{Version: 1, Name: "a", Up: up, Checksum: "v1"}, MigrationStep{Version: 1, Name: "a", Up: up, Checksum: "v2"}, false},
+		{"sql changed", MigrationStep{Version: 1, Name: "a", Up: up, Sql: "CREATE TABLE t (id INT)"}, MigrationStep{Version: 1, Name: "a", Up: up, Sql: "CREATE TABLE t (id BIGINT)"}, false},
+		{"sql migration", SqlMigration(1, "a", "CREATE TABLE t (id INT)", ""), SqlMigration(1, "a", "CREATE TABLE t (id INT)", "DROP TABLE t"), false},
+		{"func only", MigrationStep{Version: 1, Name: "a", Up: up}, MigrationStep{Version: 1, Name: "a", Up: func(ctx context.Context) error { return errors.New("changed") }}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if equal := c.a.checksum() == c.b.checksum(); equal != c.equal {
+				t.Fatalf("expected equal=%v, got %s and %s", c.equal, c.a.checksum(), c.b.checksum())
+			}
+		})
+	}
+}
+
+func TestMigrationLockTransaction(t *testing.T) {
+	newTestDb(t, new(Migration))
+	committed := false
+	err := withMigrationLock(context.Background(), func(ctx context.Context) error {
+		if _, ok := TxFromContext(ctx); ok {
+			t.Fatal("locked connection stored as transaction")
+		}
+		err := WithTx(ctx, func(ctx context.Context) error {
+			afterCommit(ctx, "", func() { committed = true })
+			return DbSessContext(ctx).Create(&Migration{Code: "1_committed", Version: 1}).Error
+		})
+		if err != nil {
+			return err
+		}
+		_ = WithTx(ctx, func(ctx context.Context) error {
+			if err := DbSessContext(ctx).Create(&Migration{Code: "2_rolled_back", Version: 2}).Error; err != nil {
+				return err
+			}
+			return errors.New("rollback")
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !committed {
+		t.Fatal("afterCommit callback not run")
+	}
+	applied, err := appliedMigrations(DbSess())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := applied[1]; !ok || len(applied) != 1 {
+		t.Fatalf("unexpected migrations %v", applied)
+	}
+}
+
+func TestRunMigrations(t *testing.T) {
+	newTestDb(t, new(Migration))
+	saved := migrationSteps
+	migrationSteps = nil
+	defer func() { migrationSteps = saved }()
+	RegisterMigration(
+		SqlMigration(1, "create_items", "CREATE TABLE items (id INTEGER)", "DROP TABLE items"),
+		MigrationStep{Version: 2, Name: "seed_items", Checksum: "v1", Up: func(ctx context.Context) error {
+			return DbSessContext(ctx).Exec("INSERT INTO items (id) VALUES (1)").Error
+		}},
+	)
+	ctx := context.Background()
+	done, err := RunMigrations(ctx)
+	if err != nil || len(done) != 2 {
+		t.Fatalf("expected 2 migrations, got %d: %v", len(done), err)
+	}
+	if done, err = RunMigrations(ctx); err != nil || len(done) != 0 {
+		t.Fatalf("expected no pending migrations, got %d: %v", len(done), err)
+	}
+	migrationSteps[1].Checksum = "v2"
+	if _, err = RunMigrations(ctx); !errors.Is(err, ErrMigrationChecksum) {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+}
+
+// migrateItemV1 migrateItemV2 同一张表的两个版本, V2 增加了 Name 列
+type migrateItemV1 struct {
+	Id int64
+}
+
+func (*migrateItemV1) TableName() string { return "migrate_items" }
+
+type migrateItemV2 struct {
+	Id   int64
+	Name string
+}
+
+func (*migrateItemV2) TableName() string { return "migrate_items" }
+
+func TestMigrateTablesAddColumns(t *testing.T) {
+	db := newTestDb(t, new(migrateItemV1))
+	if err := MigrateTables(db, []interface{}{new(migrateItemV2)}); err != nil {
+		t.Fatal(err)
+	}
+	if db.Migrator().HasColumn(new(migrateItemV2), "name") {
+		t.Fatal("expected existing table unchanged by default")
+	}
+	if err := MigrateTables(db, []interface{}{new(migrateItemV2)}, MigrateOptions{AddColumns: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !db.Migrator().HasColumn(new(migrateItemV2), "name") {
+		t.Fatal("expected missing column added with AddColumns")
+	}
+}
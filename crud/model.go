@@ -2,7 +2,10 @@
 
 package crud
 
-import "time"
+import (
+	"reflect"
+	"time"
+)
 
 const (
 	FlagTrue  = "T"
@@ -18,9 +21,9 @@ type ModelInterface interface {
 	GetId() int64
 	// Table 返回表名
 	Table() string
-	// NewModel 返回实例
+	// NewModel 返回实例, 可内嵌 ModelFactory 实现
 	NewModel() ModelInterface
-	// NewModels 返回实例数组
+	// NewModels 返回实例数组, 可内嵌 ModelFactory 实现
 	NewModels() interface{}
 	// SetCreatedBy 设置操作人
 	SetCreatedBy(operator int64)
@@ -79,3 +82,37 @@ func (baseModel *BaseModel) GetSelectColumns() []string {
 func (baseModel *BaseModel) SetLastModel(last ModelInterface) {
 	baseModel.Last = last
 }
+
+// ModelFactory 内嵌到模型中实现 NewModel/NewModels, T 为模型类型, 如
+//
+//	type User struct {
+//		crud.BaseModel
+//		crud.ModelFactory[User]
+//	}
+type ModelFactory[T any] struct{}
+
+// NewModel 返回 *T
+func (ModelFactory[T]) NewModel() ModelInterface {
+	return any(new(T)).(ModelInterface)
+}
+
+// NewModels 返回 []*T
+func (ModelFactory[T]) NewModels() interface{} {
+	return make([]*T, 0)
+}
+
+// NewModelOf 返回与 m 同类型的新实例, NewModel 返回 nil 时通过反射创建
+func NewModelOf(m ModelInterface) ModelInterface {
+	if n := m.NewModel(); n != nil {
+		return n
+	}
+	return reflect.New(reflect.TypeOf(m).Elem()).Interface().(ModelInterface)
+}
+
+// NewModelsOf 返回与 m 同类型的空切片, NewModels 返回 nil 时通过反射创建
+func NewModelsOf(m ModelInterface) interface{} {
+	if n := m.NewModels(); n != nil {
+		return n
+	}
+	return reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(m)), 0, 0).Interface()
+}
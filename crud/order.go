@@ -0,0 +1,122 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"fmt"
+	"github.com/zhouhp1295/g3/helpers"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"strings"
+)
+
+// DefaultOrderBy 默认排序
+const DefaultOrderBy = "-id"
+
+// SortableInterface 可选, 模型声明可排序的字段(json 名)
+// 也可在字段上标注 `sortable:"true"`; 两者都未声明时, 除 json:"-" 外的所有列均可排序
+// 敏感字段(见 IsSensitiveField)始终不可排序
+type SortableInterface interface {
+	SortableFields() []string
+}
+
+// OrderField 排序字段
+type OrderField struct {
+	Field *schema.Field
+	Desc  bool
+}
+
+// Column 排序列
+func (f OrderField) Column() string {
+	return f.Field.DBName
+}
+
+// sortableFields 模型声明的可排序字段, nil 表示除 json:"-" 外不限制
+func sortableFields(m ModelInterface, s *schema.Schema) []*schema.Field {
+	fields := make([]*schema.Field, 0)
+	if sortable, ok := m.(SortableInterface); ok {
+		for _, name := range sortable.SortableFields() {
+			if field := LookUpField(s, name); field != nil {
+				fields = append(fields, field)
+			}
+		}
+	}
+	for _, field := range s.Fields {
+		if len(field.DBName) > 0 && field.StructField.Tag.Get("sortable") == "true" {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	//主键始终可排序
+	if s.PrioritizedPrimaryField != nil {
+		fields = append(fields, s.PrioritizedPrimaryField)
+	}
+	return fields
+}
+
+// ParseOrderBy 解析排序参数, 如 "-createdAt,name", 字段可为 json 名、字段名或列名, engine 为模型所在数据库
+// 兼容 "created_at desc" 写法; 未知或不可排序的字段返回 ErrValidation
+func ParseOrderBy(engine string, m ModelInterface, orderBy string) ([]OrderField, error) {
+	s, err := EngineModelSchema(engine, m)
+	if err != nil {
+		return nil, err
+	}
+	allowed := sortableFields(m, s)
+	result := make([]OrderField, 0)
+	for _, item := range strings.Split(orderBy, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		desc := false
+		if strings.HasPrefix(item, "-") {
+			desc = true
+			item = item[1:]
+		} else if strings.HasPrefix(item, "+") {
+			item = item[1:]
+		} else if parts := strings.Fields(item); len(parts) == 2 {
+			switch strings.ToLower(parts[1]) {
+			case "desc":
+				desc = true
+			case "asc":
+			default:
+				return nil, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("invalid order direction %q", parts[1])}
+			}
+			item = parts[0]
+		}
+		field := LookUpField(s, strings.TrimSpace(item))
+		if field == nil {
+			return nil, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("unknown order field %q", item)}
+		}
+		if !isSortable(allowed, field) {
+			return nil, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("order field %q is not sortable", item)}
+		}
+		result = append(result, OrderField{Field: field, Desc: desc})
+	}
+	return result, nil
+}
+
+// isSortable 敏感字段不可排序; 模型未声明可排序字段时, json:"-" 的字段(如 tenant_id、created_by)不可排序
+func isSortable(allowed []*schema.Field, field *schema.Field) bool {
+	if IsSensitiveField(field) {
+		return false
+	}
+	if allowed == nil {
+		return len(JsonName(field)) > 0
+	}
+	return helpers.IndexOf[*schema.Field](allowed, field) >= 0
+}
+
+// orderByClause 转换为 gorm 排序子句
+func orderByClause(fields []OrderField) clause.OrderBy {
+	columns := make([]clause.OrderByColumn, 0, len(fields))
+	for _, f := range fields {
+		columns = append(columns, clause.OrderByColumn{
+			Column: clause.Column{Table: clause.CurrentTable, Name: f.Column()},
+			Desc:   f.Desc,
+		})
+	}
+	return clause.OrderBy{Columns: columns}
+}
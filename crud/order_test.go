@@ -0,0 +1,69 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// sortableUser 声明了可排序字段
+type sortableUser struct {
+	BaseModel
+	ModelFactory[sortableUser]
+	Username string `json:"username"`
+	Age      int    `json:"age" sortable:"true"`
+	TailColumns
+}
+
+func (*sortableUser) Table() string { return "sortable_users" }
+
+func (*sortableUser) SortableFields() []string { return []string{"createdAt"} }
+
+func TestParseOrderBy(t *testing.T) {
+	cases := []struct {
+		name    string
+		model   ModelInterface
+		orderBy string
+		columns string // 列名, - 前缀为倒序
+		err     string
+	}{
+		{"empty", new(testUser), "", "", ""},
+		{"json names", new(testUser), "-createdAt,username", "-created_at,username", ""},
+		{"field and column names", new(testUser), "+Age, updated_at", "age,updated_at", ""},
+		{"sql style", new(testUser), "created_at desc,age ASC", "-created_at,age", ""},
+		{"bad direction", new(testUser), "age down", "", "invalid order direction"},
+		{"unknown", new(testUser), "nope", "", "unknown order field"},
+		{"sensitive", new(testUser), "password", "", "not sortable"},
+		{"json hidden", new(testUser), "created_by", "", "not sortable"},
+		{"deleted flag", new(testUser), "-deleted", "", "not sortable"},
+		{"declared", new(sortableUser), "-createdAt,age,id", "-created_at,age,id", ""},
+		{"undeclared", new(sortableUser), "username", "", "not sortable"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fields, err := ParseOrderBy(DefaultDbEngine, c.model, c.orderBy)
+			if len(c.err) > 0 {
+				if !errors.Is(err, ErrValidation) || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expected validation error containing %q, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			columns := make([]string, 0, len(fields))
+			for _, f := range fields {
+				column := f.Column()
+				if f.Desc {
+					column = "-" + column
+				}
+				columns = append(columns, column)
+			}
+			if got := strings.Join(columns, ","); got != c.columns {
+				t.Fatalf("expected %q, got %q", c.columns, got)
+			}
+		})
+	}
+}
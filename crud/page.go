@@ -2,20 +2,68 @@
 
 package crud
 
-import "math"
+import (
+	"context"
+	"gorm.io/gorm"
+	"math"
+)
+
+// 分页方式
+const (
+	PageModeOffset = "offset" // OFFSET/LIMIT, 默认
+	PageModeCursor = "cursor" // 游标(keyset)分页
+)
+
+// 总数统计方式
+const (
+	CountExact    = "exact"    // COUNT(*), 默认
+	CountNone     = "none"     // 不统计, total 为 -1
+	CountEstimate = "estimate" // 使用数据库的统计信息估算整表行数, 不支持的数据库、租户模型或有查询条件时使用 COUNT(*)
+)
+
+// TotalUnknown 未统计总数
+const TotalUnknown = -1
 
 type PageData struct {
-	PageNum   int `json:"pageNum"`
-	PageTotal int `json:"pageTotal"`
-	PageSize  int `json:"pageSize"`
-	Total     int `json:"total"`
+	PageNum    int    `json:"pageNum"`
+	PageTotal  int    `json:"pageTotal"`
+	PageSize   int    `json:"pageSize"`
+	Total      int    `json:"total"`
+	HasMore    bool   `json:"hasMore"`
+	NextCursor string `json:"nextCursor,omitempty"`
 }
 
 func PageResult(page, size, total int) PageData {
+	pageTotal := TotalUnknown
+	if total >= 0 && size > 0 {
+		pageTotal = int(math.Ceil(float64(total) / float64(size)))
+	}
 	return PageData{
 		PageNum:   page,
-		PageTotal: int(math.Ceil(float64(total) / float64(size))),
+		PageTotal: pageTotal,
 		PageSize:  size,
 		Total:     total,
+		HasMore:   total >= 0 && page*size < total,
+	}
+}
+
+// EstimateCount 估算表的行数, 不支持的数据库返回 ok=false
+func EstimateCount(ctx context.Context, table string) (cnt int64, ok bool) {
+	return estimateCount(DbSessContext(ctx), table)
+}
+
+func estimateCount(db *gorm.DB, table string) (cnt int64, ok bool) {
+	var err error
+	switch db.Dialector.Name() {
+	case "mysql":
+		err = db.Raw("SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?", table).Scan(&cnt).Error
+	case "postgres":
+		err = db.Raw("SELECT reltuples::bigint FROM pg_class WHERE relname = ?", table).Scan(&cnt).Error
+	default:
+		return 0, false
+	}
+	if err != nil || cnt < 0 {
+		return 0, false
 	}
+	return cnt, true
 }
@@ -4,8 +4,9 @@ package crud
 
 import (
 	"fmt"
-	"github.com/zhouhp1295/g3/helpers"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 	"reflect"
 	"strings"
 )
@@ -18,84 +19,266 @@ type BaseQueryParams struct {
 	EndTime   string `form:"endTime" json:"endTime"`
 	PageNum   int    `form:"pageNum" json:"pageNum"`
 	PageSize  int    `form:"pageSize" json:"pageSize"`
-	OrderBy   string `form:"orderBy" json:"orderBy"`
+	OrderBy   string `form:"orderBy" json:"orderBy"`   // 如 -createdAt,name, 见 ParseOrderBy
+	PageMode  string `form:"pageMode" json:"pageMode"` // offset(默认) cursor
+	Cursor    string `form:"cursor" json:"cursor"`     // 游标分页时上一页返回的 nextCursor, 传入即使用游标分页
+	CountMode string `form:"count" json:"count"`       // exact(默认) none estimate
+	Include   string `form:"include" json:"include"`   // 加载的关联, 如 customer,items, 见 ParseInclude
+	Fields    string `form:"fields" json:"fields"`     // 返回的字段, 如 id,name,status, 见 ParseFields
+	Keyword   string `form:"keyword" json:"keyword"`   // 在可搜索的字段中搜索, 见 SearchableInterface
+	Filter    string `form:"filter" json:"filter"`     // 过滤条件, JSON 或简写形式, 见 ParseFilter
 }
 
 type QueryWrapperInterface interface {
 	QueryScope() func(db *gorm.DB) *gorm.DB
 	WrapQuery(db *gorm.DB)
 	PageScope() func(db *gorm.DB) *gorm.DB
+	OrderScope() func(db *gorm.DB) *gorm.DB
 	PageResult(total int64) PageData
 }
 
 type BaseQueryWrapper struct {
 	ModelParams ModelInterface
 	BaseParams  *BaseQueryParams
+	Deleted     string // 删除标识条件, 为空时为 FlagNo
+	Engine      string // 模型所在数据库, 按其 NamingStrategy 解析字段, 为空时为默认数据库
 }
 
 func (wrapper *BaseQueryWrapper) QueryScope() func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		if wrapper.BaseParams != nil {
 			if len(wrapper.BaseParams.BeginTime) > 0 {
-				db.Where("created_at > ?", wrapper.BaseParams.BeginTime+" 00:00:00")
+				db.Where(clause.Gt{Column: currentColumn("created_at"), Value: wrapper.BaseParams.BeginTime + " 00:00:00"})
 			}
 			if len(wrapper.BaseParams.EndTime) > 0 {
-				db.Where("created_at < ?", wrapper.BaseParams.EndTime+" 23:59:59")
+				db.Where(clause.Lt{Column: currentColumn("created_at"), Value: wrapper.BaseParams.EndTime + " 23:59:59"})
 			}
 		}
 		wrapper.WrapQuery(db)
+		if wrapper.BaseParams != nil {
+			whereKeyword(db, wrapper.ModelParams, wrapper.BaseParams.Keyword)
+			whereFilter(db, wrapper.ModelParams, wrapper.BaseParams.Filter)
+		}
 
-		db.Where("deleted = ?", FlagNo)
+		deleted := wrapper.Deleted
+		if len(deleted) == 0 {
+			deleted = FlagNo
+		}
+		db.Where(clause.Eq{Column: currentColumn("deleted"), Value: deleted})
 
 		return db
 	}
 }
 
-//wrapperQuery 查询组装
+// hasConditions 是否有删除标识以外的查询条件(时间范围、query 标签、keyword、filter)
+func (wrapper *BaseQueryWrapper) hasConditions(db *gorm.DB) bool {
+	tx := db.Session(&gorm.Session{NewDB: true}).Table(wrapper.ModelParams.Table())
+	tx = wrapper.QueryScope()(tx)
+	where, ok := tx.Statement.Clauses["WHERE"].Expression.(clause.Where)
+	return tx.Error != nil || !ok || len(where.Exprs) > 1
+}
+
+// IncludeScope 加载 BaseQueryParams.Include 指定的关联, 仅用于查询数据, 不用于统计总数
+func (wrapper *BaseQueryWrapper) IncludeScope() func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if wrapper.BaseParams == nil || len(wrapper.BaseParams.Include) == 0 {
+			return db
+		}
+		includes, err := ParseInclude(wrapper.Engine, wrapper.ModelParams, wrapper.BaseParams.Include)
+		if err != nil {
+			_ = db.AddError(err)
+			return db
+		}
+		return includeRelations(db, includes)
+	}
+}
+
+// SelectScope 查询的列, 见 SelectFields; 排序字段与 include 关联的外键始终查询
+func (wrapper *BaseQueryWrapper) SelectScope() func(db *gorm.DB) *gorm.DB {
+	fields := ""
+	extra := make([]*schema.Field, 0)
+	if wrapper.BaseParams != nil {
+		fields = wrapper.BaseParams.Fields
+		if includes, err := ParseInclude(wrapper.Engine, wrapper.ModelParams, wrapper.BaseParams.Include); err == nil {
+			extra = append(extra, includeKeys(includes)...)
+		}
+	}
+	//排序字段有误时由 OrderScope 返回错误
+	if orderFields, err := wrapper.CursorOrderFields(); err == nil {
+		for _, f := range orderFields {
+			extra = append(extra, f.Field)
+		}
+	}
+	return fieldsScope(wrapper.Engine, wrapper.ModelParams, fields, extra...)
+}
+
+// currentColumn 当前表的列, 带表名以免与 JOIN 的表冲突
+func currentColumn(name string) clause.Column {
+	return clause.Column{Table: clause.CurrentTable, Name: name}
+}
+
+// wrapperQuery 查询组装, 标签解析结果按类型缓存
 func wrapperQuery(table string, params interface{}, db *gorm.DB) {
-	var t reflect.Type
-	var v reflect.Value
-	if reflect.TypeOf(params).Kind() == reflect.Ptr {
-		t = reflect.TypeOf(params).Elem()
-		v = reflect.ValueOf(params).Elem()
-	} else if reflect.TypeOf(params).Kind() == reflect.Struct {
-		t = reflect.TypeOf(params)
-		v = reflect.ValueOf(params)
-	} else {
+	v := reflect.ValueOf(params)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
 		return
 	}
-	for i := 0; i < t.NumField(); i++ {
-		if !v.Field(i).CanInterface() {
-			continue
+	fields, err := parseQueryFields(v.Type())
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	for _, field := range fields {
+		fv := v.FieldByIndex(field.index)
+		must := field.must
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				continue
+			}
+			//指针非空即视为有效值
+			fv = fv.Elem()
+			must = true
 		}
-		if v.Field(i).Interface() == nil {
+		//must 若不存在此标注, 则忽略空值(空字符串、数字0)
+		if !must && isEmptyQueryValue(fv) {
 			continue
 		}
-		if reflect.TypeOf(v.Field(i).Interface()).Kind() == reflect.Struct {
-			wrapperQuery(table, v.Field(i).Interface(), db)
+		if len(field.rel) > 0 {
+			if err := whereRelation(params, db, field, fv); err != nil {
+				_ = db.AddError(err)
+				return
+			}
 			continue
 		}
-		sf := t.Field(i)
-		if query := sf.Tag.Get("query"); len(query) > 0 {
-			queryItems := strings.Split(strings.ToLower(query), ";")
-			//must 若不存在此标注, 则忽略空值(空字符串、数字0)
-			if helpers.IndexOf[string](queryItems, "must") < 0 {
-				if str, ok := v.Field(i).Interface().(string); ok && len(str) == 0 {
-					continue
-				}
-				if i64, ok := helpers.Int64(v.Field(i).Interface()); ok && i64 == 0 {
-					continue
-				}
-			}
-			//目前只简单处理列的名字
-			colName := db.Statement.NamingStrategy.ColumnName(table, sf.Name)
-			if helpers.IndexOf[string](queryItems, "like") >= 0 {
-				db.Where(colName+" like ?", fmt.Sprintf("%%%v%%", v.Field(i).Interface()))
-			} else if helpers.IndexOf[string](queryItems, "eq") >= 0 {
-				db.Where(colName+" = ?", v.Field(i).Interface())
+		colName := field.column
+		if len(colName) == 0 {
+			colName = db.Statement.NamingStrategy.ColumnName(table, field.name)
+		}
+		whereQueryField(db, field, colName, fv)
+	}
+}
+
+// whereRelation 关联表字段的条件, params 须为模型
+func whereRelation(params interface{}, db *gorm.DB, field queryField, fv reflect.Value) error {
+	m, ok := params.(ModelInterface)
+	if !ok {
+		return fmt.Errorf("query field %s: rel requires model params", field.name)
+	}
+	s, err := dbModelSchema(db, m)
+	if err != nil {
+		return err
+	}
+	rel := LookUpRelation(s, field.rel)
+	if rel == nil {
+		return fmt.Errorf("query field %s: unknown relation %q", field.name, field.rel)
+	}
+	return whereRelationField(db, rel, field, fv)
+}
+
+// whereQueryField 按操作符组装条件
+func whereQueryField(db *gorm.DB, field queryField, colName string, fv reflect.Value) {
+	expr, err := queryExpression(field, colName, fv)
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	if expr != nil {
+		db.Where(expr)
+	}
+}
+
+// queryExpression 按操作符生成条件, 不需要条件时(如 in 的值为空)返回 nil
+func queryExpression(field queryField, colName string, fv reflect.Value) (clause.Expression, error) {
+	value := fv.Interface()
+	var col interface{} = currentColumn(colName)
+	placeholder := "?"
+	if field.ci {
+		col = clause.Expr{SQL: "LOWER(?)", Vars: []interface{}{currentColumn(colName)}}
+		placeholder = "LOWER(?)"
+	}
+	expr := func(sql string, vars ...interface{}) clause.Expression {
+		return clause.Expr{SQL: sql, Vars: append([]interface{}{col}, vars...)}
+	}
+	switch field.op {
+	case QueryEq:
+		return expr("? = "+placeholder, value), nil
+	case QueryNe:
+		return expr("? <> "+placeholder, value), nil
+	case QueryGt:
+		return expr("? > ?", value), nil
+	case QueryGte:
+		return expr("? >= ?", value), nil
+	case QueryLt:
+		return expr("? < ?", value), nil
+	case QueryLte:
+		return expr("? <= ?", value), nil
+	case QueryLike:
+		return expr("? like "+placeholder+likeEscapeClause, "%"+EscapeLike(fmt.Sprint(value))+"%"), nil
+	case QueryPrefix:
+		return expr("? like "+placeholder+likeEscapeClause, EscapeLike(fmt.Sprint(value))+"%"), nil
+	case QuerySuffix:
+		return expr("? like "+placeholder+likeEscapeClause, "%"+EscapeLike(fmt.Sprint(value))), nil
+	case QueryIn:
+		values := queryValues(fv)
+		if len(values) == 0 {
+			return nil, nil
+		}
+		if field.ci {
+			for i := range values {
+				values[i] = strings.ToLower(fmt.Sprint(values[i]))
 			}
 		}
+		return expr("? IN ?", values), nil
+	case QueryBetween:
+		values := queryValues(fv)
+		if len(values) != 2 {
+			return nil, fmt.Errorf("query field %s: between requires two values, got %d", field.name, len(values))
+		}
+		begin, end := reflect.ValueOf(values[0]), reflect.ValueOf(values[1])
+		switch {
+		case isEmptyQueryValue(begin) && isEmptyQueryValue(end):
+			return nil, nil
+		case isEmptyQueryValue(begin):
+			return expr("? <= ?", values[1]), nil
+		case isEmptyQueryValue(end):
+			return expr("? >= ?", values[0]), nil
+		default:
+			return expr("? BETWEEN ? AND ?", values[0], values[1]), nil
+		}
+	case QueryIsNull:
+		if fv.Bool() {
+			return expr("? IS NULL"), nil
+		}
+	case QueryNotNull:
+		if fv.Bool() {
+			return expr("? IS NOT NULL"), nil
+		}
+	}
+	return nil, nil
+}
+
+// queryValues 切片/数组转换为值列表, 字符串按逗号分隔
+func queryValues(fv reflect.Value) []interface{} {
+	values := make([]interface{}, 0)
+	if fv.Kind() == reflect.String {
+		if fv.Len() == 0 {
+			return values
+		}
+		for _, item := range strings.Split(fv.String(), ",") {
+			values = append(values, strings.TrimSpace(item))
+		}
+		return values
+	}
+	for i := 0; i < fv.Len(); i++ {
+		values = append(values, fv.Index(i).Interface())
 	}
+	return values
 }
 
 // WrapQuery 查询组装
@@ -105,28 +288,117 @@ func (wrapper *BaseQueryWrapper) WrapQuery(db *gorm.DB) {
 }
 
 func (wrapper *BaseQueryWrapper) PageScope() func(db *gorm.DB) *gorm.DB {
+	return wrapper.pageScope(0)
+}
+
+// pageScope extra 为多取的行数, 用于判断是否还有下一页
+func (wrapper *BaseQueryWrapper) pageScope(extra int) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
-		page := 1
-		pageSize := DefaultPageSize
-		orderBy := "id DESC"
-		if wrapper.BaseParams != nil {
-			if wrapper.BaseParams.PageNum > 0 {
-				page = wrapper.BaseParams.PageNum
-			}
-			if wrapper.BaseParams.PageSize > 0 {
-				pageSize = wrapper.BaseParams.PageSize
-			}
-			if len(wrapper.BaseParams.OrderBy) > 0 {
-				orderBy = wrapper.BaseParams.OrderBy
-			}
+		page, pageSize := wrapper.pageParams()
+		if wrapper.IsCursor() {
+			return db.Scopes(wrapper.cursorScope()).Limit(pageSize + extra)
 		}
 		return db.
 			Offset((page - 1) * pageSize).
-			Limit(pageSize).
-			Order(orderBy)
+			Limit(pageSize + extra).
+			Scopes(wrapper.OrderScope())
+	}
+}
+
+// pageParams 页码与分页大小
+func (wrapper *BaseQueryWrapper) pageParams() (page, pageSize int) {
+	page = 1
+	pageSize = DefaultPageSize
+	if wrapper.BaseParams != nil {
+		if wrapper.BaseParams.PageNum > 0 {
+			page = wrapper.BaseParams.PageNum
+		}
+		if wrapper.BaseParams.PageSize > 0 {
+			pageSize = wrapper.BaseParams.PageSize
+		}
+	}
+	return
+}
+
+// IsCursor 是否游标分页
+func (wrapper *BaseQueryWrapper) IsCursor() bool {
+	return wrapper.BaseParams != nil &&
+		(wrapper.BaseParams.PageMode == PageModeCursor || len(wrapper.BaseParams.Cursor) > 0)
+}
+
+// CountMode 总数统计方式
+func (wrapper *BaseQueryWrapper) CountMode() string {
+	if wrapper.BaseParams == nil || len(wrapper.BaseParams.CountMode) == 0 {
+		return CountExact
+	}
+	return wrapper.BaseParams.CountMode
+}
+
+// cursorScope 游标分页: 排序 + 游标条件
+func (wrapper *BaseQueryWrapper) cursorScope() func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		fields, err := wrapper.CursorOrderFields()
+		if err != nil {
+			_ = db.AddError(err)
+			return db
+		}
+		db.Clauses(orderByClause(fields))
+		if len(wrapper.BaseParams.Cursor) == 0 {
+			return db
+		}
+		values, err := DecodeCursor(wrapper.BaseParams.Cursor, fields)
+		if err != nil {
+			_ = db.AddError(err)
+			return db
+		}
+		return db.Where(keysetExpression(fields, values))
+	}
+}
+
+// CursorOrderFields 游标分页的排序字段, 末尾补充主键; 排序字段可能为 NULL 时返回 ErrValidation
+func (wrapper *BaseQueryWrapper) CursorOrderFields() ([]OrderField, error) {
+	fields, err := wrapper.OrderFields()
+	if err != nil {
+		return nil, err
+	}
+	if err = checkCursorOrderFields(fields); err != nil {
+		return nil, err
 	}
+	return cursorOrderFields(fields), nil
+}
+
+// OrderScope 排序, 排序字段经过 ParseOrderBy 校验
+func (wrapper *BaseQueryWrapper) OrderScope() func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		fields, err := wrapper.OrderFields()
+		if err != nil {
+			_ = db.AddError(err)
+			return db
+		}
+		return db.Clauses(orderByClause(fields))
+	}
+}
+
+// OrderFields 解析后的排序字段, 未指定时为 DefaultOrderBy
+func (wrapper *BaseQueryWrapper) OrderFields() ([]OrderField, error) {
+	orderBy := ""
+	if wrapper.BaseParams != nil {
+		orderBy = wrapper.BaseParams.OrderBy
+	}
+	fields, err := ParseOrderBy(wrapper.Engine, wrapper.ModelParams, orderBy)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return ParseOrderBy(wrapper.Engine, wrapper.ModelParams, DefaultOrderBy)
+	}
+	return fields, nil
 }
 
 func (wrapper *BaseQueryWrapper) PageResult(total int64) PageData {
-	return PageResult(wrapper.BaseParams.PageNum, wrapper.BaseParams.PageSize, int(total))
+	page, pageSize := wrapper.pageParams()
+	if wrapper.IsCursor() {
+		page = 0
+	}
+	return PageResult(page, pageSize, int(total))
 }
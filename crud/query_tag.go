@@ -0,0 +1,212 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"fmt"
+	"github.com/zhouhp1295/g3/helpers"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// query 标签支持的操作符
+// 例: `query:"eq"` `query:"like;ci"` `query:"gte;column:created_at"` `query:"in;must"`
+// 关联表字段: `gorm:"-" form:"customerName" query:"like;rel:Customer"`, 见 whereRelationField
+const (
+	QueryEq      = "eq"      // col = ?
+	QueryNe      = "ne"      // col <> ?
+	QueryGt      = "gt"      // col > ?
+	QueryGte     = "gte"     // col >= ?
+	QueryLt      = "lt"      // col < ?
+	QueryLte     = "lte"     // col <= ?
+	QueryLike    = "like"    // col LIKE %v%, v 中的 % _ 按原字符匹配
+	QueryPrefix  = "prefix"  // col LIKE v%
+	QuerySuffix  = "suffix"  // col LIKE %v
+	QueryIn      = "in"      // col IN (?), 字段为切片或逗号分隔的字符串
+	QueryBetween = "between" // col BETWEEN ? AND ?, 字段为两个元素的数组/切片或逗号分隔的字符串
+	QueryIsNull  = "isnull"  // col IS NULL, 字段为 bool, true 时生效
+	QueryNotNull = "notnull" // col IS NOT NULL, 字段为 bool, true 时生效
+)
+
+// query 标签支持的选项
+const (
+	queryOptMust   = "must"    // 不忽略空值(空字符串、数字0)
+	queryOptCi     = "ci"      // 忽略大小写
+	queryOptColumn = "column:" // 指定列名
+	queryOptRel    = "rel:"    // 关联表的字段, 值为关联字段名
+)
+
+var queryOps = []string{
+	QueryEq, QueryNe, QueryGt, QueryGte, QueryLt, QueryLte,
+	QueryLike, QueryPrefix, QuerySuffix, QueryIn, QueryBetween, QueryIsNull, QueryNotNull,
+}
+
+// queryField 一个带 query 标签的字段
+type queryField struct {
+	index  []int
+	name   string
+	column string
+	op     string
+	must   bool
+	ci     bool
+	rel    string
+}
+
+type queryFields struct {
+	fields []queryField
+	err    error
+}
+
+// queryFieldsCache reflect.Type => *queryFields
+var queryFieldsCache sync.Map
+
+// parseQueryFields 解析并校验类型的 query 标签, 每个类型只解析一次
+func parseQueryFields(t reflect.Type) ([]queryField, error) {
+	if cached, ok := queryFieldsCache.Load(t); ok {
+		qf := cached.(*queryFields)
+		return qf.fields, qf.err
+	}
+	qf := new(queryFields)
+	qf.fields, qf.err = walkQueryFields(t, nil)
+	cached, _ := queryFieldsCache.LoadOrStore(t, qf)
+	qf = cached.(*queryFields)
+	return qf.fields, qf.err
+}
+
+func walkQueryFields(t reflect.Type, parent []int) ([]queryField, error) {
+	fields := make([]queryField, 0)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		index := append(append(make([]int, 0, len(parent)+1), parent...), i)
+		tag, hasTag := sf.Tag.Lookup("query")
+		if !hasTag || len(tag) == 0 {
+			//未标注的结构体字段(如内嵌的 TailColumns)继续解析, 关联的模型除外
+			if sf.Type.Kind() == reflect.Struct && !reflect.PtrTo(sf.Type).Implements(modelInterfaceType) {
+				children, err := walkQueryFields(sf.Type, index)
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, children...)
+			}
+			continue
+		}
+		field, err := parseQueryTag(sf, tag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query tag on %s.%s: %w", t.Name(), sf.Name, err)
+		}
+		field.index = index
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func parseQueryTag(sf reflect.StructField, tag string) (queryField, error) {
+	field := queryField{name: sf.Name}
+	for _, item := range strings.Split(tag, ";") {
+		item = strings.TrimSpace(item)
+		lower := strings.ToLower(item)
+		switch {
+		case len(item) == 0:
+		case lower == queryOptMust:
+			field.must = true
+		case lower == queryOptCi:
+			field.ci = true
+		case strings.HasPrefix(lower, queryOptColumn):
+			field.column = strings.TrimSpace(item[len(queryOptColumn):])
+			if len(field.column) == 0 {
+				return field, fmt.Errorf("empty column")
+			}
+		case strings.HasPrefix(lower, queryOptRel):
+			field.rel = strings.TrimSpace(item[len(queryOptRel):])
+			if len(field.rel) == 0 {
+				return field, fmt.Errorf("empty relation")
+			}
+		case helpers.IndexOf[string](queryOps, lower) >= 0:
+			if len(field.op) > 0 {
+				return field, fmt.Errorf("duplicate operator %q and %q", field.op, lower)
+			}
+			field.op = lower
+		default:
+			return field, fmt.Errorf("unknown item %q", item)
+		}
+	}
+	if len(field.op) == 0 {
+		return field, fmt.Errorf("missing operator")
+	}
+	return field, checkQueryFieldType(field, sf.Type)
+}
+
+// checkQueryFieldType 校验操作符与字段类型是否匹配
+func checkQueryFieldType(field queryField, t reflect.Type) error {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch field.op {
+	case QueryIn, QueryBetween:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array && t.Kind() != reflect.String {
+			return fmt.Errorf("%s requires slice, array or string field", field.op)
+		}
+		if field.op == QueryBetween && t.Kind() == reflect.Array && t.Len() != 2 {
+			return fmt.Errorf("between requires two-element array")
+		}
+	case QueryIsNull, QueryNotNull:
+		if t.Kind() != reflect.Bool {
+			return fmt.Errorf("%s requires bool field", field.op)
+		}
+	case QueryLike, QueryPrefix, QuerySuffix:
+		if t.Kind() != reflect.String {
+			return fmt.Errorf("%s requires string field", field.op)
+		}
+	}
+	if field.ci {
+		if helpers.IndexOf[string]([]string{QueryEq, QueryNe, QueryLike, QueryPrefix, QuerySuffix, QueryIn}, field.op) < 0 {
+			return fmt.Errorf("ci is not supported by %s", field.op)
+		}
+		if (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.String {
+			return fmt.Errorf("ci requires string elements")
+		}
+		if t.Kind() != reflect.String && t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return fmt.Errorf("ci requires string field")
+		}
+	}
+	return nil
+}
+
+// ValidateQueryTags 校验模型(或查询参数结构体)的 query 标签, 可在启动时调用以尽早发现错误
+func ValidateQueryTags(params interface{}) error {
+	t := reflect.TypeOf(params)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return fmt.Errorf("query params must be struct, got %v", reflect.TypeOf(params))
+	}
+	_, err := parseQueryFields(t)
+	return err
+}
+
+// isEmptyQueryValue 空值判断, 与原有规则一致: 空字符串、有符号整数0; 另外 nil、空切片、零时间也视为空值
+// 无符号整数0 与原有规则一致, 仍作为条件值(如 status = 0)
+func isEmptyQueryValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.String:
+		return v.Len() == 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Bool:
+		return false
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.IsZero()
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateQueryTags(t *testing.T) {
+	cases := []struct {
+		name   string
+		params interface{}
+		err    string
+	}{
+		{"eq", &struct {
+			Name string `query:"eq"`
+		}{}, ""},
+		{"options", &struct {
+			Name string `query:"like;ci;must;column:user_name"`
+		}{}, ""},
+		{"in string", &struct {
+			Ids string `query:"in"`
+		}{}, ""},
+		{"between array", &struct {
+			Age [2]int `query:"between"`
+		}{}, ""},
+		{"isnull bool", &struct {
+			NoPhone bool `query:"isnull;column:phone"`
+		}{}, ""},
+		{"embedded", &struct {
+			TailColumns
+		}{}, ""},
+		{"missing operator", &struct {
+			Name string `query:"ci"`
+		}{}, "missing operator"},
+		{"unknown item", &struct {
+			Name string `query:"equals"`
+		}{}, "unknown item"},
+		{"duplicate operator", &struct {
+			Name string `query:"eq;ne"`
+		}{}, "duplicate operator"},
+		{"empty column", &struct {
+			Name string `query:"eq;column:"`
+		}{}, "empty column"},
+		{"like on int", &struct {
+			Age int `query:"like"`
+		}{}, "requires string field"},
+		{"in on int", &struct {
+			Age int `query:"in"`
+		}{}, "requires slice"},
+		{"between three", &struct {
+			Age [3]int `query:"between"`
+		}{}, "two-element array"},
+		{"isnull on string", &struct {
+			Name string `query:"isnull"`
+		}{}, "requires bool field"},
+		{"ci on gt", &struct {
+			Name string `query:"gt;ci"`
+		}{}, "ci is not supported"},
+		{"ci on int slice", &struct {
+			Ids []int `query:"in;ci"`
+		}{}, "ci requires string elements"},
+		{"not struct", 1, "must be struct"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateQueryTags(c.params)
+			switch {
+			case len(c.err) == 0 && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case len(c.err) > 0 && (err == nil || !strings.Contains(err.Error(), c.err)):
+				t.Fatalf("expected error containing %q, got %v", c.err, err)
+			}
+		})
+	}
+}
+
+// queryUser 各操作符的查询参数
+type queryUser struct {
+	BaseModel
+	ModelFactory[queryUser]
+	Name     string   `json:"name" query:"like;ci"`
+	Code     string   `json:"code" query:"prefix"`
+	Email    string   `json:"email" query:"suffix"`
+	Level    *uint    `json:"level" query:"eq"`
+	Age      int      `json:"age" query:"gte"`
+	MaxAge   int      `gorm:"-" json:"-" query:"lte;column:age"`
+	NotAge   int      `gorm:"-" json:"-" query:"ne;column:age"`
+	Tags     []string `gorm:"-" json:"-" query:"in;ci;column:tag"`
+	Tag      string   `json:"tag"`
+	Score    [2]int   `gorm:"-" json:"-" query:"between;column:points"`
+	Points   int      `json:"points"`
+	Phone    *string  `json:"phone"`
+	NoPhone  bool     `gorm:"-" json:"-" query:"isnull;column:phone"`
+	HasPhone bool     `gorm:"-" json:"-" query:"notnull;column:phone"`
+	Zero     *int     `gorm:"-" json:"-" query:"eq;column:points"`
+	TailColumns
+}
+
+func (*queryUser) Table() string { return "query_users" }
+
+func TestQueryOperators(t *testing.T) {
+	db := newTestDb(t, new(queryUser))
+	phone := "123"
+	levels := []uint{0, 2}
+	rows := []*queryUser{
+		{Name: "Alice", Code: "A-1", Email: "alice@a.com", Level: &levels[0], Age: 20, Tag: "Red", Points: 0, Phone: &phone},
+		{Name: "Bob", Code: "B-1", Email: "bob@b.com", Level: &levels[1], Age: 30, Tag: "blue", Points: 50},
+		{Name: "al_ice", Code: "A-2", Email: "x@a.com", Level: &levels[1], Age: 40, Tag: "green", Points: 100},
+	}
+	for _, row := range rows {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	zero := 0
+	cases := []struct {
+		name   string
+		params *queryUser
+		ids    []int64
+	}{
+		{"empty params", &queryUser{}, []int64{1, 2, 3}},
+		{"like ci", &queryUser{Name: "ALI"}, []int64{1}},
+		{"like escapes _", &queryUser{Name: "l_i"}, []int64{3}},
+		{"prefix", &queryUser{Code: "A-"}, []int64{1, 3}},
+		{"suffix", &queryUser{Email: "@a.com"}, []int64{1, 3}},
+		{"uint eq", &queryUser{Level: &levels[1]}, []int64{2, 3}},
+		{"gte", &queryUser{Age: 30}, []int64{2, 3}},
+		{"lte column", &queryUser{MaxAge: 30}, []int64{1, 2}},
+		{"ne", &queryUser{NotAge: 30}, []int64{1, 3}},
+		{"in ci", &queryUser{Tags: []string{"RED", "Blue"}}, []int64{1, 2}},
+		{"between", &queryUser{Score: [2]int{10, 100}}, []int64{2, 3}},
+		{"between open end", &queryUser{Score: [2]int{60, 0}}, []int64{3}},
+		{"isnull", &queryUser{NoPhone: true}, []int64{2, 3}},
+		{"notnull", &queryUser{HasPhone: true}, []int64{1}},
+		{"pointer zero", &queryUser{Zero: &zero}, []int64{1}},
+	}
+	dao := NewDao[*queryUser]()
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			list, err := dao.List(context.Background(), c.params, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := make([]int64, 0, len(list))
+			for _, row := range list {
+				ids = append(ids, row.Id)
+			}
+			sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+			if !reflect.DeepEqual(ids, c.ids) {
+				t.Fatalf("expected %v, got %v", c.ids, ids)
+			}
+		})
+	}
+
+	//无符号整数0 与原有规则一致, 作为条件值
+	ids := make([]int64, 0)
+	tx := db.Model(new(queryUser))
+	wrapperQuery("query_users", &struct {
+		Level uint `query:"eq"`
+	}{}, tx)
+	if err := tx.Pluck("id", &ids).Error; err != nil || !reflect.DeepEqual(ids, []int64{1}) {
+		t.Fatalf("uint zero: expected [1], got %v, %v", ids, err)
+	}
+}
+
+func TestIsEmptyQueryValue(t *testing.T) {
+	var nilSlice []string
+	cases := []struct {
+		value interface{}
+		empty bool
+	}{
+		{"", true},
+		{"a", false},
+		{0, true},
+		{int64(1), false},
+		{uint(0), false},
+		{uint8(0), false},
+		{uint64(3), false},
+		{nilSlice, true},
+		{[]int{1}, false},
+		{time.Time{}, true},
+		{time.Now(), false},
+		{false, false},
+		{0.0, false},
+	}
+	for _, c := range cases {
+		if got := isEmptyQueryValue(reflect.ValueOf(c.value)); got != c.empty {
+			t.Errorf("isEmptyQueryValue(%#v) = %v, want %v", c.value, got, c.empty)
+		}
+	}
+	if !isEmptyQueryValue(reflect.Value{}) {
+		t.Error("invalid value should be empty")
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"strings"
+)
+
+// IncludableInterface 可选, 模型声明可通过 include 参数加载的关联(json 名或字段名)
+// 也可在关联字段上标注 `include:"true"`; 两者都未声明时, 所有关联均可加载
+type IncludableInterface interface {
+	IncludableRelations() []string
+}
+
+// include 标签取值
+const (
+	IncludeAuto    = "true"    // 可加载, 一对一(belongs to/has one)使用 JOIN, 一对多/多对多使用 Preload
+	IncludePreload = "preload" // 可加载, 始终使用 Preload
+)
+
+// Include 解析后的关联
+type Include struct {
+	Relation *schema.Relationship
+	Join     bool // 使用 LEFT JOIN 加载, 否则使用 Preload
+}
+
+var modelInterfaceType = reflect.TypeOf((*ModelInterface)(nil)).Elem()
+
+// LookUpRelation 按 json 名、字段名查找关联
+func LookUpRelation(s *schema.Schema, name string) *schema.Relationship {
+	for _, rel := range s.Relationships.Relations {
+		if rel.Field != nil && JsonName(rel.Field) == name {
+			return rel
+		}
+	}
+	return s.Relationships.Relations[name]
+}
+
+// includableRelations 模型声明的可加载关联, nil 表示不限制
+func includableRelations(m ModelInterface, s *schema.Schema) []*schema.Relationship {
+	relations := make([]*schema.Relationship, 0)
+	if includable, ok := m.(IncludableInterface); ok {
+		for _, name := range includable.IncludableRelations() {
+			if rel := LookUpRelation(s, name); rel != nil {
+				relations = append(relations, rel)
+			}
+		}
+	}
+	for _, rel := range s.Relationships.Relations {
+		if rel.Field != nil && len(rel.Field.StructField.Tag.Get("include")) > 0 {
+			relations = append(relations, rel)
+		}
+	}
+	if len(relations) == 0 {
+		return nil
+	}
+	return relations
+}
+
+// ParseInclude 解析 include 参数, 如 "customer,items", 关联可为 json 名或字段名, engine 为模型所在数据库
+// 未知或不可加载的关联返回 ErrValidation
+func ParseInclude(engine string, m ModelInterface, include string) ([]Include, error) {
+	s, err := EngineModelSchema(engine, m)
+	if err != nil {
+		return nil, err
+	}
+	allowed := includableRelations(m, s)
+	result := make([]Include, 0)
+	for _, name := range strings.Split(include, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		rel := LookUpRelation(s, name)
+		if rel == nil {
+			return nil, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("unknown include %q", name)}
+		}
+		if allowed != nil && !containsRelation(allowed, rel) {
+			return nil, &DaoError{Kind: ErrValidation, Err: fmt.Errorf("include %q is not allowed", name)}
+		}
+		duplicate := false
+		for _, item := range result {
+			duplicate = duplicate || item.Relation == rel
+		}
+		if duplicate {
+			continue
+		}
+		join := rel.Type == schema.BelongsTo || rel.Type == schema.HasOne
+		if rel.Field.StructField.Tag.Get("include") == IncludePreload {
+			join = false
+		}
+		//JOIN 会查询关联表的全部列, 关联模型有敏感列或默认字段时使用 Preload
+		if m := relationModel(rel); m != nil && hasDefaultFields(engine, m) {
+			join = false
+		}
+		result = append(result, Include{Relation: rel, Join: join})
+	}
+	return result, nil
+}
+
+func containsRelation(relations []*schema.Relationship, rel *schema.Relationship) bool {
+	for _, item := range relations {
+		if item == rel {
+			return true
+		}
+	}
+	return false
+}
+
+// relationModel 关联的模型, 未实现 ModelInterface 时返回 nil
+func relationModel(rel *schema.Relationship) ModelInterface {
+	if m, ok := reflect.New(rel.FieldSchema.ModelType).Interface().(ModelInterface); ok {
+		return m
+	}
+	return nil
+}
+
+// relationScope 关联表的逻辑删除与租户过滤
+func relationScope(ctx context.Context, rel *schema.Relationship) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if _, ok := rel.FieldSchema.FieldsByDBName["deleted"]; ok {
+			db = db.Where(clause.Eq{Column: currentColumn("deleted"), Value: FlagNo})
+		}
+		if m := relationModel(rel); m != nil {
+			db = TenantScope(ctx, m)(db)
+		}
+		return db
+	}
+}
+
+// preloadScope Preload 关联的过滤条件与查询的列, 关联的键始终查询
+func preloadScope(ctx context.Context, rel *schema.Relationship) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = relationScope(ctx, rel)(db)
+		m := relationModel(rel)
+		if m == nil {
+			return db
+		}
+		keys := make([]*schema.Field, 0, len(rel.References))
+		for _, ref := range rel.References {
+			if rel.Type == schema.BelongsTo {
+				keys = append(keys, ref.PrimaryKey)
+			} else if rel.Type != schema.Many2Many {
+				keys = append(keys, ref.ForeignKey)
+			}
+		}
+		return relatedFieldsScope(m, keys...)(db)
+	}
+}
+
+// includeRelations 加载关联, JOIN 时关联表的过滤条件写在 ON 中, 不影响主表的行
+func includeRelations(db *gorm.DB, includes []Include) *gorm.DB {
+	ctx := db.Statement.Context
+	for _, include := range includes {
+		rel := include.Relation
+		if !include.Join {
+			db = db.Preload(rel.Name, preloadScope(ctx, rel))
+			continue
+		}
+		cond := relationScope(ctx, rel)(db.Session(&gorm.Session{NewDB: true}))
+		if cond.Error != nil {
+			_ = db.AddError(cond.Error)
+			return db
+		}
+		if _, ok := cond.Statement.Clauses["WHERE"]; ok {
+			db = db.Joins(rel.Name, cond)
+		} else {
+			db = db.Joins(rel.Name)
+		}
+	}
+	return db
+}
+
+// includeKeys 加载关联需要查询的本表外键(belongs to)
+func includeKeys(includes []Include) []*schema.Field {
+	keys := make([]*schema.Field, 0)
+	for _, include := range includes {
+		if include.Relation.Type != schema.BelongsTo {
+			continue
+		}
+		for _, ref := range include.Relation.References {
+			if ref.ForeignKey != nil && !ref.OwnPrimaryKey {
+				keys = append(keys, ref.ForeignKey)
+			}
+		}
+	}
+	return keys
+}
+
+// relationColumn 关联表字段条件的列名, 未指定 column 时去掉字段名中的关联名前缀, 如 CustomerName => name
+func relationColumn(rel *schema.Relationship, field queryField) (string, error) {
+	name := field.column
+	if len(name) == 0 {
+		name = strings.TrimPrefix(field.name, rel.Name)
+		if len(name) == 0 {
+			name = field.name
+		}
+	}
+	if f := rel.FieldSchema.LookUpField(name); f != nil && len(f.DBName) > 0 {
+		return f.DBName, nil
+	}
+	return "", fmt.Errorf("unknown column %q of relation %s", name, rel.Name)
+}
+
+// relationKeys 主表与子查询关联的列, 不支持复合键
+func relationKeys(rel *schema.Relationship) (own string, related string, err error) {
+	for _, ref := range rel.References {
+		if ref.PrimaryValue != "" {
+			continue
+		}
+		if len(own) > 0 && rel.Type != schema.Many2Many {
+			return "", "", fmt.Errorf("relation %s: composite keys are not supported", rel.Name)
+		}
+		switch {
+		case rel.Type == schema.BelongsTo:
+			own, related = ref.ForeignKey.DBName, ref.PrimaryKey.DBName
+		case ref.OwnPrimaryKey:
+			own = ref.PrimaryKey.DBName
+		}
+	}
+	if len(own) == 0 {
+		return "", "", fmt.Errorf("relation %s: no reference", rel.Name)
+	}
+	return own, related, nil
+}
+
+// whereRelationField 关联表字段的条件, 以子查询实现, 不需要 JOIN 且不影响总数统计
+//
+//	belongs to: own.fk IN (SELECT pk FROM related WHERE ...)
+//	has one/has many: own.pk IN (SELECT fk FROM related WHERE ...)
+//	many to many: own.pk IN (SELECT own_fk FROM join_table WHERE rel_fk IN (SELECT pk FROM related WHERE ...))
+func whereRelationField(db *gorm.DB, rel *schema.Relationship, field queryField, fv reflect.Value) error {
+	colName, err := relationColumn(rel, field)
+	if err != nil {
+		return err
+	}
+	own, related, err := relationKeys(rel)
+	if err != nil {
+		return err
+	}
+	sub := relationScope(db.Statement.Context, rel)(db.Session(&gorm.Session{NewDB: true}).Table(rel.FieldSchema.Table))
+	if sub.Error != nil {
+		return sub.Error
+	}
+	whereQueryField(sub, field, colName, fv)
+	switch rel.Type {
+	case schema.BelongsTo:
+		sub = sub.Select(related)
+	case schema.HasOne, schema.HasMany:
+		for _, ref := range rel.References {
+			if ref.PrimaryValue != "" {
+				//多态关联的类型条件
+				sub = sub.Where(clause.Eq{Column: currentColumn(ref.ForeignKey.DBName), Value: ref.PrimaryValue})
+			} else {
+				sub = sub.Select(ref.ForeignKey.DBName)
+			}
+		}
+	case schema.Many2Many:
+		var ownFk, relFk, relPk string
+		for _, ref := range rel.References {
+			if ref.OwnPrimaryKey {
+				ownFk = ref.ForeignKey.DBName
+			} else if ref.PrimaryValue == "" {
+				relFk, relPk = ref.ForeignKey.DBName, ref.PrimaryKey.DBName
+			}
+		}
+		sub = db.Session(&gorm.Session{NewDB: true}).
+			Table(rel.JoinTable.Table).
+			Select(ownFk).
+			Where("? IN (?)", currentColumn(relFk), sub.Select(relPk))
+	default:
+		return fmt.Errorf("relation %s: unsupported type %s", rel.Name, rel.Type)
+	}
+	db.Where("? IN (?)", currentColumn(own), sub)
+	return nil
+}
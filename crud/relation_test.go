@@ -0,0 +1,186 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// relCustomer 关联的租户模型
+type relCustomer struct {
+	BaseModel
+	ModelFactory[relCustomer]
+	Name string `json:"name"`
+	TenantColumns
+	TailColumns
+}
+
+func (*relCustomer) Table() string { return "rel_customers" }
+
+// relItem 关联的明细
+type relItem struct {
+	BaseModel
+	ModelFactory[relItem]
+	OrderId int64  `json:"orderId"`
+	Name    string `json:"name"`
+	TailColumns
+}
+
+func (*relItem) Table() string { return "rel_items" }
+
+// relOrder 带一对一、一对多关联及关联字段条件的模型
+type relOrder struct {
+	BaseModel
+	ModelFactory[relOrder]
+	Title        string       `json:"title"`
+	CustomerId   int64        `json:"customerId"`
+	Customer     *relCustomer `json:"customer" include:"true"`
+	OwnerId      int64        `json:"ownerId"`
+	Owner        *relCustomer `gorm:"foreignKey:OwnerId" json:"owner" include:"preload"`
+	Items        []*relItem   `gorm:"foreignKey:OrderId" json:"items" include:"true"`
+	CustomerName string       `gorm:"-" json:"-" query:"like;rel:Customer"`
+	ItemName     string       `gorm:"-" json:"-" query:"eq;rel:Items;column:name"`
+	TailColumns
+}
+
+func (*relOrder) Table() string { return "rel_orders" }
+
+// newRelationDao 客户 1、3 属于租户 1(3 已删除), 客户 2 属于租户 2; 订单 i 的客户为 i
+func newRelationDao(t *testing.T) (*Dao[*relOrder], *sqlCounter) {
+	db := newTestDb(t, new(relCustomer), new(relItem), new(relOrder))
+	rows := []interface{}{
+		&relCustomer{Name: "ann", TenantColumns: TenantColumns{TenantId: 1}},
+		&relCustomer{Name: "anna", TenantColumns: TenantColumns{TenantId: 2}},
+		&relCustomer{Name: "annie", TenantColumns: TenantColumns{TenantId: 1}, TailColumns: TailColumns{Deleted: FlagYes}},
+		&relOrder{Title: "o1", CustomerId: 1, OwnerId: 2},
+		&relOrder{Title: "o2", CustomerId: 2, OwnerId: 1},
+		&relOrder{Title: "o3", CustomerId: 3, OwnerId: 3},
+		&relItem{OrderId: 1, Name: "pen"},
+		&relItem{OrderId: 1, Name: "ink", TailColumns: TailColumns{Deleted: FlagYes}},
+		&relItem{OrderId: 2, Name: "pen"},
+		&relItem{OrderId: 3, Name: "ink", TailColumns: TailColumns{Deleted: FlagYes}},
+	}
+	for _, row := range rows {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewDao[*relOrder](), countSql(db)
+}
+
+func TestParseInclude(t *testing.T) {
+	cases := []struct {
+		include string
+		join    []bool
+		err     bool
+	}{
+		{"customer", []bool{true}, false},
+		{"Customer,customer", []bool{true}, false},
+		{"owner", []bool{false}, false},
+		{"items", []bool{false}, false},
+		{"customer, items", []bool{true, false}, false},
+		{"unknown", nil, true},
+	}
+	for _, c := range cases {
+		includes, err := ParseInclude(DefaultDbEngine, new(relOrder), c.include)
+		if c.err {
+			if !errors.Is(err, ErrValidation) {
+				t.Errorf("%q: expected ErrValidation, got %v", c.include, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %v", c.include, err)
+		}
+		join := make([]bool, 0, len(includes))
+		for _, include := range includes {
+			join = append(join, include.Join)
+		}
+		if !reflect.DeepEqual(join, c.join) {
+			t.Errorf("%q: expected join %v, got %v", c.include, c.join, join)
+		}
+	}
+}
+
+func TestIncludeRelations(t *testing.T) {
+	dao, counter := newRelationDao(t)
+	ctx := WithTenant(context.Background(), 1)
+	list, err := dao.List(ctx, &relOrder{}, &BaseQueryParams{Include: "customer,owner,items", OrderBy: "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("expected filtered relations not to drop orders, got %d", len(list))
+	}
+	joined := false
+	for _, statement := range counter.statements {
+		joined = joined || strings.Contains(statement, "JOIN `rel_customers` `Customer`")
+	}
+	if !joined {
+		t.Fatalf("expected customer loaded with JOIN, got %v", counter.statements)
+	}
+
+	names := func(customer *relCustomer) string {
+		if customer == nil {
+			return ""
+		}
+		return customer.Name
+	}
+	cases := []struct {
+		customer string
+		owner    string
+		items    int
+	}{
+		{"ann", "", 1}, //负责人属于其他租户
+		{"", "ann", 1}, //客户属于其他租户, 明细不受租户限制
+		{"", "", 0},    //客户、明细已删除
+	}
+	for i, c := range cases {
+		order := list[i]
+		if got := names(order.Customer); got != c.customer {
+			t.Errorf("order %d: expected customer %q, got %q", order.Id, c.customer, got)
+		}
+		if got := names(order.Owner); got != c.owner {
+			t.Errorf("order %d: expected owner %q, got %q", order.Id, c.owner, got)
+		}
+		if len(order.Items) != c.items {
+			t.Errorf("order %d: expected %d items, got %d", order.Id, c.items, len(order.Items))
+		}
+	}
+}
+
+func TestRelationQueryTags(t *testing.T) {
+	dao, _ := newRelationDao(t)
+	ctx := WithTenant(context.Background(), 1)
+	cases := []struct {
+		name   string
+		params *relOrder
+		ids    []int64
+	}{
+		{"belongs to", &relOrder{CustomerName: "ann"}, []int64{1}},
+		{"has many", &relOrder{ItemName: "pen"}, []int64{1, 2}},
+		{"deleted items", &relOrder{ItemName: "ink"}, []int64{}},
+		{"both", &relOrder{CustomerName: "ann", ItemName: "pen"}, []int64{1}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			list, err := dao.List(ctx, c.params, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := make([]int64, 0, len(list))
+			for _, row := range list {
+				ids = append(ids, row.Id)
+			}
+			sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+			if !reflect.DeepEqual(ids, c.ids) {
+				t.Fatalf("expected %v, got %v", c.ids, ids)
+			}
+		})
+	}
+}
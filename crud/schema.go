@@ -0,0 +1,89 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"strings"
+	"sync"
+)
+
+var (
+	// schemaCache 未注册数据库时的缓存, 使用默认的 NamingStrategy
+	schemaCache = new(sync.Map)
+	// dbSchemaCaches 按数据库(*gorm.Config)缓存, 各数据库的 NamingStrategy 可能不同
+	dbSchemaCaches = new(sync.Map)
+)
+
+// ModelSchema 按默认数据库的 NamingStrategy 解析模型的 gorm schema, 结果缓存
+func ModelSchema(m ModelInterface) (*schema.Schema, error) {
+	return EngineModelSchema(DefaultDbEngine, m)
+}
+
+// EngineModelSchema 按数据库 engine 的 NamingStrategy 解析模型的 gorm schema, 结果按数据库缓存
+// 数据库未注册时使用默认的 NamingStrategy
+func EngineModelSchema(engine string, m ModelInterface) (*schema.Schema, error) {
+	group, err := lookUpDbEngine(engine)
+	if err != nil {
+		return dbModelSchema(nil, m)
+	}
+	return dbModelSchema(group.primary, m)
+}
+
+// dbModelSchema 按会话 db 所在数据库的 NamingStrategy 解析, db 为 nil 时使用默认的 NamingStrategy
+func dbModelSchema(db *gorm.DB, m ModelInterface) (*schema.Schema, error) {
+	if db == nil || db.Config == nil || db.NamingStrategy == nil {
+		return schema.ParseWithSpecialTableName(m, schemaCache, schema.NamingStrategy{}, m.Table())
+	}
+	cache, _ := dbSchemaCaches.LoadOrStore(db.Config, new(sync.Map))
+	return schema.ParseWithSpecialTableName(m, cache.(*sync.Map), db.NamingStrategy, m.Table())
+}
+
+// JsonName 字段的 json 名, 未标注时为字段名, json:"-" 时为空
+func JsonName(field *schema.Field) string {
+	tag, ok := field.StructField.Tag.Lookup("json")
+	if !ok {
+		return field.Name
+	}
+	name := strings.Split(tag, ",")[0]
+	if name == "-" {
+		return ""
+	}
+	if len(name) == 0 {
+		return field.Name
+	}
+	return name
+}
+
+// LookUpField 按 json 名、字段名、列名查找字段
+func LookUpField(s *schema.Schema, name string) *schema.Field {
+	for _, field := range s.Fields {
+		if len(field.DBName) > 0 && JsonName(field) == name {
+			return field
+		}
+	}
+	if field := s.LookUpField(name); field != nil && len(field.DBName) > 0 {
+		return field
+	}
+	return nil
+}
+
+var (
+	registeredModels   []ModelInterface
+	registeredModelsMu sync.Mutex
+)
+
+// RegisterModels 注册模型, 用于 DetectSchemaDrift 等需要遍历全部模型的功能
+func RegisterModels(models ...ModelInterface) {
+	registeredModelsMu.Lock()
+	defer registeredModelsMu.Unlock()
+	registeredModels = append(registeredModels, models...)
+}
+
+// RegisteredModels 已注册的模型
+func RegisteredModels() []ModelInterface {
+	registeredModelsMu.Lock()
+	defer registeredModelsMu.Unlock()
+	return append(make([]ModelInterface, 0, len(registeredModels)), registeredModels...)
+}
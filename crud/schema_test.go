@@ -0,0 +1,61 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestEngineModelSchema(t *testing.T) {
+	newTestDb(t)
+	dsn := fmt.Sprintf("file:test%d?mode=memory&cache=shared", atomic.AddInt64(&testDbSeq, 1))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger:         logger.Discard,
+		NamingStrategy: schema.NamingStrategy{NameReplacer: strings.NewReplacer("Username", "Login")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(new(testUser)); err != nil {
+		t.Fatal(err)
+	}
+	RegisterDbEngine("renamed", db)
+
+	for engine, column := range map[string]string{DefaultDbEngine: "username", "renamed": "login"} {
+		s, err := EngineModelSchema(engine, new(testUser))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if field := LookUpField(s, "username"); field == nil || field.DBName != column {
+			t.Fatalf("%s: expected column %q, got %+v", engine, column, field)
+		}
+	}
+
+	ctx := context.Background()
+	dao := &BaseDao{Model: new(testUser), Engine: "renamed"}
+	for _, name := range []string{"alice", "bob"} {
+		if err = dao.InsertContext(ctx, &testUser{Username: name}, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rows, err := dao.FindListContext(ctx, nil, &BaseQueryParams{OrderBy: "-username", Fields: "username", Filter: "username:in:alice|bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := rows.([]*testUser)
+	if len(users) != 2 || users[0].Username != "bob" || users[1].Username != "alice" {
+		t.Fatalf("unexpected rows %+v", users)
+	}
+	columns, err := ExportColumns(ctx, "renamed", new(testUser), "username")
+	if err != nil || len(columns) != 1 || columns[0].Field.DBName != "login" {
+		t.Fatalf("unexpected export columns %+v, %v", columns, err)
+	}
+}
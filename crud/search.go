@@ -0,0 +1,281 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// SearchableInterface 可选, 模型声明 keyword 参数搜索的字段(json 名、字段名或列名)
+// 也可在字段上标注 `searchable:"true"`; 都未声明时不支持 keyword 参数
+type SearchableInterface interface {
+	SearchableFields() []string
+}
+
+// LikeEscape LIKE 条件使用的转义字符, 用户输入中的 % _ 按原字符匹配
+const LikeEscape = "!"
+
+const likeEscapeClause = " ESCAPE '" + LikeEscape + "'"
+
+var likeReplacer = strings.NewReplacer(LikeEscape, LikeEscape+LikeEscape, "%", LikeEscape+"%", "_", LikeEscape+"_")
+
+// EscapeLike 转义 LIKE 的通配符, 与 ESCAPE '!' 一起使用
+func EscapeLike(s string) string {
+	return likeReplacer.Replace(s)
+}
+
+// searchableFields 模型声明的可搜索字段
+func searchableFields(m ModelInterface, s *schema.Schema) []*schema.Field {
+	fields := make([]*schema.Field, 0)
+	if searchable, ok := m.(SearchableInterface); ok {
+		for _, name := range searchable.SearchableFields() {
+			if field := LookUpField(s, name); field != nil {
+				fields = append(fields, field)
+			}
+		}
+	}
+	for _, field := range s.Fields {
+		if len(field.DBName) > 0 && field.StructField.Tag.Get("searchable") == "true" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// SearchBackend 关键字搜索的实现, 返回的条件与其他查询条件 AND 组合
+// db 为当前查询, 需要查询数据库时使用 db.Session(&gorm.Session{NewDB: true})
+type SearchBackend interface {
+	SearchExpression(db *gorm.DB, table string, columns []string, keyword string) (clause.Expression, error)
+}
+
+// searchBackends 数据库类型(Dialector.Name) => SearchBackend
+var searchBackends sync.Map
+
+func init() {
+	RegisterSearchBackend("mysql", MysqlFullTextSearch{})
+	RegisterSearchBackend("postgres", PostgresFullTextSearch{})
+	RegisterSearchBackend("sqlite", SqliteFtsSearch{})
+}
+
+// RegisterSearchBackend 设置数据库类型使用的搜索实现, 未设置的数据库使用 LikeSearch
+// 内置的全文搜索在表没有对应索引时使用 LikeSearch, 不需要全文搜索时可设置为 LikeSearch{}
+func RegisterSearchBackend(dialect string, backend SearchBackend) {
+	searchBackends.Store(dialect, backend)
+}
+
+func searchBackend(dialect string) SearchBackend {
+	if backend, ok := searchBackends.Load(dialect); ok {
+		return backend.(SearchBackend)
+	}
+	return LikeSearch{}
+}
+
+// whereKeyword 关键字搜索条件, 未声明可搜索字段时返回 ErrValidation
+func whereKeyword(db *gorm.DB, m ModelInterface, keyword string) {
+	keyword = strings.TrimSpace(keyword)
+	if len(keyword) == 0 {
+		return
+	}
+	s, err := dbModelSchema(db, m)
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	fields := searchableFields(m, s)
+	if len(fields) == 0 {
+		_ = db.AddError(&DaoError{Kind: ErrValidation, Err: fmt.Errorf("%s does not support keyword search", m.Table())})
+		return
+	}
+	columns := make([]string, 0, len(fields))
+	for _, field := range fields {
+		columns = append(columns, field.DBName)
+	}
+	expr, err := searchBackend(db.Dialector.Name()).SearchExpression(db, m.Table(), columns, keyword)
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	db.Where(expr)
+}
+
+// LikeSearch 各列 LIKE %keyword% 以 OR 组合
+type LikeSearch struct{}
+
+func (LikeSearch) SearchExpression(db *gorm.DB, table string, columns []string, keyword string) (clause.Expression, error) {
+	pattern := "%" + EscapeLike(keyword) + "%"
+	ors := make([]clause.Expression, 0, len(columns))
+	for _, column := range columns {
+		ors = append(ors, clause.Expr{
+			SQL:  "? LIKE ?" + likeEscapeClause,
+			Vars: []interface{}{clause.Column{Table: table, Name: column}, pattern},
+		})
+	}
+	if len(ors) == 1 {
+		return ors[0], nil
+	}
+	return clause.Or(ors...), nil
+}
+
+// fullTextCache 表是否有全文索引, 每个数据库与表只检查一次
+var fullTextCache sync.Map
+
+// fullTextKey 按数据库类型、连接池与表缓存; Session 会复制 Config, 但连接池在同一数据库的会话间不变
+type fullTextKey struct {
+	dialect string
+	pool    gorm.ConnPool
+	table   string
+}
+
+// detectFullText 检查表的全文索引信息, 结果按数据库与表缓存
+func detectFullText(db *gorm.DB, table string, detect func(tx *gorm.DB) (interface{}, error)) (interface{}, error) {
+	key := fullTextKey{dialect: db.Dialector.Name(), pool: db.Config.ConnPool, table: table}
+	if cached, ok := fullTextCache.Load(key); ok {
+		return cached, nil
+	}
+	info, err := detect(db.Session(&gorm.Session{NewDB: true}))
+	if err != nil {
+		return nil, err
+	}
+	fullTextCache.Store(key, info)
+	return info, nil
+}
+
+// searchTerms 关键字拆分为词, 去掉全文搜索的运算符
+func searchTerms(keyword string, operators string) []string {
+	terms := make([]string, 0)
+	for _, term := range strings.FieldsFunc(keyword, unicode.IsSpace) {
+		term = strings.Trim(strings.Map(func(r rune) rune {
+			if strings.ContainsRune(operators, r) {
+				return ' '
+			}
+			return r
+		}, term), " ")
+		if len(term) > 0 {
+			terms = append(terms, strings.Fields(term)...)
+		}
+	}
+	return terms
+}
+
+// MysqlFullTextSearch 表有与可搜索列完全一致的 FULLTEXT 索引时使用 MATCH ... AGAINST(BOOLEAN MODE), 各词前缀匹配且都需出现
+type MysqlFullTextSearch struct{}
+
+func (MysqlFullTextSearch) SearchExpression(db *gorm.DB, table string, columns []string, keyword string) (clause.Expression, error) {
+	info, err := detectFullText(db, table, func(tx *gorm.DB) (interface{}, error) {
+		rows := make([]struct {
+			IndexName  string
+			ColumnName string
+		}, 0)
+		err := tx.Raw("SELECT INDEX_NAME AS index_name, COLUMN_NAME AS column_name FROM information_schema.STATISTICS "+
+			"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_TYPE = 'FULLTEXT'", table).Scan(&rows).Error
+		indexes := make(map[string][]string)
+		for _, row := range rows {
+			indexes[row.IndexName] = append(indexes[row.IndexName], row.ColumnName)
+		}
+		return indexes, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	terms := searchTerms(keyword, `+-<>()~*"@`)
+	for _, indexColumns := range info.(map[string][]string) {
+		if !sameColumns(indexColumns, columns) || len(terms) == 0 {
+			continue
+		}
+		vars := make([]interface{}, 0, len(columns)+1)
+		for _, column := range columns {
+			vars = append(vars, clause.Column{Table: table, Name: column})
+		}
+		against := make([]string, 0, len(terms))
+		for _, term := range terms {
+			against = append(against, "+"+term+"*")
+		}
+		vars = append(vars, strings.Join(against, " "))
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",")
+		return clause.Expr{SQL: "MATCH(" + placeholders + ") AGAINST (? IN BOOLEAN MODE)", Vars: vars}, nil
+	}
+	return LikeSearch{}.SearchExpression(db, table, columns, keyword)
+}
+
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, column := range a {
+		found := false
+		for _, other := range b {
+			found = found || strings.EqualFold(column, other)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchVectorColumn postgres 全文搜索使用的 tsvector 列, 一般为生成列
+// 如 search_vector tsvector GENERATED ALWAYS AS (to_tsvector('simple', title || ' ' || content)) STORED
+var SearchVectorColumn = "search_vector"
+
+// PostgresFullTextSearch 表有 SearchVectorColumn 列时使用 @@ plainto_tsquery, Config 为空时使用数据库默认配置
+type PostgresFullTextSearch struct {
+	Config string
+}
+
+func (search PostgresFullTextSearch) SearchExpression(db *gorm.DB, table string, columns []string, keyword string) (clause.Expression, error) {
+	info, err := detectFullText(db, table, func(tx *gorm.DB) (interface{}, error) {
+		var cnt int64
+		err := tx.Raw("SELECT count(*) FROM information_schema.columns "+
+			"WHERE table_schema = current_schema() AND table_name = ? AND column_name = ? AND data_type = 'tsvector'",
+			table, SearchVectorColumn).Scan(&cnt).Error
+		return cnt > 0, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !info.(bool) {
+		return LikeSearch{}.SearchExpression(db, table, columns, keyword)
+	}
+	column := clause.Column{Table: table, Name: SearchVectorColumn}
+	if len(search.Config) > 0 {
+		return clause.Expr{SQL: "? @@ plainto_tsquery(?::regconfig, ?)", Vars: []interface{}{column, search.Config, keyword}}, nil
+	}
+	return clause.Expr{SQL: "? @@ plainto_tsquery(?)", Vars: []interface{}{column, keyword}}, nil
+}
+
+// SearchFtsSuffix sqlite FTS5 表名的后缀, 如 articles 对应 articles_fts
+// FTS5 表的 rowid 需与主表的 id 一致, 如 CREATE VIRTUAL TABLE articles_fts USING fts5(title, content, content='articles', content_rowid='id')
+var SearchFtsSuffix = "_fts"
+
+// SqliteFtsSearch 有对应的 FTS5 表时使用 MATCH, 各词前缀匹配且都需出现
+type SqliteFtsSearch struct{}
+
+func (SqliteFtsSearch) SearchExpression(db *gorm.DB, table string, columns []string, keyword string) (clause.Expression, error) {
+	fts := table + SearchFtsSuffix
+	info, err := detectFullText(db, table, func(tx *gorm.DB) (interface{}, error) {
+		var cnt int64
+		err := tx.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", fts).Scan(&cnt).Error
+		return cnt > 0, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	terms := searchTerms(keyword, `"`)
+	if !info.(bool) || len(terms) == 0 {
+		return LikeSearch{}.SearchExpression(db, table, columns, keyword)
+	}
+	quoted := make([]string, 0, len(terms))
+	for _, term := range terms {
+		quoted = append(quoted, `"`+term+`"*`)
+	}
+	return clause.Expr{
+		SQL:  "? IN (SELECT rowid FROM ? WHERE ? MATCH ?)",
+		Vars: []interface{}{clause.Column{Table: table, Name: "id"}, clause.Table{Name: fts}, clause.Table{Name: fts}, strings.Join(quoted, " ")},
+	}, nil
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestDetectFullTextCached(t *testing.T) {
+	detected := 0
+	detect := func(tx *gorm.DB) (interface{}, error) {
+		detected++
+		return detected, nil
+	}
+	db := newTestDb(t)
+	for i := 0; i < 3; i++ {
+		//每次查询都是新的会话, 也在事务中查询
+		if _, err := detectFullText(DbSessContext(context.Background()), "search_items", detect); err != nil {
+			t.Fatal(err)
+		}
+		_ = WithTx(context.Background(), func(ctx context.Context) error {
+			_, err := detectFullText(DbSessContext(ctx), "search_items", detect)
+			return err
+		})
+	}
+	if detected != 1 {
+		t.Fatalf("expected detection to run once, ran %d times", detected)
+	}
+	if _, err := detectFullText(db.Session(&gorm.Session{}), "other_items", detect); err != nil || detected != 2 {
+		t.Fatalf("expected detection for another table, ran %d times: %v", detected, err)
+	}
+	//另一个数据库重新检查
+	newTestDb(t)
+	if _, err := detectFullText(DbSessContext(context.Background()), "search_items", detect); err != nil || detected != 3 {
+		t.Fatalf("expected detection for another database, ran %d times: %v", detected, err)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TenantColumn 租户列
+const TenantColumn = "tenant_id"
+
+// ErrTenantRequired 租户模型的操作缺少租户
+var ErrTenantRequired = errors.New("tenant required")
+
+// TenantModelInterface 租户模型, 内嵌 TenantColumns 即可
+// BaseDao 对租户模型的所有操作都会按 ctx 中的租户过滤, 插入时写入租户
+type TenantModelInterface interface {
+	GetTenantId() int64
+	SetTenantId(tenant int64)
+}
+
+// TenantColumns 租户列
+type TenantColumns struct {
+	TenantId int64 `gorm:"NOT NULL;DEFAULT:0;INDEX;COMMENT:租户" json:"-"`
+}
+
+func (tenantColumns *TenantColumns) GetTenantId() int64 {
+	return tenantColumns.TenantId
+}
+
+func (tenantColumns *TenantColumns) SetTenantId(tenant int64) {
+	tenantColumns.TenantId = tenant
+}
+
+type tenantContextKey struct{}
+
+type skipTenantContextKey struct{}
+
+// WithTenant ctx 中设置租户
+func WithTenant(ctx context.Context, tenant int64) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// TenantFromContext 取 ctx 中的租户
+func TenantFromContext(ctx context.Context) (int64, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	tenant, ok := ctx.Value(tenantContextKey{}).(int64)
+	return tenant, ok
+}
+
+// WithoutTenantScope 跨租户操作(如后台管理任务), 不再按租户过滤, 插入时保留模型上的租户
+func WithoutTenantScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipTenantContextKey{}, true)
+}
+
+func skipTenantScope(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	skip, _ := ctx.Value(skipTenantContextKey{}).(bool)
+	return skip
+}
+
+// IsTenantModel 是否租户模型
+func IsTenantModel(m ModelInterface) bool {
+	_, ok := m.(TenantModelInterface)
+	return ok
+}
+
+// TenantScope 租户过滤, 非租户模型或跨租户操作时不处理
+func TenantScope(ctx context.Context, m ModelInterface) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if !IsTenantModel(m) || skipTenantScope(ctx) {
+			return db
+		}
+		tenant, ok := TenantFromContext(ctx)
+		if !ok {
+			_ = db.AddError(ErrTenantRequired)
+			return db
+		}
+		return db.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: TenantColumn}, Value: tenant})
+	}
+}
+
+// fillTenant 插入前写入租户
+func fillTenant(ctx context.Context, m ModelInterface) error {
+	tm, ok := m.(TenantModelInterface)
+	if !ok || skipTenantScope(ctx) {
+		return nil
+	}
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return ErrTenantRequired
+	}
+	tm.SetTenantId(tenant)
+	return nil
+}
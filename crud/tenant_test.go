@@ -0,0 +1,116 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// tenantUser 租户模型
+type tenantUser struct {
+	BaseModel
+	ModelFactory[tenantUser]
+	Username string `json:"username" form:"username" query:"eq"`
+	TenantColumns
+	TailColumns
+}
+
+func (*tenantUser) Table() string { return "tenant_users" }
+
+func TestTenantScope(t *testing.T) {
+	newTestDb(t, new(tenantUser))
+	dao := &BaseDao{Model: new(tenantUser)}
+	ctx1 := WithTenant(context.Background(), 1)
+	ctx2 := WithTenant(context.Background(), 2)
+
+	u := &tenantUser{Username: "a", TenantColumns: TenantColumns{TenantId: 2}}
+	if err := dao.InsertContext(ctx1, u, 1); err != nil {
+		t.Fatal(err)
+	}
+	if u.TenantId != 1 {
+		t.Fatalf("expected tenant 1 filled on insert, got %d", u.TenantId)
+	}
+	if m, err := dao.FindByPkContext(ctx1, u.Id); err != nil || m.(*tenantUser).TenantId != 1 {
+		t.Fatalf("own tenant: got %v, %v", m, err)
+	}
+
+	if _, err := dao.FindByPkContext(ctx2, u.Id); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("FindByPk: expected ErrNotFound, got %v", err)
+	}
+	if err := dao.UpdateContext(ctx2, &tenantUser{BaseModel: BaseModel{Id: u.Id}, Username: "b"}, 2); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Update: expected ErrNotFound, got %v", err)
+	}
+	if err := dao.RemoveByPkContext(ctx2, u.Id); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Remove: expected ErrNotFound, got %v", err)
+	}
+	if cnt, err := dao.CountByPkContext(ctx2, u.Id); err != nil || cnt != 0 {
+		t.Fatalf("Count: expected 0, got %d, %v", cnt, err)
+	}
+	if m, err := dao.FindByPkContext(ctx1, u.Id); err != nil || m.(*tenantUser).Username != "a" {
+		t.Fatalf("row changed by another tenant: got %v, %v", m, err)
+	}
+}
+
+func TestTenantRequired(t *testing.T) {
+	newTestDb(t, new(tenantUser))
+	dao := &BaseDao{Model: new(tenantUser)}
+	ctx := context.Background()
+
+	if err := dao.InsertContext(ctx, &tenantUser{Username: "a"}, 1); !errors.Is(err, ErrTenantRequired) {
+		t.Fatalf("Insert: expected ErrTenantRequired, got %v", err)
+	}
+	if _, err := dao.FindByPkContext(ctx, 1); !errors.Is(err, ErrTenantRequired) {
+		t.Fatalf("FindByPk: expected ErrTenantRequired, got %v", err)
+	}
+	if _, err := dao.CountContext(ctx, "1 = 1"); !errors.Is(err, ErrTenantRequired) {
+		t.Fatalf("Count: expected ErrTenantRequired, got %v", err)
+	}
+	if _, _, err := dao.FindPageContext(ctx, nil, nil); !errors.Is(err, ErrTenantRequired) {
+		t.Fatalf("FindPage: expected ErrTenantRequired, got %v", err)
+	}
+}
+
+func TestWithoutTenantScope(t *testing.T) {
+	newTestDb(t, new(tenantUser))
+	dao := &BaseDao{Model: new(tenantUser)}
+	ctx := WithoutTenantScope(context.Background())
+
+	for tenant := int64(1); tenant <= 2; tenant++ {
+		u := &tenantUser{Username: "a", TenantColumns: TenantColumns{TenantId: tenant}}
+		if err := dao.InsertContext(ctx, u, 1); err != nil {
+			t.Fatal(err)
+		}
+		if u.TenantId != tenant {
+			t.Fatalf("expected tenant %d kept on insert, got %d", tenant, u.TenantId)
+		}
+	}
+	if cnt, err := dao.CountContext(ctx, "1 = 1"); err != nil || cnt != 2 {
+		t.Fatalf("expected rows of all tenants, got %d, %v", cnt, err)
+	}
+	if cnt, err := dao.CountContext(WithTenant(context.Background(), 2), "1 = 1"); err != nil || cnt != 1 {
+		t.Fatalf("expected rows of tenant 2, got %d, %v", cnt, err)
+	}
+}
+
+func TestEstimateCountConditions(t *testing.T) {
+	db := newTestDb(t, new(testUser))
+	cases := []struct {
+		name   string
+		params *testUser
+		base   *BaseQueryParams
+		want   bool
+	}{
+		{"none", new(testUser), nil, false},
+		{"empty params", new(testUser), &BaseQueryParams{CountMode: CountEstimate}, false},
+		{"query tag", &testUser{Username: "a"}, nil, true},
+		{"time range", new(testUser), &BaseQueryParams{BeginTime: "2022-01-01"}, true},
+	}
+	for _, c := range cases {
+		wrapper := &BaseQueryWrapper{ModelParams: c.params, BaseParams: c.base}
+		if got := wrapper.hasConditions(db); got != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
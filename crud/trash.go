@@ -0,0 +1,105 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"time"
+)
+
+// 删除信息列
+const (
+	DeletedAtColumn = "deleted_at"
+	DeletedByColumn = "deleted_by"
+)
+
+// DeletedModelInterface 记录删除人与删除时间的模型, 内嵌 DeletedColumns 即可
+// 逻辑删除时写入, 恢复时清空; PurgeDeleted 以删除时间判断保留期, 未实现时以 updated_at 判断
+type DeletedModelInterface interface {
+	GetDeletedAt() *time.Time
+	GetDeletedBy() int64
+}
+
+// DeletedColumns 删除信息列
+type DeletedColumns struct {
+	DeletedAt *time.Time `gorm:"COMMENT:删除时间" json:"deletedAt,omitempty"`
+	DeletedBy int64      `gorm:"NOT NULL;DEFAULT:0;COMMENT:删除人" json:"deletedBy,omitempty"`
+}
+
+func (deletedColumns *DeletedColumns) GetDeletedAt() *time.Time {
+	return deletedColumns.DeletedAt
+}
+
+func (deletedColumns *DeletedColumns) GetDeletedBy() int64 {
+	return deletedColumns.DeletedBy
+}
+
+// IsDeletedModel 是否记录删除信息的模型
+func IsDeletedModel(m ModelInterface) bool {
+	_, ok := m.(DeletedModelInterface)
+	return ok
+}
+
+// deleteColumns 逻辑删除时更新的列
+func deleteColumns(m ModelInterface, operator int64) map[string]interface{} {
+	columns := map[string]interface{}{"deleted": FlagYes}
+	if IsDeletedModel(m) {
+		columns[DeletedAtColumn] = time.Now()
+		columns[DeletedByColumn] = operator
+	}
+	return columns
+}
+
+// restoreColumns 恢复时更新的列
+func restoreColumns(m ModelInterface) map[string]interface{} {
+	columns := map[string]interface{}{"deleted": FlagNo}
+	if IsDeletedModel(m) {
+		columns[DeletedAtColumn] = nil
+		columns[DeletedByColumn] = 0
+	}
+	return columns
+}
+
+// RestoreContext 恢复逻辑删除的数据, 记录不存在或未删除时返回 ErrNotFound
+func (dao *BaseDao) RestoreContext(ctx context.Context, pk interface{}, operator int64) error {
+	return dao.updateColumns(ctx, pk, restoreColumns(dao.Model), operator, AuditRestore)
+}
+
+// FindDeletedContext 分页查询已逻辑删除的数据(回收站), 参数与 FindPageContext 一致
+func (dao *BaseDao) FindDeletedContext(ctx context.Context, modelParams ModelInterface, baseParams *BaseQueryParams) (interface{}, PageData, error) {
+	wrapper := dao.newWrapper(modelParams, baseParams)
+	wrapper.Deleted = FlagYes
+	return dao.findPage(ctx, wrapper)
+}
+
+// PurgeDeletedContext 物理删除逻辑删除超过 olderThan 的数据, 返回删除的行数
+// 不执行 Remove 钩子; 开启审计时逐条删除并记录, 操作人通过 WithOperator 设置
+func (dao *BaseDao) PurgeDeletedContext(ctx context.Context, olderThan time.Duration) (int64, error) {
+	column := "updated_at"
+	if IsDeletedModel(dao.Model) {
+		column = DeletedAtColumn
+	}
+	before := time.Now().Add(-olderThan)
+	sess := dao.sess(ctx).Table(dao.Model.Table()).Where("deleted = ? AND "+column+" < ?", FlagYes, before)
+	if !auditEnabled(dao.Model) {
+		result := sess.Delete(NewModelOf(dao.Model))
+		dao.invalidateCache(ctx)
+		return result.RowsAffected, wrapDbError(result.Error)
+	}
+	ids := make([]int64, 0)
+	if err := sess.Pluck("id", &ids).Error; err != nil {
+		return 0, wrapDbError(err)
+	}
+	err := WithEngineTx(ctx, dao.Engine, func(ctx context.Context) error {
+		for _, id := range ids {
+			if err := dao.RemoveByPkContext(ctx, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(ids)), nil
+}
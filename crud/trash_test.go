@@ -0,0 +1,99 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// trashUser 记录删除信息的租户模型
+type trashUser struct {
+	BaseModel
+	ModelFactory[trashUser]
+	Username string `json:"username"`
+	TenantColumns
+	DeletedColumns
+	TailColumns
+}
+
+func (*trashUser) Table() string { return "trash_users" }
+
+// newTrashDao 租户 1、2 各插入 alive、deleted 两条记录, 并删除 deleted
+func newTrashDao(t *testing.T) (*BaseDao, map[int64][]*trashUser) {
+	newTestDb(t, new(trashUser))
+	dao := &BaseDao{Model: new(trashUser)}
+	users := make(map[int64][]*trashUser)
+	for tenant := int64(1); tenant <= 2; tenant++ {
+		ctx := WithTenant(context.Background(), tenant)
+		for _, name := range []string{"alive", "deleted"} {
+			u := &trashUser{Username: name}
+			if err := dao.InsertContext(ctx, u, 1); err != nil {
+				t.Fatal(err)
+			}
+			users[tenant] = append(users[tenant], u)
+		}
+		if err := dao.DeleteByPkContext(ctx, users[tenant][1].Id, 9); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dao, users
+}
+
+func TestRestore(t *testing.T) {
+	dao, users := newTrashDao(t)
+	ctx := WithTenant(context.Background(), 1)
+	alive, deleted := users[1][0], users[1][1]
+
+	if err := dao.RestoreContext(ctx, alive.Id, 1); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("live row: expected ErrNotFound, got %v", err)
+	}
+	if err := dao.RestoreContext(WithTenant(context.Background(), 2), deleted.Id, 1); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("other tenant: expected ErrNotFound, got %v", err)
+	}
+	if err := dao.RestoreContext(ctx, deleted.Id, 1); err != nil {
+		t.Fatal(err)
+	}
+	m, err := dao.FindByPkContext(ctx, deleted.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored := m.(*trashUser); restored.DeletedAt != nil || restored.DeletedBy != 0 {
+		t.Fatalf("expected deleted info cleared, got %v, %d", restored.DeletedAt, restored.DeletedBy)
+	}
+}
+
+func TestFindDeleted(t *testing.T) {
+	dao, users := newTrashDao(t)
+	rows, pageData, err := dao.FindDeletedContext(WithTenant(context.Background(), 1), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := rows.([]*trashUser)
+	if pageData.Total != 1 || len(list) != 1 || list[0].Id != users[1][1].Id {
+		t.Fatalf("expected only the deleted row of tenant 1, got %d rows, total %d", len(list), pageData.Total)
+	}
+	if list[0].DeletedBy != 9 || list[0].DeletedAt == nil {
+		t.Fatalf("expected deleted info recorded, got %v, %d", list[0].DeletedAt, list[0].DeletedBy)
+	}
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	dao, users := newTrashDao(t)
+	n, err := dao.PurgeDeletedContext(WithTenant(context.Background(), 1), 0)
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 purged row, got %d, %v", n, err)
+	}
+	if _, err = dao.PurgeDeletedContext(context.Background(), 0); !errors.Is(err, ErrTenantRequired) {
+		t.Fatalf("no tenant: expected ErrTenantRequired, got %v", err)
+	}
+	var ids []int64
+	if err = DbSess().Model(new(trashUser)).Order("id").Pluck("id", &ids).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := []int64{users[1][0].Id, users[2][0].Id, users[2][1].Id}
+	if len(ids) != len(want) || ids[0] != want[0] || ids[1] != want[1] || ids[2] != want[2] {
+		t.Fatalf("expected tenant 2 rows and live rows kept, got %v", ids)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"gorm.io/gorm"
+)
+
+// txContextKey 事务按数据库名存放
+type txContextKey struct {
+	engine string
+}
+
+// WithTx 在默认数据库的事务中执行 fn, fn 返回 error 或 panic 时回滚
+// fn 内通过 ctx 调用的 BaseDao 方法及 *Context 钩子均使用同一事务, 嵌套调用时使用 savepoint
+// 没有 ctx 的旧版方法(DbSess()、Insert 等)不使用该事务, 旧版钩子内通过 HookSess(m) 使用该事务
+func WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return WithEngineTx(ctx, DefaultDbEngine, fn)
+}
+
+// WithEngineTx 在指定数据库的事务中执行 fn, 见 WithTx
+func WithEngineTx(ctx context.Context, engine string, fn func(ctx context.Context) error) error {
+	if _, err := lookUpDbEngine(engine); err != nil {
+		return err
+	}
+	if _, ok := EngineTxFromContext(ctx, engine); ok {
+		return EngineSessContext(ctx, engine).Transaction(func(tx *gorm.DB) error {
+			return fn(withEngineTx(ctx, engine, tx))
+		})
+	}
+	callbacks := new(txCallbacks)
+	ctx = context.WithValue(ctx, txCallbacksContextKey{engine: engineName(engine)}, callbacks)
+	err := EngineSessContext(ctx, engine).Transaction(func(tx *gorm.DB) error {
+		return fn(withEngineTx(ctx, engine, tx))
+	})
+	if err == nil {
+		for _, callback := range callbacks.fns {
+			callback()
+		}
+	}
+	return err
+}
+
+type txCallbacksContextKey struct {
+	engine string
+}
+
+// txCallbacks 事务提交后执行的函数
+type txCallbacks struct {
+	fns []func()
+}
+
+// afterCommit 在 ctx 中最外层事务提交后执行 fn, 回滚时不执行; 不在事务中时不执行
+func afterCommit(ctx context.Context, engine string, fn func()) {
+	if callbacks, ok := ctx.Value(txCallbacksContextKey{engine: engineName(engine)}).(*txCallbacks); ok {
+		callbacks.fns = append(callbacks.fns, fn)
+	}
+}
+
+func withEngineTx(ctx context.Context, engine string, tx *gorm.DB) context.Context {
+	return context.WithValue(ctx, txContextKey{engine: engineName(engine)}, tx)
+}
+
+// connContextKey 固定使用的连接按数据库名存放, 见 withEngineConn
+type connContextKey struct {
+	engine string
+}
+
+// withEngineConn ctx 中没有事务时, 读写都在 conn(db.Connection 取得的连接)上进行
+// 与事务分开存放, WithEngineTx 仍会在该连接上开启事务并在提交后执行 afterCommit
+func withEngineConn(ctx context.Context, engine string, conn *gorm.DB) context.Context {
+	return context.WithValue(ctx, connContextKey{engine: engineName(engine)}, conn)
+}
+
+func engineConnFromContext(ctx context.Context, engine string) (*gorm.DB, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	conn, ok := ctx.Value(connContextKey{engine: engineName(engine)}).(*gorm.DB)
+	return conn, ok
+}
+
+// TxFromContext 取 ctx 中默认数据库的事务
+func TxFromContext(ctx context.Context) (*gorm.DB, bool) {
+	return EngineTxFromContext(ctx, DefaultDbEngine)
+}
+
+// EngineTxFromContext 取 ctx 中指定数据库的事务
+func EngineTxFromContext(ctx context.Context, engine string) (*gorm.DB, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	tx, ok := ctx.Value(txContextKey{engine: engineName(engine)}).(*gorm.DB)
+	return tx, ok
+}
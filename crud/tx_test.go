@@ -0,0 +1,65 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestWithTxNestedRollback(t *testing.T) {
+	newTestDb(t, new(testUser))
+	dao := &BaseDao{Model: new(testUser)}
+	errInner := errors.New("inner")
+	err := WithTx(context.Background(), func(ctx context.Context) error {
+		if err := dao.InsertContext(ctx, &testUser{Username: "outer"}, 1); err != nil {
+			return err
+		}
+		err := WithTx(ctx, func(ctx context.Context) error {
+			if err := dao.InsertContext(ctx, &testUser{Username: "inner"}, 1); err != nil {
+				return err
+			}
+			return errInner
+		})
+		if !errors.Is(err, errInner) {
+			t.Fatalf("expected inner error, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	if err = DbSess().Model(new(testUser)).Pluck("username", &names).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "outer" {
+		t.Fatalf("expected only the outer row, got %v", names)
+	}
+}
+
+func TestAfterCommit(t *testing.T) {
+	newTestDb(t, new(testUser))
+	ran := 0
+	errRollback := errors.New("rollback")
+	err := WithTx(context.Background(), func(ctx context.Context) error {
+		afterCommit(ctx, DefaultDbEngine, func() { ran++ })
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) || ran != 0 {
+		t.Fatalf("rolled back: expected callback not to run, got %d runs, %v", ran, err)
+	}
+	err = WithTx(context.Background(), func(ctx context.Context) error {
+		return WithTx(ctx, func(ctx context.Context) error {
+			afterCommit(ctx, DefaultDbEngine, func() { ran++ })
+			if ran != 0 {
+				t.Fatal("callback ran before commit")
+			}
+			return nil
+		})
+	})
+	if err != nil || ran != 1 {
+		t.Fatalf("committed: expected callback to run once, got %d runs, %v", ran, err)
+	}
+}
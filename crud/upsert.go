@@ -0,0 +1,120 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ConflictColumnsInterface 声明 Upsert 判断记录是否存在的唯一列(列名), 未实现时按主键判断
+type ConflictColumnsInterface interface {
+	ConflictColumns() []string
+}
+
+// conflictCondition 冲突判断条件, 按主键判断且主键为空时返回 nil
+func conflictCondition(ctx context.Context, engine string, m ModelInterface) (map[string]interface{}, error) {
+	cm, ok := m.(ConflictColumnsInterface)
+	if !ok || len(cm.ConflictColumns()) == 0 {
+		if m.GetId() == 0 {
+			return nil, nil
+		}
+		return map[string]interface{}{"id": m.GetId()}, nil
+	}
+	return columnCondition(ctx, engine, m, cm.ConflictColumns())
+}
+
+// columnCondition 模型上指定列的值作为查询条件, engine 为模型所在数据库
+func columnCondition(ctx context.Context, engine string, m ModelInterface, columns []string) (map[string]interface{}, error) {
+	s, err := EngineModelSchema(engine, m)
+	if err != nil {
+		return nil, err
+	}
+	rv := reflect.Indirect(reflect.ValueOf(m))
+	cond := make(map[string]interface{})
+	for _, column := range columns {
+		field := LookUpField(s, column)
+		if field == nil {
+			return nil, fmt.Errorf("unknown column %q on %s", column, s.Name)
+		}
+		cond[field.DBName], _ = field.ValueOf(ctx, rv)
+	}
+	return cond, nil
+}
+
+type upsertOverwriteContextKey struct{}
+
+// WithUpsertOverwrite Upsert 乐观锁模型时, 未指定版本号也以已存在记录的当前版本号更新(后写入者生效)
+func WithUpsertOverwrite(ctx context.Context) context.Context {
+	return context.WithValue(ctx, upsertOverwriteContextKey{}, true)
+}
+
+func isUpsertOverwrite(ctx context.Context) bool {
+	overwrite, _ := ctx.Value(upsertOverwriteContextKey{}).(bool)
+	return overwrite
+}
+
+// UpsertWithHooks 记录不存在时插入, 存在时更新, 返回是否插入
+// 按 ConflictColumns 声明的唯一列(未声明时按主键)查询, 插入时执行 Insert 钩子, 更新时执行 Update 钩子;
+// 并发插入导致唯一键冲突时转为更新
+// 乐观锁模型更新时以 m 的版本号作为条件, 不一致时返回 ErrVersionConflict, 未指定版本号且记录已被更新过时返回 ErrConflict, 见 WithUpsertOverwrite
+func UpsertWithHooks(ctx context.Context, dao DAOInterface, m ModelInterface, operator int64) (bool, error) {
+	engine := ContextDao(dao).GetEngine()
+	cond, err := conflictCondition(ctx, engine, m)
+	if err != nil {
+		return false, err
+	}
+	inserted := false
+	err = WithEngineTx(ctx, engine, func(ctx context.Context) error {
+		var existing ModelInterface
+		if cond != nil {
+			existing, err = ContextDao(dao).FindOneByColumnsContext(ctx, cond)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+		}
+		if existing == nil {
+			insertErr := InsertWithHooks(ctx, dao, m, operator)
+			if insertErr == nil || cond == nil || !errors.Is(insertErr, ErrConflict) {
+				inserted = insertErr == nil
+				return insertErr
+			}
+			if existing, err = ContextDao(dao).FindOneByColumnsContext(ctx, cond); err != nil {
+				//与已删除的数据冲突
+				return insertErr
+			}
+		}
+		if err = asExisting(ctx, engine, m, existing); err != nil {
+			return err
+		}
+		return UpdateWithHooks(ctx, dao, m, operator)
+	})
+	return inserted && err == nil, err
+}
+
+// asExisting 更新时使用已存在记录的主键, 乐观锁模型未指定版本号时返回 ErrConflict, WithUpsertOverwrite 时使用当前版本号
+func asExisting(ctx context.Context, engine string, m ModelInterface, existing ModelInterface) error {
+	if m.GetId() != existing.GetId() {
+		s, err := EngineModelSchema(engine, m)
+		if err != nil {
+			return err
+		}
+		if s.PrioritizedPrimaryField == nil {
+			return fmt.Errorf("%s has no primary key", s.Name)
+		}
+		if err = s.PrioritizedPrimaryField.Set(ctx, reflect.ValueOf(m), existing.GetId()); err != nil {
+			return err
+		}
+	}
+	//新插入记录的版本号为 0, 此时未指定版本号即与之一致
+	if vm, ok := m.(VersionModelInterface); ok && vm.GetVersion() == 0 {
+		current := existing.(VersionModelInterface).GetVersion()
+		if current != 0 && !isUpsertOverwrite(ctx) {
+			return &DaoError{Kind: ErrConflict, Err: fmt.Errorf("record %d exists, version is required to update it", existing.GetId())}
+		}
+		vm.SetVersion(current)
+	}
+	return nil
+}
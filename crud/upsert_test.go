@@ -0,0 +1,66 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// ConflictColumns versionUser 按用户名判断是否存在
+func (*versionUser) ConflictColumns() []string { return []string{"username"} }
+
+func TestUpsertVersionModel(t *testing.T) {
+	newTestDb(t, new(versionUser))
+	ctx := context.Background()
+	dao := &BaseDao{Model: new(versionUser)}
+	inserted, err := UpsertWithHooks(ctx, dao, &versionUser{Username: "alice", Age: 1}, 1)
+	if err != nil || !inserted {
+		t.Fatalf("insert failed: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		ctx     context.Context
+		version int64 // -1 表示使用当前版本号
+		err     error
+	}{
+		{"fresh record", ctx, 0, nil},
+		{"missing version", ctx, 0, ErrConflict},
+		{"stale version", ctx, 5, ErrVersionConflict},
+		{"matching version", ctx, -1, nil},
+		{"overwrite", WithUpsertOverwrite(ctx), 0, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := &versionUser{Username: "alice", Age: 2}
+			m.Version = c.version
+			if c.version < 0 {
+				current, err := dao.FindOneByColumnContext(ctx, "username", "alice")
+				if err != nil {
+					t.Fatal(err)
+				}
+				m.Version = current.(*versionUser).Version
+			}
+			inserted, err := UpsertWithHooks(c.ctx, dao, m, 1)
+			if inserted {
+				t.Fatal("existing record inserted again")
+			}
+			if c.err == nil && err != nil {
+				t.Fatal(err)
+			}
+			if c.err != nil && !errors.Is(err, c.err) {
+				t.Fatalf("expected %v, got %v", c.err, err)
+			}
+		})
+	}
+
+	current, err := dao.FindOneByColumnContext(ctx, "username", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := current.(*versionUser).Version; v != 3 {
+		t.Fatalf("expected version 3 after three updates, got %d", v)
+	}
+}
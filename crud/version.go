@@ -0,0 +1,63 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// VersionColumn 乐观锁版本列
+const VersionColumn = "version"
+
+// ErrVersionConflict 乐观锁冲突, 记录已被他人修改
+var ErrVersionConflict = errors.New("version conflict")
+
+// VersionModelInterface 乐观锁模型, 内嵌 VersionColumns 即可
+// Update 时以模型上的版本号作为条件, UpdateColumn/UpdateStatus 以 WithVersion 设置的版本号作为条件
+type VersionModelInterface interface {
+	GetVersion() int64
+	SetVersion(version int64)
+}
+
+// VersionColumns 乐观锁版本列
+type VersionColumns struct {
+	Version int64 `gorm:"NOT NULL;DEFAULT:0;COMMENT:版本号" json:"version" form:"version"`
+}
+
+func (versionColumns *VersionColumns) GetVersion() int64 {
+	return versionColumns.Version
+}
+
+func (versionColumns *VersionColumns) SetVersion(version int64) {
+	versionColumns.Version = version
+}
+
+type versionContextKey struct{}
+
+// WithVersion 设置 UpdateColumn/UpdateStatus 等按主键更新时期望的版本号
+func WithVersion(ctx context.Context, version int64) context.Context {
+	return context.WithValue(ctx, versionContextKey{}, version)
+}
+
+// VersionFromContext 取 ctx 中期望的版本号
+func VersionFromContext(ctx context.Context) (int64, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	version, ok := ctx.Value(versionContextKey{}).(int64)
+	return version, ok
+}
+
+// IsVersionModel 是否乐观锁模型
+func IsVersionModel(m ModelInterface) bool {
+	_, ok := m.(VersionModelInterface)
+	return ok
+}
+
+// versionWhere 版本号条件
+func versionWhere(db *gorm.DB, version int64) *gorm.DB {
+	return db.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: VersionColumn}, Value: version})
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// versionUser 乐观锁模型
+type versionUser struct {
+	BaseModel
+	ModelFactory[versionUser]
+	Username string `gorm:"TYPE:VARCHAR(50);UNIQUE" json:"username"`
+	Age      int    `json:"age"`
+	VersionColumns
+	TailColumns
+}
+
+func (*versionUser) Table() string { return "version_users" }
+
+// currentVersion 数据库中的版本号
+func currentVersion(t *testing.T, dao *BaseDao, pk int64) int64 {
+	t.Helper()
+	m, err := dao.FindByPkContext(context.Background(), pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m.(*versionUser).Version
+}
+
+func TestVersionIncrement(t *testing.T) {
+	newTestDb(t, new(versionUser))
+	ctx := context.Background()
+	dao := &BaseDao{Model: new(versionUser)}
+	u := &versionUser{Username: "a"}
+	if err := dao.InsertContext(ctx, u, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := dao.UpdateContext(ctx, &versionUser{BaseModel: BaseModel{Id: u.Id}, Username: "b"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if v := currentVersion(t, dao, u.Id); v != 1 {
+		t.Fatalf("Update: expected version 1, got %d", v)
+	}
+	if err := dao.UpdateColumnContext(ctx, u.Id, "username", "c", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := dao.UpdateStatusContext(WithVersion(ctx, 2), u.Id, FlagNo, 1); err != nil {
+		t.Fatal(err)
+	}
+	if v := currentVersion(t, dao, u.Id); v != 3 {
+		t.Fatalf("UpdateColumn/UpdateStatus: expected version 3, got %d", v)
+	}
+}
+
+func TestVersionConflict(t *testing.T) {
+	newTestDb(t, new(versionUser))
+	ctx := context.Background()
+	dao := &BaseDao{Model: new(versionUser)}
+	u := &versionUser{Username: "a"}
+	if err := dao.InsertContext(ctx, u, 1); err != nil {
+		t.Fatal(err)
+	}
+	first := &versionUser{BaseModel: BaseModel{Id: u.Id}, Username: "b"}
+	stale := &versionUser{BaseModel: BaseModel{Id: u.Id}, Username: "c"}
+	if err := dao.UpdateContext(ctx, first, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := dao.UpdateContext(ctx, stale, 1); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("Update: expected ErrVersionConflict, got %v", err)
+	}
+	if stale.Version != 0 {
+		t.Fatalf("expected version of the rejected model kept, got %d", stale.Version)
+	}
+	if err := dao.UpdateColumnContext(WithVersion(ctx, 0), u.Id, "username", "d", 1); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("UpdateColumn: expected ErrVersionConflict, got %v", err)
+	}
+	if err := dao.UpdateColumnContext(WithVersion(ctx, 0), u.Id+1, "username", "d", 1); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing row: expected ErrNotFound, got %v", err)
+	}
+	m, err := dao.FindByPkContext(ctx, u.Id)
+	if err != nil || m.(*versionUser).Username != "b" || m.(*versionUser).Version != 1 {
+		t.Fatalf("expected the first update only, got %v, %v", m, err)
+	}
+}
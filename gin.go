@@ -42,6 +42,14 @@ func (rg *RGroup) NewJwtToken(uid int64, roles string) (string, error) {
 	return rg.jwt.Token(uid, roles)
 }
 
+func (rg *RGroup) NewJwtTenantToken(uid int64, tenant int64, roles string) (string, error) {
+	if rg.jwt == nil {
+		ZL().Error("create token failed ! jwt is nil.")
+		return "", errors.New("jwt is nil")
+	}
+	return rg.jwt.TenantToken(uid, tenant, roles)
+}
+
 func (rg *RGroup) Bind(method, router string, handler gin.HandlerFunc, perms ...string) {
 	rg.Group.Handle(method, router, handler)
 	if rg.perms != nil && rg.jwt != nil {
@@ -0,0 +1,78 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package net
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zhouhp1295/g3"
+	"github.com/zhouhp1295/g3/crud"
+	"go.uber.org/zap"
+)
+
+// Api 泛型接口, 查询类接口使用 crud.DaoInterface[T], 写接口沿用 BaseApi
+type Api[T crud.ModelInterface] struct {
+	BaseApi
+	Dao crud.DaoInterface[T]
+}
+
+// NewApi 创建泛型接口
+func NewApi[T crud.ModelInterface](dao crud.DaoInterface[T]) *Api[T] {
+	return &Api[T]{
+		BaseApi: BaseApi{Dao: dao},
+		Dao:     dao,
+	}
+}
+
+func (api *Api[T]) newParams() T {
+	return crud.NewModelOf(api.Dao.GetModel()).(T)
+}
+
+func (api *Api[T]) HandleGet(ctx *gin.Context) {
+	params := GetParams{}
+	err := ShouldBind(ctx, &params)
+	if err != nil {
+		g3.ZL().Error("parse params failed. please check")
+		FailedMessage(ctx, "参数错误")
+		return
+	}
+	//返回给前端, 未指定 fields 时按模型的默认字段查询, 不含敏感列
+	c := crud.WithFields(RequestContext(ctx), params.Fields)
+	m, err := api.Dao.Get(c, params.Id)
+	if err != nil {
+		g3.ZL().Error("find record failed. please check", zap.Int64("id", params.Id), zap.Error(err))
+		FailedError(ctx, err)
+		return
+	}
+
+	api.Dao.AfterGet(m)
+
+	SuccessData(ctx, SparseFields(api.Dao.GetEngine(), api.Dao.GetModel(), params.Fields, "", m))
+}
+
+func (api *Api[T]) HandleList(ctx *gin.Context) {
+	modelParams := api.newParams()
+	baseParams := new(crud.BaseQueryParams)
+	_ = ShouldBind(ctx, modelParams)
+	_ = ShouldBind(ctx, baseParams)
+	rows, err := api.Dao.List(RequestContext(ctx), modelParams, baseParams)
+	if err != nil {
+		g3.ZL().Error("find list failed. please check", zap.Error(err))
+		FailedError(ctx, err)
+		return
+	}
+	SuccessList(ctx, SparseFields(api.Dao.GetEngine(), api.Dao.GetModel(), baseParams.Fields, baseParams.Include, rows))
+}
+
+func (api *Api[T]) HandlePage(ctx *gin.Context) {
+	modelParams := api.newParams()
+	baseParams := new(crud.BaseQueryParams)
+	_ = ShouldBind(ctx, modelParams)
+	_ = ShouldBind(ctx, baseParams)
+	page, err := api.Dao.Page(RequestContext(ctx), modelParams, baseParams)
+	if err != nil {
+		g3.ZL().Error("find page failed. please check", zap.Error(err))
+		FailedError(ctx, err)
+		return
+	}
+	SuccessPage(ctx, SparseFields(api.Dao.GetEngine(), api.Dao.GetModel(), baseParams.Fields, baseParams.Include, page.Rows), page.Page)
+}
@@ -0,0 +1,324 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package net
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/zhouhp1295/g3"
+	"github.com/zhouhp1295/g3/crud"
+	"go.uber.org/zap"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 导出格式
+const (
+	ExportCsv  = "csv"
+	ExportXlsx = "xlsx"
+)
+
+// ExportTruncatedHeader 导出的行数超过 crud.ExportMaxRows 时设置的响应头, 值为实际导出的行数
+const ExportTruncatedHeader = "X-Export-Truncated"
+
+type ExportParams struct {
+	Format string `json:"format" form:"format"` // csv(默认) xlsx
+	Lang   string `json:"lang" form:"lang"`     // 表头语言, 为空时取 Accept-Language, 见 crud.ExportHeader
+}
+
+// ExportWriter 导出文件的写入, 第一行为表头
+type ExportWriter interface {
+	WriteRow(values []interface{}) error
+	// Close 写入剩余内容, 不关闭 w
+	Close() error
+}
+
+// ExportContentType 导出格式的 Content-Type, 不支持的格式返回空字符串
+func ExportContentType(format string) string {
+	switch format {
+	case ExportCsv:
+		return "text/csv; charset=utf-8"
+	case ExportXlsx:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return ""
+}
+
+// NewExportWriter 创建导出文件的写入, 不支持的格式返回错误
+func NewExportWriter(format string, w io.Writer) (ExportWriter, error) {
+	switch format {
+	case ExportCsv:
+		return newCsvWriter(w)
+	case ExportXlsx:
+		return newXlsxWriter(w)
+	}
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+// csvWriter 带 BOM 的 UTF-8 CSV, Excel 可直接打开
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCsvWriter(w io.Writer) (*csvWriter, error) {
+	if _, err := w.Write([]byte("\xEF\xBB\xBF")); err != nil {
+		return nil, err
+	}
+	return &csvWriter{w: csv.NewWriter(w)}, nil
+}
+
+func (writer *csvWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		s, ok := value.(string)
+		if !ok {
+			record[i] = fmt.Sprint(value)
+			continue
+		}
+		//以 = + - @ 开头的文本在 Excel 中会作为公式执行
+		if len(s) > 0 && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+			s = "'" + s
+		}
+		record[i] = s
+	}
+	return writer.w.Write(record)
+}
+
+func (writer *csvWriter) Close() error {
+	writer.w.Flush()
+	return writer.w.Error()
+}
+
+// xlsx 除工作表外的固定内容
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`},
+	{"xl/styles.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+		`</styleSheet>`},
+}
+
+// xlsxWriter 单个工作表的 xlsx, 逐行写入 zip, 不在内存中保留数据; 文本使用内联字符串, 表头加粗
+type xlsxWriter struct {
+	zw   *zip.Writer
+	w    *bufio.Writer
+	rows int
+}
+
+func newXlsxWriter(w io.Writer) (*xlsxWriter, error) {
+	zw := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	writer := &xlsxWriter{zw: zw, w: bufio.NewWriter(f)}
+	_, err = writer.w.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return writer, err
+}
+
+// xlsxColumn 列号转换为列名, 0 => A, 26 => AA
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func (writer *xlsxWriter) WriteRow(values []interface{}) error {
+	writer.rows++
+	style := ""
+	if writer.rows == 1 {
+		style = ` s="1"`
+	}
+	row := strconv.Itoa(writer.rows)
+	writer.w.WriteString(`<row r="` + row + `">`)
+	for i, value := range values {
+		ref := xlsxColumn(i) + row
+		switch v := value.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			writer.w.WriteString(`<c r="` + ref + `"` + style + `><v>` + fmt.Sprint(v) + `</v></c>`)
+		case bool:
+			b := "0"
+			if v {
+				b = "1"
+			}
+			writer.w.WriteString(`<c r="` + ref + `"` + style + ` t="b"><v>` + b + `</v></c>`)
+		default:
+			writer.w.WriteString(`<c r="` + ref + `"` + style + ` t="inlineStr"><is><t xml:space="preserve">`)
+			if err := xml.EscapeText(writer.w, []byte(fmt.Sprint(v))); err != nil {
+				return err
+			}
+			writer.w.WriteString(`</t></is></c>`)
+		}
+	}
+	_, err := writer.w.WriteString(`</row>`)
+	return err
+}
+
+func (writer *xlsxWriter) Close() error {
+	if _, err := writer.w.WriteString(`</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	if err := writer.w.Flush(); err != nil {
+		return err
+	}
+	return writer.zw.Close()
+}
+
+// requestLocale 请求的语言: lang 参数, 否则为 Accept-Language 的第一项
+func requestLocale(ctx *gin.Context, lang string) string {
+	if len(lang) > 0 {
+		return lang
+	}
+	accept := strings.Split(ctx.GetHeader("Accept-Language"), ",")[0]
+	return strings.TrimSpace(strings.Split(accept, ";")[0])
+}
+
+// HandleExport 导出列表查询的数据, 过滤、排序与 fields 参数与 HandleList 一致, 格式见 ExportParams
+// 数据分批查询并直接写入响应; 开始输出前出错时返回 JSON 错误, 之后出错只能记录日志, 文件不完整
+// 超过 crud.ExportMaxRows 时只导出前 crud.ExportMaxRows 行, 并设置 ExportTruncatedHeader 响应头
+func (baseApi *BaseApi) HandleExport(ctx *gin.Context) {
+	model := baseApi.Dao.GetModel()
+	modelParams := crud.NewModelOf(model)
+	baseParams := new(crud.BaseQueryParams)
+	exportParams := new(ExportParams)
+	_ = ShouldBind(ctx, modelParams)
+	_ = ShouldBind(ctx, baseParams)
+	_ = ShouldBind(ctx, exportParams)
+	format := strings.ToLower(exportParams.Format)
+	if len(format) == 0 {
+		format = ExportCsv
+	}
+	if len(ExportContentType(format)) == 0 {
+		g3.ZL().Error("parse params failed. please check", zap.String("format", exportParams.Format))
+		FailedMessage(ctx, "参数错误")
+		return
+	}
+	c := crud.WithLocale(RequestContext(ctx), requestLocale(ctx, exportParams.Lang))
+	columns, err := crud.ExportColumns(c, baseApi.contextDao().GetEngine(), model, baseParams.Fields)
+	if err != nil {
+		g3.ZL().Error("export failed. please check", zap.Error(err))
+		FailedError(ctx, err)
+		return
+	}
+
+	//响应头须在输出前设置, 先统计总数判断是否截断
+	truncated := false
+	if crud.ExportMaxRows > 0 {
+		countParams := *baseParams
+		countParams.PageMode, countParams.Cursor = crud.PageModeOffset, ""
+		countParams.PageNum, countParams.PageSize = 1, 1
+		countParams.CountMode = crud.CountExact
+		_, pageData, err := baseApi.contextDao().FindPageContext(c, modelParams, &countParams)
+		if err != nil {
+			g3.ZL().Error("export failed. please check", zap.Error(err))
+			FailedError(ctx, err)
+			return
+		}
+		truncated = pageData.Total > crud.ExportMaxRows
+	}
+
+	var writer ExportWriter
+	//第一批数据查询成功后再输出响应头, 之前的错误仍可返回 JSON
+	start := func() error {
+		if truncated {
+			ctx.Header(ExportTruncatedHeader, strconv.Itoa(crud.ExportMaxRows))
+		}
+		filename := model.Table() + "-" + time.Now().Format("20060102150405") + "." + format
+		ctx.Header("Content-Type", ExportContentType(format))
+		ctx.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		ctx.Status(http.StatusOK)
+		var err error
+		if writer, err = NewExportWriter(format, ctx.Writer); err != nil {
+			return err
+		}
+		headers := make([]interface{}, 0, len(columns))
+		for _, column := range columns {
+			headers = append(headers, column.Header)
+		}
+		return writer.WriteRow(headers)
+	}
+	err = baseApi.contextDao().ExportContext(c, modelParams, baseParams, func(rows interface{}) error {
+		if writer == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		v := reflect.Indirect(reflect.ValueOf(rows))
+		for i := 0; i < v.Len(); i++ {
+			values := make([]interface{}, 0, len(columns))
+			for _, column := range columns {
+				values = append(values, column.Value(c, v.Index(i)))
+			}
+			if err := writer.WriteRow(values); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, crud.ErrExportTruncated) {
+		g3.ZL().Warn("export truncated", zap.Int("maxRows", crud.ExportMaxRows))
+		err = nil
+	}
+	if err == nil && writer == nil {
+		err = start()
+	}
+	if err != nil {
+		g3.ZL().Error("export failed. please check", zap.Error(err))
+		if writer == nil {
+			FailedError(ctx, err)
+		}
+		return
+	}
+	if err = writer.Close(); err != nil {
+		g3.ZL().Error("export failed. please check", zap.Error(err))
+	}
+}
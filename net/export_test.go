@@ -0,0 +1,126 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package net
+
+import (
+	"bytes"
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/zhouhp1295/g3/crud"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	wide := make([]interface{}, 0, 30)
+	wideWant := make([]string, 0, 30)
+	for i := 0; i < 30; i++ {
+		wide = append(wide, i)
+		wideWant = append(wideWant, strconv.Itoa(i))
+	}
+	rows := [][]interface{}{
+		{"用户名", "年龄", "余额", "启用", "备注"},
+		{"alice", 30, 12.5, true, "a,b \"c\" <d> & e"},
+		{" 空格 ", int64(-1), float32(0.25), false, ""},
+		{"多行\n文本", uint8(7), 1e-7, true, "2022-01-02 03:04:05"},
+		wide,
+	}
+	want := [][]string{
+		{"用户名", "年龄", "余额", "启用", "备注"},
+		{"alice", "30", "12.5", "true", "a,b \"c\" <d> & e"},
+		{" 空格 ", "-1", "0.25", "false", ""},
+		{"多行\n文本", "7", "1e-07", "true", "2022-01-02 03:04:05"},
+		wideWant,
+	}
+	for _, format := range []string{ExportCsv, ExportXlsx} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := NewExportWriter(format, &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, row := range rows {
+				if err = writer.WriteRow(row); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err = writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+			data := buf.Bytes()
+			reader, err := NewImportReader(format, bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, expected := range want {
+				record, err := reader.Read()
+				if err != nil {
+					t.Fatalf("row %d: %v", i+1, err)
+				}
+				if !reflect.DeepEqual(record, expected) {
+					t.Fatalf("row %d: expected %q, got %q", i+1, expected, record)
+				}
+			}
+			if _, err = reader.Read(); err != io.EOF {
+				t.Fatalf("expected io.EOF, got %v", err)
+			}
+		})
+	}
+}
+
+func TestHandleExportTruncated(t *testing.T) {
+	newTestDb(t, new(versionItem))
+	dao := &crud.BaseDao{Model: new(versionItem)}
+	for i := 0; i < 3; i++ {
+		if err := dao.InsertContext(context.Background(), &versionItem{Name: "item" + strconv.Itoa(i)}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func(max int) { crud.ExportMaxRows = max }(crud.ExportMaxRows)
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		max    int
+		rows   int
+		header string
+	}{
+		{0, 3, ""},
+		{3, 3, ""},
+		{2, 2, "2"},
+	}
+	for _, c := range cases {
+		t.Run(strconv.Itoa(c.max), func(t *testing.T) {
+			crud.ExportMaxRows = c.max
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(http.MethodGet, "/export?fields=name", nil)
+			(&BaseApi{Dao: dao}).HandleExport(ctx)
+			if w.Code != http.StatusOK {
+				t.Fatalf("unexpected response %s", w.Body.String())
+			}
+			if header := w.Header().Get(ExportTruncatedHeader); header != c.header {
+				t.Fatalf("expected header %q, got %q", c.header, header)
+			}
+			reader, err := NewImportReader(ExportCsv, bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows := 0
+			for ; ; rows++ {
+				if _, err = reader.Read(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+			}
+			//不含表头
+			if rows-1 != c.rows {
+				t.Fatalf("expected %d rows, got %d", c.rows, rows-1)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package net
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/zhouhp1295/g3"
+	"github.com/zhouhp1295/g3/crud"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+var testDbSeq int64
+
+// newTestDb 创建独立的内存 sqlite 数据库并注册为默认数据库, 建好 models 的表; 日志写入临时目录
+func newTestDb(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	g3.Boot(&g3.Cfg{HomeDir: os.TempDir(), AppName: "g3-net-test"})
+	dsn := fmt.Sprintf("file:nettest%d?mode=memory&cache=shared", atomic.AddInt64(&testDbSeq, 1))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	crud.InitDbEngine(db)
+	if err = db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// testResponse Result 的响应
+type testResponse struct {
+	Code int             `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// serveJson 以 body 的 JSON 调用 handler, 返回响应
+func serveJson(t *testing.T, handler gin.HandlerFunc, method string, body interface{}) testResponse {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(method, "/", bytes.NewReader(data))
+	ctx.Request.Header.Set("Content-Type", "application/json")
+	handler(ctx)
+	var resp testResponse
+	if err = json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+	}
+	return resp
+}
@@ -3,6 +3,10 @@
 package net
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/zhouhp1295/g3"
 	"github.com/zhouhp1295/g3/auth"
@@ -23,19 +27,82 @@ type ApiInterface interface {
 	HandlePage(ctx *gin.Context)
 }
 
+// 以下为 BaseApi 额外提供的接口, 不实现也可满足 ApiInterface
+
+// HistoryApiInterface 变更历史
+type HistoryApiInterface interface {
+	HandleHistory(ctx *gin.Context)
+}
+
+// TrashApiInterface 回收站
+type TrashApiInterface interface {
+	HandleRestore(ctx *gin.Context)
+	HandleTrash(ctx *gin.Context)
+}
+
+// BatchApiInterface 批量操作
+type BatchApiInterface interface {
+	HandleDeleteBatch(ctx *gin.Context)
+	HandleRemoveBatch(ctx *gin.Context)
+	HandleUpdateStatusBatch(ctx *gin.Context)
+}
+
+// UpsertApiInterface 插入或更新
+type UpsertApiInterface interface {
+	HandleUpsert(ctx *gin.Context)
+}
+
+// AggregateApiInterface 聚合统计
+type AggregateApiInterface interface {
+	HandleAggregate(ctx *gin.Context)
+}
+
+// ExportApiInterface 导出
+type ExportApiInterface interface {
+	HandleExport(ctx *gin.Context)
+}
+
+// ImportApiInterface 导入
+type ImportApiInterface interface {
+	HandleImport(ctx *gin.Context)
+}
+
 type IdParams struct {
 	Id int64 `json:"id" form:"id"`
 }
 
-type UpdateStatusParams struct {
+type GetParams struct {
 	IdParams
+	Fields string `json:"fields" form:"fields"` // 返回的字段, 见 crud.ParseFields
+}
+
+type IdsParams struct {
+	Ids []int64 `json:"ids" form:"ids"`
+}
+
+// BatchMaxSize 批量接口单次最多的主键数, 超过时返回 400, 0 表示不限制
+var BatchMaxSize = 1000
+
+type UpdateStatusBatchParams struct {
+	IdsParams
 	Status string `json:"status" form:"status"`
 }
 
+type UpdateStatusParams struct {
+	IdParams
+	Status  string `json:"status" form:"status"`
+	Version *int64 `json:"version" form:"version"` // 乐观锁模型可传入当前版本号
+}
+
 type BaseApi struct {
 	Dao crud.DAOInterface
 }
 
+// contextDao Dao 的 context 版本, 只实现旧版方法的 Dao 通过 crud.ContextDao 包装
+func (baseApi *BaseApi) contextDao() crud.DAOContextInterface {
+	return crud.ContextDao(baseApi.Dao)
+}
+
 func Result(ctx *gin.Context, code int, msg string, data interface{}) {
 	ctx.JSON(http.StatusOK, map[string]interface{}{
 		"code": code,
@@ -69,6 +136,43 @@ func SuccessPage(ctx *gin.Context, rows interface{}, page crud.PageData) {
 	})
 }
 
+// SparseFields 指定了 fields 时只输出指定的字段、主键及 include 的关联, data 为数据库 engine 中模型 m 的记录或记录切片
+// 未指定 fields 或处理失败时原样返回
+func SparseFields(engine string, m crud.ModelInterface, fields, include string, data interface{}) interface{} {
+	if len(fields) == 0 {
+		return data
+	}
+	names, err := crud.SelectedJsonNames(engine, m, fields, include)
+	if err != nil {
+		return data
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return data
+	}
+	pick := func(row map[string]json.RawMessage) map[string]json.RawMessage {
+		picked := make(map[string]json.RawMessage, len(names))
+		for _, name := range names {
+			if v, ok := row[name]; ok {
+				picked[name] = v
+			}
+		}
+		return picked
+	}
+	rows := make([]map[string]json.RawMessage, 0)
+	if err = json.Unmarshal(b, &rows); err == nil {
+		for i := range rows {
+			rows[i] = pick(rows[i])
+		}
+		return rows
+	}
+	row := make(map[string]json.RawMessage)
+	if err = json.Unmarshal(b, &row); err != nil {
+		return data
+	}
+	return pick(row)
+}
+
 func FailedServerError(ctx *gin.Context, msg string, data interface{}) {
 	Result(ctx, http.StatusInternalServerError, msg, data)
 }
@@ -85,6 +189,70 @@ func FailedNotFound(ctx *gin.Context) {
 	Result(ctx, http.StatusBadRequest, "404 Not Found", "")
 }
 
+func FailedConflict(ctx *gin.Context, msg string, data interface{}) {
+	Result(ctx, http.StatusConflict, msg, data)
+}
+
+// FailedError 根据 DAO 返回的错误类型响应
+func FailedError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, crud.ErrNotFound):
+		FailedNotFound(ctx)
+	case errors.Is(err, crud.ErrConflict):
+		FailedConflict(ctx, "数据重复", "")
+	case errors.Is(err, crud.ErrVersionConflict):
+		FailedConflict(ctx, "数据已被修改, 请刷新后重试", "")
+	case errors.Is(err, crud.ErrValidation):
+		FailedMessage(ctx, "操作失败:"+crud.ValidationMessage(err))
+	case errors.Is(err, crud.ErrTenantRequired):
+		Result(ctx, http.StatusForbidden, "Forbidden", "")
+	default:
+		FailedServerError(ctx, "操作失败, 请稍后重试", "")
+	}
+}
+
+// ResultBatch 响应批量操作结果, 有失败的记录时返回失败明细
+func ResultBatch(ctx *gin.Context, result *crud.BatchResult, err error) {
+	switch {
+	case err == nil:
+		SuccessData(ctx, result)
+	case errors.Is(err, crud.ErrBatchFailed):
+		FailedBadRequest(ctx, "操作失败", result)
+	default:
+		FailedError(ctx, err)
+	}
+}
+
+// CtxReadPrimary 中间件中设置为 true 时, 本次请求的读操作也使用主库(见 crud.WithPrimary)
+const CtxReadPrimary = "readPrimary"
+
+// ReadPrimary 本次请求的读操作使用主库, 用于写入后需立即读取的场景
+func ReadPrimary() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set(CtxReadPrimary, true)
+		ctx.Next()
+	}
+}
+
+// RequestContext 取请求的 context, 传递给 DAO, 附带 token 中的操作人与租户(非 0 时)
+func RequestContext(ctx *gin.Context) context.Context {
+	c := ctx.Request.Context()
+	if uid, exists := ctx.Get(auth.CtxJwtUid); exists {
+		if operator, ok := uid.(int64); ok {
+			c = crud.WithOperator(c, operator)
+		}
+	}
+	if tenant, exists := ctx.Get(auth.CtxJwtTenant); exists {
+		if tenantId, ok := tenant.(int64); ok && tenantId != 0 {
+			c = crud.WithTenant(c, tenantId)
+		}
+	}
+	if ctx.GetBool(CtxReadPrimary) {
+		c = crud.WithPrimary(c)
+	}
+	return c
+}
+
 func ShouldBind(ctx *gin.Context, data interface{}) error {
 	if http.MethodGet == ctx.Request.Method ||
 		http.MethodDelete == ctx.Request.Method {
@@ -94,79 +262,89 @@ func ShouldBind(ctx *gin.Context, data interface{}) error {
 }
 
 func (baseApi *BaseApi) HandleGet(ctx *gin.Context) {
-	params := IdParams{}
+	params := GetParams{}
 	err := ShouldBind(ctx, &params)
 	if err != nil {
 		g3.ZL().Error("parse params failed. please check")
 		FailedMessage(ctx, "参数错误")
 		return
 	}
-	if baseApi.Dao.CountByPk(params.Id) == 0 {
-		g3.ZL().Error("record not exist. please check", zap.Int64("id", params.Id))
-		FailedNotFound(ctx)
+	//返回给前端, 未指定 fields 时按模型的默认字段查询, 不含敏感列
+	c := crud.WithFields(RequestContext(ctx), params.Fields)
+	m, err := baseApi.contextDao().FindByPkContext(c, params.Id)
+	if err != nil {
+		g3.ZL().Error("find record failed. please check", zap.Int64("id", params.Id), zap.Error(err))
+		FailedError(ctx, err)
 		return
 	}
-	m := baseApi.Dao.FindByPk(params.Id)
 
 	baseApi.Dao.AfterGet(m)
 
-	SuccessData(ctx, m)
+	SuccessData(ctx, SparseFields(baseApi.contextDao().GetEngine(), baseApi.Dao.GetModel(), params.Fields, "", m))
 }
 
 func (baseApi *BaseApi) HandleInsert(ctx *gin.Context) {
-	params := baseApi.Dao.GetModel().NewModel()
+	params := crud.NewModelOf(baseApi.Dao.GetModel())
 	err := ShouldBind(ctx, &params)
 	if err != nil {
 		g3.ZL().Error("parse params failed. please check")
 		FailedMessage(ctx, "参数错误")
 		return
 	}
-	if baseApi.Dao.CountByPk(params.GetId()) != 0 {
-		g3.ZL().Error("duplicate primary key. please check")
-		FailedMessage(ctx, "主键重复")
-		return
-	}
-	if _ok, _msg := baseApi.Dao.BeforeInsert(params); !_ok {
-		g3.ZL().Error("insert validate failed", zap.String("msg", _msg))
-		FailedMessage(ctx, "操作失败:"+_msg)
-		return
-	}
 	operator := ctx.GetInt64(auth.CtxJwtUid)
-	if baseApi.Dao.Insert(params, operator) {
-		baseApi.Dao.AfterInsert(params)
-		SuccessData(ctx, params)
-	} else {
-		g3.ZL().Error("insert failed. please check", zap.Reflect("data", params))
-		FailedMessage(ctx, "操作失败, 请稍后重试")
+	if err = crud.InsertWithHooks(RequestContext(ctx), baseApi.Dao, params, operator); err != nil {
+		g3.ZL().Error("insert failed. please check", zap.Reflect("data", params), zap.Error(err))
+		FailedError(ctx, err)
+		return
 	}
+	SuccessData(ctx, params)
 }
 
 func (baseApi *BaseApi) HandleUpdate(ctx *gin.Context) {
-	params := baseApi.Dao.GetModel().NewModel()
+	params := crud.NewModelOf(baseApi.Dao.GetModel())
 	err := ShouldBind(ctx, &params)
 	if err != nil {
 		g3.ZL().Error("parse params failed. please check")
 		FailedMessage(ctx, "参数错误")
 		return
 	}
-	if baseApi.Dao.CountByPk(params.GetId()) == 0 {
-		g3.ZL().Error("record not exist. please check", zap.Int64("id", params.GetId()))
-		FailedNotFound(ctx)
+	//记录不存在时由更新返回 ErrNotFound, 不再预先查询
+	c := RequestContext(ctx)
+	operator := ctx.GetInt64(auth.CtxJwtUid)
+	if err = crud.UpdateWithHooks(c, baseApi.Dao, params, operator); err != nil {
+		g3.ZL().Error("update failed. please check", zap.Reflect("data", params), zap.Error(err))
+		if errors.Is(err, crud.ErrVersionConflict) {
+			//返回服务端当前数据, 便于客户端合并
+			current, _ := baseApi.contextDao().FindByPkContext(crud.WithDefaultFields(c), params.GetId())
+			FailedConflict(ctx, "数据已被修改, 请刷新后重试", current)
+			return
+		}
+		FailedError(ctx, err)
 		return
 	}
-	if _ok, _msg := baseApi.Dao.BeforeUpdate(params); !_ok {
-		g3.ZL().Error("update validate failed", zap.String("msg", _msg))
-		FailedMessage(ctx, "操作失败:"+_msg)
+	SuccessDefault(ctx)
+}
+
+// HandleUpsert 不存在时插入, 存在时更新, 判断方式见 crud.UpsertWithHooks
+func (baseApi *BaseApi) HandleUpsert(ctx *gin.Context) {
+	params := crud.NewModelOf(baseApi.Dao.GetModel())
+	err := ShouldBind(ctx, &params)
+	if err != nil {
+		g3.ZL().Error("parse params failed. please check")
+		FailedMessage(ctx, "参数错误")
 		return
 	}
 	operator := ctx.GetInt64(auth.CtxJwtUid)
-	if baseApi.Dao.Update(params, operator) {
-		baseApi.Dao.AfterUpdate(params)
-		SuccessDefault(ctx)
-	} else {
-		g3.ZL().Error("update failed. please check", zap.Reflect("data", params))
-		FailedMessage(ctx, "操作失败, 请稍后重试")
+	inserted, err := crud.UpsertWithHooks(RequestContext(ctx), baseApi.Dao, params, operator)
+	if err != nil {
+		g3.ZL().Error("upsert failed. please check", zap.Reflect("data", params), zap.Error(err))
+		FailedError(ctx, err)
+		return
 	}
+	SuccessData(ctx, map[string]interface{}{
+		"inserted": inserted,
+		"row":      params,
+	})
 }
 
 func (baseApi *BaseApi) HandleUpdateStatus(ctx *gin.Context) {
@@ -177,24 +355,22 @@ func (baseApi *BaseApi) HandleUpdateStatus(ctx *gin.Context) {
 		FailedMessage(ctx, "参数错误")
 		return
 	}
-	if baseApi.Dao.CountByPk(params.Id) == 0 {
-		g3.ZL().Error("record not exist. please check", zap.Int64("id", params.Id))
-		FailedNotFound(ctx)
-		return
-	}
 	if len(params.Status) == 0 {
 		g3.ZL().Error("status is empty. please check")
 		FailedMessage(ctx, "参数错误")
 		return
 	}
+	c := RequestContext(ctx)
+	if params.Version != nil {
+		c = crud.WithVersion(c, *params.Version)
+	}
 	operator := ctx.GetInt64(auth.CtxJwtUid)
-
-	if baseApi.Dao.UpdateStatus(params.Id, params.Status, operator) {
-		SuccessDefault(ctx)
-	} else {
-		g3.ZL().Error("update status failed. please check", zap.Reflect("data", params))
-		FailedMessage(ctx, "操作失败, 请稍后重试")
+	if err = baseApi.contextDao().UpdateStatusContext(c, params.Id, params.Status, operator); err != nil {
+		g3.ZL().Error("update status failed. please check", zap.Reflect("data", params), zap.Error(err))
+		FailedError(ctx, err)
+		return
 	}
+	SuccessDefault(ctx)
 }
 
 func (baseApi *BaseApi) HandleDelete(ctx *gin.Context) {
@@ -205,30 +381,78 @@ func (baseApi *BaseApi) HandleDelete(ctx *gin.Context) {
 		FailedMessage(ctx, "参数错误")
 		return
 	}
-	if baseApi.Dao.CountByPk(params.Id) == 0 {
-		g3.ZL().Error("record not exist. please check", zap.Int64("id", params.Id))
-		FailedNotFound(ctx)
+	c := RequestContext(ctx)
+	m, err := baseApi.contextDao().FindByPkContext(c, params.Id)
+	if err != nil {
+		g3.ZL().Error("find record failed. please check", zap.Int64("id", params.Id), zap.Error(err))
+		FailedError(ctx, err)
 		return
 	}
 
-	m := baseApi.Dao.FindByPk(params.Id)
+	operator := ctx.GetInt64(auth.CtxJwtUid)
+	if err = crud.DeleteWithHooks(c, baseApi.Dao, m, operator); err != nil {
+		g3.ZL().Error("delete failed. please check", zap.Reflect("data", params), zap.Error(err))
+		FailedError(ctx, err)
+		return
+	}
+	SuccessDefault(ctx)
+}
 
-	if _ok, _msg := baseApi.Dao.BeforeDelete(m); !_ok {
-		g3.ZL().Error("delete validate failed", zap.String("msg", _msg))
-		FailedMessage(ctx, "操作失败:"+_msg)
+func (baseApi *BaseApi) HandleRemove(ctx *gin.Context) {
+	params := IdParams{}
+	err := ShouldBind(ctx, &params)
+	if err != nil {
+		g3.ZL().Error("parse params failed. please check")
+		FailedMessage(ctx, "参数错误")
+		return
+	}
+	c := RequestContext(ctx)
+	m, err := baseApi.contextDao().FindByPkContext(c, params.Id)
+	if err != nil {
+		g3.ZL().Error("find record failed. please check", zap.Int64("id", params.Id), zap.Error(err))
+		FailedError(ctx, err)
 		return
 	}
+
 	operator := ctx.GetInt64(auth.CtxJwtUid)
-	if baseApi.Dao.Delete(m, operator) {
-		baseApi.Dao.AfterDelete(m)
-		SuccessDefault(ctx)
-	} else {
-		g3.ZL().Error("delete failed. please check", zap.Reflect("data", params))
-		FailedMessage(ctx, "操作失败, 请稍后重试")
+	if err = crud.RemoveWithHooks(c, baseApi.Dao, m, operator); err != nil {
+		g3.ZL().Error("remove failed. please check", zap.Reflect("data", params), zap.Error(err))
+		FailedError(ctx, err)
+		return
 	}
+	SuccessDefault(ctx)
 }
 
-func (baseApi *BaseApi) HandleRemove(ctx *gin.Context) {
+func (baseApi *BaseApi) HandleList(ctx *gin.Context) {
+	modelParams := crud.NewModelOf(baseApi.Dao.GetModel())
+	baseParams := new(crud.BaseQueryParams)
+	_ = ShouldBind(ctx, modelParams)
+	_ = ShouldBind(ctx, baseParams)
+	rows, err := baseApi.contextDao().FindListContext(RequestContext(ctx), modelParams, baseParams)
+	if err != nil {
+		g3.ZL().Error("find list failed. please check", zap.Error(err))
+		FailedError(ctx, err)
+		return
+	}
+	SuccessList(ctx, SparseFields(baseApi.contextDao().GetEngine(), baseApi.Dao.GetModel(), baseParams.Fields, baseParams.Include, rows))
+}
+
+func (baseApi *BaseApi) HandlePage(ctx *gin.Context) {
+	modelParams := crud.NewModelOf(baseApi.Dao.GetModel())
+	baseParams := new(crud.BaseQueryParams)
+	_ = ShouldBind(ctx, modelParams)
+	_ = ShouldBind(ctx, baseParams)
+	rows, pageData, err := baseApi.contextDao().FindPageContext(RequestContext(ctx), modelParams, baseParams)
+	if err != nil {
+		g3.ZL().Error("find page failed. please check", zap.Error(err))
+		FailedError(ctx, err)
+		return
+	}
+	SuccessPage(ctx, SparseFields(baseApi.contextDao().GetEngine(), baseApi.Dao.GetModel(), baseParams.Fields, baseParams.Include, rows), pageData)
+}
+
+// HandleHistory 记录的变更历史, 需使用 crud.DbAuditSink, 敏感列及 json:"-" 列的值为 crud.AuditMask
+func (baseApi *BaseApi) HandleHistory(ctx *gin.Context) {
 	params := IdParams{}
 	err := ShouldBind(ctx, &params)
 	if err != nil {
@@ -236,43 +460,141 @@ func (baseApi *BaseApi) HandleRemove(ctx *gin.Context) {
 		FailedMessage(ctx, "参数错误")
 		return
 	}
-	if baseApi.Dao.CountByPk(params.Id) == 0 {
-		g3.ZL().Error("record not exist. please check", zap.Int64("id", params.Id))
-		FailedNotFound(ctx)
+	//已删除的记录也可查询历史
+	rows, err := crud.FindAuditLogs(RequestContext(ctx), baseApi.contextDao().GetEngine(), baseApi.Dao.GetModel(), params.Id)
+	if err != nil {
+		g3.ZL().Error("find history failed. please check", zap.Int64("id", params.Id), zap.Error(err))
+		FailedError(ctx, err)
 		return
 	}
+	SuccessList(ctx, rows)
+}
 
-	m := baseApi.Dao.FindByPk(params.Id)
-
-	if _ok, _msg := baseApi.Dao.BeforeRemove(m); !_ok {
-		g3.ZL().Error("remove validate failed", zap.String("msg", _msg))
-		FailedMessage(ctx, "操作失败:"+_msg)
+// HandleRestore 恢复逻辑删除的数据
+func (baseApi *BaseApi) HandleRestore(ctx *gin.Context) {
+	params := IdParams{}
+	err := ShouldBind(ctx, &params)
+	if err != nil {
+		g3.ZL().Error("parse params failed. please check")
+		FailedMessage(ctx, "参数错误")
 		return
 	}
 	operator := ctx.GetInt64(auth.CtxJwtUid)
-	if baseApi.Dao.Remove(m, operator) {
-		baseApi.Dao.AfterRemove(m)
-		SuccessDefault(ctx)
-	} else {
-		g3.ZL().Error("remove failed. please check", zap.Reflect("data", params))
-		FailedMessage(ctx, "操作失败, 请稍后重试")
+	if err = baseApi.contextDao().RestoreContext(RequestContext(ctx), params.Id, operator); err != nil {
+		g3.ZL().Error("restore failed. please check", zap.Reflect("data", params), zap.Error(err))
+		FailedError(ctx, err)
+		return
 	}
+	SuccessDefault(ctx)
 }
 
-func (baseApi *BaseApi) HandleList(ctx *gin.Context) {
-	modelParams := baseApi.Dao.GetModel().NewModel().(crud.ModelInterface)
+// HandleTrash 回收站, 分页查询已逻辑删除的数据
+func (baseApi *BaseApi) HandleTrash(ctx *gin.Context) {
+	modelParams := crud.NewModelOf(baseApi.Dao.GetModel())
 	baseParams := new(crud.BaseQueryParams)
 	_ = ShouldBind(ctx, modelParams)
 	_ = ShouldBind(ctx, baseParams)
-	rows := baseApi.Dao.FindList(modelParams, baseParams)
-	SuccessList(ctx, rows)
+	rows, pageData, err := baseApi.contextDao().FindDeletedContext(RequestContext(ctx), modelParams, baseParams)
+	if err != nil {
+		g3.ZL().Error("find trash failed. please check", zap.Error(err))
+		FailedError(ctx, err)
+		return
+	}
+	SuccessPage(ctx, SparseFields(baseApi.contextDao().GetEngine(), baseApi.Dao.GetModel(), baseParams.Fields, baseParams.Include, rows), pageData)
 }
 
-func (baseApi *BaseApi) HandlePage(ctx *gin.Context) {
-	modelParams := baseApi.Dao.GetModel().NewModel().(crud.ModelInterface)
+// HandleAggregate 聚合统计, 过滤参数与 HandleList 一致, 聚合参数见 crud.AggregateParams
+func (baseApi *BaseApi) HandleAggregate(ctx *gin.Context) {
+	modelParams := crud.NewModelOf(baseApi.Dao.GetModel())
 	baseParams := new(crud.BaseQueryParams)
+	aggregateParams := new(crud.AggregateParams)
 	_ = ShouldBind(ctx, modelParams)
 	_ = ShouldBind(ctx, baseParams)
-	rows, pageData := baseApi.Dao.FindPage(modelParams, baseParams)
-	SuccessPage(ctx, rows, pageData)
+	_ = ShouldBind(ctx, aggregateParams)
+	rows, err := baseApi.contextDao().AggregateContext(RequestContext(ctx), modelParams, baseParams, aggregateParams)
+	if err != nil {
+		g3.ZL().Error("aggregate failed. please check", zap.Reflect("params", aggregateParams), zap.Error(err))
+		FailedError(ctx, err)
+		return
+	}
+	SuccessList(ctx, rows)
+}
+
+// checkBatchIds 批量接口的主键数不能超过 BatchMaxSize, 超过时返回 crud.ErrValidation
+func checkBatchIds(ids []int64) error {
+	if BatchMaxSize > 0 && len(ids) > BatchMaxSize {
+		return crud.NewValidationError(fmt.Sprintf("too many ids, max is %d", BatchMaxSize))
+	}
+	return nil
+}
+
+// HandleDeleteBatch 批量删除(逻辑)
+func (baseApi *BaseApi) HandleDeleteBatch(ctx *gin.Context) {
+	params := IdsParams{}
+	err := ShouldBind(ctx, &params)
+	if err != nil || len(params.Ids) == 0 {
+		g3.ZL().Error("parse params failed. please check")
+		FailedMessage(ctx, "参数错误")
+		return
+	}
+	if err = checkBatchIds(params.Ids); err != nil {
+		g3.ZL().Error("too many ids. please check", zap.Int("size", len(params.Ids)), zap.Int("max", BatchMaxSize))
+		FailedError(ctx, err)
+		return
+	}
+	operator := ctx.GetInt64(auth.CtxJwtUid)
+	result, err := crud.DeleteByPks(RequestContext(ctx), baseApi.Dao, params.Ids, operator)
+	if err != nil {
+		g3.ZL().Error("delete batch failed. please check", zap.Reflect("data", params), zap.Error(err))
+	}
+	ResultBatch(ctx, result, err)
+}
+
+// HandleRemoveBatch 批量删除(物理)
+func (baseApi *BaseApi) HandleRemoveBatch(ctx *gin.Context) {
+	params := IdsParams{}
+	err := ShouldBind(ctx, &params)
+	if err != nil || len(params.Ids) == 0 {
+		g3.ZL().Error("parse params failed. please check")
+		FailedMessage(ctx, "参数错误")
+		return
+	}
+	if err = checkBatchIds(params.Ids); err != nil {
+		g3.ZL().Error("too many ids. please check", zap.Int("size", len(params.Ids)), zap.Int("max", BatchMaxSize))
+		FailedError(ctx, err)
+		return
+	}
+	operator := ctx.GetInt64(auth.CtxJwtUid)
+	result, err := crud.RemoveByPks(RequestContext(ctx), baseApi.Dao, params.Ids, operator)
+	if err != nil {
+		g3.ZL().Error("remove batch failed. please check", zap.Reflect("data", params), zap.Error(err))
+	}
+	ResultBatch(ctx, result, err)
+}
+
+// HandleUpdateStatusBatch 批量更新状态
+func (baseApi *BaseApi) HandleUpdateStatusBatch(ctx *gin.Context) {
+	params := UpdateStatusBatchParams{}
+	err := ShouldBind(ctx, &params)
+	if err != nil || len(params.Ids) == 0 {
+		g3.ZL().Error("parse params failed. please check")
+		FailedMessage(ctx, "参数错误")
+		return
+	}
+	if err = checkBatchIds(params.Ids); err != nil {
+		g3.ZL().Error("too many ids. please check", zap.Int("size", len(params.Ids)), zap.Int("max", BatchMaxSize))
+		FailedError(ctx, err)
+		return
+	}
+	if len(params.Status) == 0 {
+		g3.ZL().Error("status is empty. please check")
+		FailedMessage(ctx, "参数错误")
+		return
+	}
+	operator := ctx.GetInt64(auth.CtxJwtUid)
+	result, err := crud.UpdateStatusByPks(RequestContext(ctx), baseApi.Dao, params.Ids, params.Status, operator)
+	if err != nil {
+		g3.ZL().Error("update status batch failed. please check", zap.Reflect("data", params), zap.Error(err))
+	}
+	ResultBatch(ctx, result, err)
 }
@@ -0,0 +1,144 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/zhouhp1295/g3/auth"
+	"github.com/zhouhp1295/g3/crud"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// BaseApi 实现的可选接口
+var (
+	_ HistoryApiInterface   = new(BaseApi)
+	_ TrashApiInterface     = new(BaseApi)
+	_ BatchApiInterface     = new(BaseApi)
+	_ UpsertApiInterface    = new(BaseApi)
+	_ AggregateApiInterface = new(BaseApi)
+	_ ExportApiInterface    = new(BaseApi)
+	_ ImportApiInterface    = new(BaseApi)
+)
+
+// versionItem 乐观锁模型
+type versionItem struct {
+	crud.BaseModel
+	crud.ModelFactory[versionItem]
+	Name string `json:"name"`
+	crud.VersionColumns
+	crud.TailColumns
+}
+
+func (*versionItem) Table() string { return "version_items" }
+
+func TestHandleUpdateVersionConflict(t *testing.T) {
+	newTestDb(t, new(versionItem))
+	dao := &crud.BaseDao{Model: new(versionItem)}
+	api := &BaseApi{Dao: dao}
+	item := &versionItem{Name: "a"}
+	if err := dao.InsertContext(context.Background(), item, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := serveJson(t, api.HandleUpdate, http.MethodPost, map[string]interface{}{"id": item.Id, "name": "b", "version": 0})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected update to succeed, got %+v", resp)
+	}
+	resp = serveJson(t, api.HandleUpdate, http.MethodPost, map[string]interface{}{"id": item.Id, "name": "c", "version": 0})
+	if resp.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for stale version, got %+v", resp)
+	}
+	current := new(versionItem)
+	if err := json.Unmarshal(resp.Data, current); err != nil {
+		t.Fatal(err)
+	}
+	if current.Id != item.Id || current.Name != "b" || current.Version != 1 {
+		t.Fatalf("expected the server copy in the conflict response, got %s", resp.Data)
+	}
+
+	resp = serveJson(t, api.HandleUpdate, http.MethodPost, map[string]interface{}{"id": item.Id + 1, "name": "d", "version": 0})
+	if resp.Msg != "404 Not Found" {
+		t.Fatalf("expected FailedNotFound for a missing row, got %+v", resp)
+	}
+}
+
+func TestFailedError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		name string
+		err  error
+		code int
+		msg  string
+	}{
+		{"not found", &crud.DaoError{Kind: crud.ErrNotFound}, http.StatusBadRequest, "404 Not Found"},
+		{"conflict", &crud.DaoError{Kind: crud.ErrConflict, Err: errors.New("UNIQUE constraint failed")}, http.StatusConflict, "数据重复"},
+		{"version conflict", crud.ErrVersionConflict, http.StatusConflict, "数据已被修改, 请刷新后重试"},
+		{"validation", crud.NewValidationError("名称不能为空"), http.StatusBadRequest, "操作失败:名称不能为空"},
+		{"tenant required", crud.ErrTenantRequired, http.StatusForbidden, "Forbidden"},
+		{"wrapped", fmt.Errorf("handler: %w", &crud.DaoError{Kind: crud.ErrNotFound}), http.StatusBadRequest, "404 Not Found"},
+		{"other", errors.New("driver: bad connection"), http.StatusInternalServerError, "操作失败, 请稍后重试"},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		FailedError(ctx, c.err)
+		var resp testResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Code != c.code || resp.Msg != c.msg {
+			t.Fatalf("%s: expected %d %q, got %+v", c.name, c.code, c.msg, resp)
+		}
+	}
+}
+
+func TestRequestContextTenant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	jwtAuth := auth.NewJwt("/api", auth.NewPerm(), "secret", 3600)
+	jwtAuth.AddWhiteRouters("/items")
+	single, _ := jwtAuth.Token(1, "admin")
+	tenant, _ := jwtAuth.TenantToken(1, 5, "admin")
+	cases := []struct {
+		token  string
+		tenant int64
+		ok     bool
+	}{
+		{single, 0, false},
+		{tenant, 5, true},
+	}
+	for _, c := range cases {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/api/items", nil)
+		ctx.Request.Header.Set("Authorization", "Bearer "+c.token)
+		jwtAuth.Authentication(ctx)
+		if ctx.IsAborted() {
+			t.Fatal("expected the token to be accepted")
+		}
+		id, ok := crud.TenantFromContext(RequestContext(ctx))
+		if id != c.tenant || ok != c.ok {
+			t.Fatalf("expected tenant %d (%v), got %d (%v)", c.tenant, c.ok, id, ok)
+		}
+	}
+}
+
+func TestHandleDeleteBatchMaxSize(t *testing.T) {
+	newTestDb(t, new(versionItem))
+	api := &BaseApi{Dao: &crud.BaseDao{Model: new(versionItem)}}
+	defer func(size int) { BatchMaxSize = size }(BatchMaxSize)
+	BatchMaxSize = 2
+
+	resp := serveJson(t, api.HandleDeleteBatch, http.MethodPost, map[string]interface{}{"ids": []int64{1, 2, 3}})
+	if resp.Code != http.StatusBadRequest || resp.Msg != "操作失败:too many ids, max is 2" {
+		t.Fatalf("expected the batch limit in the response, got %+v", resp)
+	}
+	resp = serveJson(t, api.HandleDeleteBatch, http.MethodPost, map[string]interface{}{"ids": []int64{}})
+	if resp.Code != http.StatusBadRequest || resp.Msg != "参数错误" {
+		t.Fatalf("expected 参数错误 for empty ids, got %+v", resp)
+	}
+}
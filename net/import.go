@@ -0,0 +1,464 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package net
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/zhouhp1295/g3"
+	"github.com/zhouhp1295/g3/auth"
+	"github.com/zhouhp1295/g3/crud"
+	"go.uber.org/zap"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ImportParams struct {
+	Mode    string `json:"mode" form:"mode"`       // insert(默认) upsert, 见 crud.ImportOptions
+	DryRun  bool   `json:"dryRun" form:"dryRun"`   // 试运行, 只返回校验结果
+	Partial bool   `json:"partial" form:"partial"` // 写入成功的行, 默认任一行失败时全部不写入
+	Report  string `json:"report" form:"report"`   // csv 或 xlsx 时有错误的结果以文件返回
+	Lang    string `json:"lang" form:"lang"`       // 表头语言, 为空时取 Accept-Language
+}
+
+// 导入文件的限制, 0 表示不限制
+var (
+	ImportMaxFileSize     int64 = 20 << 20  // 上传文件的大小, 超过时返回 400
+	ImportMaxXlsxPartSize int64 = 100 << 20 // xlsx 中每个文件解压后的大小, 超过时返回 ErrValidation, 避免解压炸弹
+)
+
+// importSizeError 文件超过大小限制
+func importSizeError(name string, limit int64) error {
+	return &crud.DaoError{Kind: crud.ErrValidation, Err: fmt.Errorf("%s exceeds the size limit of %d bytes", name, limit)}
+}
+
+// NewImportReader 按格式读取上传的文件, 格式为 csv 或 xlsx, 取 xlsx 的第一个工作表
+func NewImportReader(format string, r io.ReaderAt, size int64) (crud.ImportReader, error) {
+	switch format {
+	case ExportCsv:
+		br := bufio.NewReader(io.NewSectionReader(r, 0, size))
+		//去掉 Excel 保存的 UTF-8 BOM
+		if bom, err := br.Peek(3); err == nil && string(bom) == "\xEF\xBB\xBF" {
+			_, _ = br.Discard(3)
+		}
+		reader := csv.NewReader(br)
+		reader.FieldsPerRecord = -1
+		return reader, nil
+	case ExportXlsx:
+		return newXlsxReader(r, size)
+	}
+	return nil, fmt.Errorf("unsupported import format %q", format)
+}
+
+// xlsxReader 逐行读取 xlsx 工作表, 空行返回空记录以保持行号, 日期格式的数值转换为日期字符串
+type xlsxReader struct {
+	decoder *xml.Decoder
+	closer  io.Closer
+	strings []string
+	dates   map[int]bool // 日期格式的样式
+	row     int          // 已返回的行号
+	pending []string     // 已读取但行号在后的行
+	next    int          // pending 的行号
+}
+
+func newXlsxReader(r io.ReaderAt, size int64) (*xlsxReader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	reader := &xlsxReader{dates: make(map[int]bool)}
+	sheet, err := xlsxFirstSheet(files)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if reader.strings, err = xlsxSharedStrings(f); err != nil {
+			return nil, err
+		}
+	}
+	if f, ok := files["xl/styles.xml"]; ok {
+		if reader.dates, err = xlsxDateStyles(f); err != nil {
+			return nil, err
+		}
+	}
+	f, ok := files[sheet]
+	if !ok {
+		return nil, fmt.Errorf("xlsx: missing %s", sheet)
+	}
+	rc, err := xlsxOpen(f)
+	if err != nil {
+		return nil, err
+	}
+	reader.decoder = xml.NewDecoder(rc)
+	reader.closer = rc
+	return reader, nil
+}
+
+// xlsxPart 读取 xlsx 中的文件, 解压后超过 limit 时返回 ErrValidation
+type xlsxPart struct {
+	r     io.Reader
+	c     io.Closer
+	name  string
+	limit int64
+	n     int64
+}
+
+// xlsxOpen 打开 xlsx 中的文件, 先校验声明的解压大小, 读取时再按实际大小校验
+func xlsxOpen(f *zip.File) (io.ReadCloser, error) {
+	limit := ImportMaxXlsxPartSize
+	if limit > 0 && f.UncompressedSize64 > uint64(limit) {
+		return nil, importSizeError(f.Name, limit)
+	}
+	rc, err := f.Open()
+	if err != nil || limit <= 0 {
+		return rc, err
+	}
+	//多读一个字节用于判断是否超过限制
+	return &xlsxPart{r: io.LimitReader(rc, limit+1), c: rc, name: f.Name, limit: limit}, nil
+}
+
+func (part *xlsxPart) Read(p []byte) (int, error) {
+	n, err := part.r.Read(p)
+	part.n += int64(n)
+	if part.n > part.limit {
+		return 0, importSizeError(part.name, part.limit)
+	}
+	return n, err
+}
+
+func (part *xlsxPart) Close() error {
+	return part.c.Close()
+}
+
+func xlsxDecode(f *zip.File, v interface{}) error {
+	rc, err := xlsxOpen(f)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+// xlsxFirstSheet 第一个工作表在 zip 中的路径
+func xlsxFirstSheet(files map[string]*zip.File) (string, error) {
+	workbook, rels := files["xl/workbook.xml"], files["xl/_rels/workbook.xml.rels"]
+	if workbook == nil || rels == nil {
+		return "", errors.New("xlsx: missing workbook")
+	}
+	var wb struct {
+		Sheets []struct {
+			Id string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rs struct {
+		Relationships []struct {
+			Id     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := xlsxDecode(workbook, &wb); err != nil {
+		return "", err
+	}
+	if err := xlsxDecode(rels, &rs); err != nil {
+		return "", err
+	}
+	if len(wb.Sheets) == 0 {
+		return "", errors.New("xlsx: no sheet")
+	}
+	for _, rel := range rs.Relationships {
+		if rel.Id != wb.Sheets[0].Id {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return "", errors.New("xlsx: missing sheet relationship")
+}
+
+// xlsxText 文本, 富文本时为各段的拼接
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (text xlsxText) String() string {
+	s := text.T
+	for _, run := range text.Runs {
+		s += run.T
+	}
+	return s
+}
+
+func xlsxSharedStrings(f *zip.File) ([]string, error) {
+	var sst struct {
+		Items []xlsxText `xml:"si"`
+	}
+	if err := xlsxDecode(f, &sst); err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, len(sst.Items))
+	for _, item := range sst.Items {
+		values = append(values, item.String())
+	}
+	return values, nil
+}
+
+// xlsxDateStyles 日期格式的样式下标: 内置日期格式 14-22、45-47, 或自定义格式中含有 y m d h s
+func xlsxDateStyles(f *zip.File) (map[int]bool, error) {
+	var styles struct {
+		NumFmts []struct {
+			Id   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs []struct {
+			NumFmtId int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if err := xlsxDecode(f, &styles); err != nil {
+		return nil, err
+	}
+	custom := make(map[int]bool)
+	for _, numFmt := range styles.NumFmts {
+		code := strings.ToLower(numFmt.Code)
+		//去掉引号中的文字与 [Red] 等颜色、条件
+		for _, pair := range [][2]string{{`"`, `"`}, {"[", "]"}} {
+			for {
+				begin := strings.Index(code, pair[0])
+				if begin < 0 {
+					break
+				}
+				end := strings.Index(code[begin+1:], pair[1])
+				if end < 0 {
+					break
+				}
+				code = code[:begin] + code[begin+end+2:]
+			}
+		}
+		custom[numFmt.Id] = strings.ContainsAny(code, "ymdhs")
+	}
+	dates := make(map[int]bool)
+	for i, xf := range styles.CellXfs {
+		id := xf.NumFmtId
+		dates[i] = (id >= 14 && id <= 22) || (id >= 45 && id <= 47) || custom[id]
+	}
+	return dates, nil
+}
+
+// xlsxDate Excel 的日期序号转换为日期字符串, 有时间部分时包含时间
+func xlsxDate(serial float64) string {
+	t := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).Add(time.Duration(math.Round(serial*86400)) * time.Second)
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// xlsxColumnIndex 单元格引用中的列号, A1 => 0, AA3 => 26
+func xlsxColumnIndex(ref string) int {
+	index := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A') + 1
+	}
+	return index - 1
+}
+
+func (reader *xlsxReader) Read() ([]string, error) {
+	if reader.pending != nil {
+		reader.row++
+		if reader.row < reader.next {
+			return []string{}, nil
+		}
+		record := reader.pending
+		reader.pending = nil
+		return record, nil
+	}
+	for {
+		token, err := reader.decoder.Token()
+		if err == io.EOF {
+			_ = reader.closer.Close()
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		var row struct {
+			R     int `xml:"r,attr"`
+			Cells []struct {
+				R  string   `xml:"r,attr"`
+				T  string   `xml:"t,attr"`
+				S  int      `xml:"s,attr"`
+				V  string   `xml:"v"`
+				Is xlsxText `xml:"is"`
+			} `xml:"c"`
+		}
+		if err = reader.decoder.DecodeElement(&row, &start); err != nil {
+			return nil, err
+		}
+		record := make([]string, 0, len(row.Cells))
+		for _, cell := range row.Cells {
+			if len(cell.R) > 0 {
+				for index := xlsxColumnIndex(cell.R); len(record) < index; {
+					record = append(record, "")
+				}
+			}
+			value := cell.V
+			switch cell.T {
+			case "s":
+				i, err := strconv.Atoi(cell.V)
+				if err != nil || i < 0 || i >= len(reader.strings) {
+					return nil, fmt.Errorf("xlsx: invalid shared string %q", cell.V)
+				}
+				value = reader.strings[i]
+			case "inlineStr":
+				value = cell.Is.String()
+			case "b":
+				value = strconv.FormatBool(cell.V == "1")
+			case "e":
+				value = ""
+			case "", "n":
+				if serial, err := strconv.ParseFloat(cell.V, 64); err == nil && reader.dates[cell.S] {
+					value = xlsxDate(serial)
+				}
+			}
+			record = append(record, value)
+		}
+		//行号不连续时以空记录补齐, 保持与文件中的行号一致
+		if row.R > reader.row+1 {
+			reader.pending, reader.next = record, row.R
+			reader.row++
+			return []string{}, nil
+		}
+		reader.row++
+		return record, nil
+	}
+}
+
+// HandleImport 上传 CSV/XLSX 文件(表单字段 file)导入数据, 表头对应字段见 crud.ImportField
+// 每行经过 binding 标签校验与 Insert/Update 钩子; 默认任一行失败时全部不写入, 返回每行的错误
+// 文件超过 ImportMaxFileSize 时返回 400
+func (baseApi *BaseApi) HandleImport(ctx *gin.Context) {
+	if ImportMaxFileSize > 0 {
+		//表单中的其他字段与分隔符另外预留 1MB
+		limit := ImportMaxFileSize + 1<<20
+		if ctx.Request.ContentLength > limit {
+			FailedError(ctx, importSizeError("upload file", ImportMaxFileSize))
+			return
+		}
+		ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, limit)
+	}
+	params := ImportParams{}
+	//参数可在 URL 或 multipart 表单中, 表单的值优先
+	_ = ctx.ShouldBindQuery(&params)
+	_ = ctx.ShouldBind(&params)
+	fileHeader, err := ctx.FormFile("file")
+	format := ""
+	if err == nil {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(fileHeader.Filename)), ".")
+	}
+	if err != nil || (format != ExportCsv && format != ExportXlsx) {
+		g3.ZL().Error("parse params failed. please check", zap.Error(err))
+		FailedMessage(ctx, "参数错误")
+		return
+	}
+	if ImportMaxFileSize > 0 && fileHeader.Size > ImportMaxFileSize {
+		FailedError(ctx, importSizeError("upload file", ImportMaxFileSize))
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		g3.ZL().Error("open upload file failed. please check", zap.Error(err))
+		FailedMessage(ctx, "参数错误")
+		return
+	}
+	defer file.Close()
+	reader, err := NewImportReader(format, file, fileHeader.Size)
+	if err != nil {
+		g3.ZL().Error("read upload file failed. please check", zap.Error(err))
+		if errors.Is(err, crud.ErrValidation) {
+			FailedError(ctx, err)
+		} else {
+			FailedMessage(ctx, "操作失败:文件格式错误")
+		}
+		return
+	}
+
+	c := crud.WithLocale(RequestContext(ctx), requestLocale(ctx, params.Lang))
+	if params.Partial {
+		c = crud.WithPartialBatch(c)
+	}
+	options := crud.ImportOptions{Mode: params.Mode, DryRun: params.DryRun}
+	if binding.Validator != nil {
+		options.Validate = func(m crud.ModelInterface) error {
+			return binding.Validator.ValidateStruct(m)
+		}
+	}
+	operator := ctx.GetInt64(auth.CtxJwtUid)
+	result, err := crud.Import(c, baseApi.Dao, reader, operator, options)
+	if err != nil {
+		g3.ZL().Error("import failed. please check", zap.Error(err))
+	}
+	if result != nil && len(result.Errors) > 0 && len(ExportContentType(params.Report)) > 0 {
+		importReport(ctx, baseApi.Dao.GetModel().Table(), params.Report, result)
+		return
+	}
+	switch {
+	case err == nil:
+		SuccessData(ctx, result)
+	case errors.Is(err, crud.ErrBatchFailed):
+		FailedBadRequest(ctx, "操作失败", result)
+	default:
+		FailedError(ctx, err)
+	}
+}
+
+// importReport 以文件返回导入的错误明细
+func importReport(ctx *gin.Context, table string, format string, result *crud.ImportResult) {
+	filename := table + "-import-errors-" + time.Now().Format("20060102150405") + "." + format
+	ctx.Header("Content-Type", ExportContentType(format))
+	ctx.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	ctx.Status(http.StatusOK)
+	writer, err := NewExportWriter(format, ctx.Writer)
+	if err == nil {
+		err = writer.WriteRow([]interface{}{"行号", "列", "错误"})
+	}
+	for _, e := range result.Errors {
+		if err != nil {
+			break
+		}
+		err = writer.WriteRow([]interface{}{e.Row, e.Column, e.Msg})
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		g3.ZL().Error("write import report failed. please check", zap.Error(err))
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 554949297@qq.com . 2022-2022 . All rights reserved
+
+package net
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/zhouhp1295/g3/crud"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// xlsxFile 写入一行的 xlsx 文件
+func xlsxFile(t *testing.T, values ...interface{}) []byte {
+	var buf bytes.Buffer
+	writer, err := NewExportWriter(ExportXlsx, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writer.WriteRow(values); err != nil {
+		t.Fatal(err)
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestXlsxPartSizeLimit(t *testing.T) {
+	defer func(limit int64) { ImportMaxXlsxPartSize = limit }(ImportMaxXlsxPartSize)
+	//压缩后很小, 解压后超过限制
+	data := xlsxFile(t, strings.Repeat("a", 1<<20))
+	if len(data) > 1<<14 {
+		t.Fatalf("expected compressed file, got %d bytes", len(data))
+	}
+	ImportMaxXlsxPartSize = 1 << 16
+	if _, err := NewImportReader(ExportXlsx, bytes.NewReader(data), int64(len(data))); !errors.Is(err, crud.ErrValidation) {
+		t.Fatalf("expected ErrValidation, got %v", err)
+	}
+	ImportMaxXlsxPartSize = 2 << 20
+	reader, err := NewImportReader(ExportXlsx, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record, err := reader.Read(); err != nil || len(record) != 1 || len(record[0]) != 1<<20 {
+		t.Fatalf("unexpected record of %d values: %v", len(record), err)
+	}
+
+	//声明的大小有误时按实际读取的大小校验
+	part := &xlsxPart{r: io.LimitReader(strings.NewReader(strings.Repeat("a", 100)), 11), c: io.NopCloser(nil), name: "sheet", limit: 10}
+	if _, err = io.ReadAll(part); !errors.Is(err, crud.ErrValidation) {
+		t.Fatalf("expected ErrValidation, got %v", err)
+	}
+}
+
+func TestHandleImportFileSizeLimit(t *testing.T) {
+	defer func(limit int64) { ImportMaxFileSize = limit }(ImportMaxFileSize)
+	ImportMaxFileSize = 100
+	gin.SetMode(gin.TestMode)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, _ := form.CreateFormFile("file", "users.csv")
+	_, _ = file.Write([]byte("username\n" + strings.Repeat("alice\n", 50)))
+	_ = form.Close()
+
+	cases := []struct {
+		name          string
+		contentLength int64
+	}{
+		{"file size", int64(body.Len())},
+		{"content length", ImportMaxFileSize + 1<<20 + 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/import", bytes.NewReader(body.Bytes()))
+			ctx.Request.Header.Set("Content-Type", form.FormDataContentType())
+			ctx.Request.ContentLength = c.contentLength
+			new(BaseApi).HandleImport(ctx)
+			var resp struct {
+				Code int    `json:"code"`
+				Msg  string `json:"msg"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Msg, "size limit") {
+				t.Fatalf("unexpected response %s", w.Body.String())
+			}
+		})
+	}
+}